@@ -0,0 +1,596 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"main.go/internal/activitypub"
+	"main.go/internal/databases"
+	"main.go/internal/stream"
+)
+
+// Local actors and objects are named by id rather than handle, so they keep
+// their IRIs when a user changes handle. Users without a handle don't
+// federate.
+
+const outboxSize = 20
+
+func (cfg *apiConfig) actorIRI(userId uuid.UUID) string {
+	return cfg.baseURL + "/ap/users/" + userId.String()
+}
+
+func (cfg *apiConfig) noteIRI(chirpId uuid.UUID) string {
+	return cfg.baseURL + "/ap/chirps/" + chirpId.String()
+}
+
+func (cfg *apiConfig) followIRI(followId uuid.UUID) string {
+	return cfg.baseURL + "/ap/follows/" + followId.String()
+}
+
+// localID reads the id out of one of our IRIs under prefix, such as
+// "/ap/chirps/".
+func (cfg *apiConfig) localID(iri, prefix string) (uuid.UUID, bool) {
+	rest, ok := strings.CutPrefix(iri, cfg.baseURL+prefix)
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(rest)
+	return id, err == nil
+}
+
+// actorKey returns the user's signing key, creating it on first use.
+func (cfg *apiConfig) actorKey(ctx context.Context, userId uuid.UUID) (databases.ActorKey, error) {
+	key, err := cfg.dbQueries.GetActorKey(ctx, userId)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return key, err
+	}
+	privatePEM, publicPEM, err := activitypub.GenerateKey()
+	if err != nil {
+		return databases.ActorKey{}, err
+	}
+	// a concurrent request may have created one first; that one wins
+	err = cfg.dbQueries.CreateActorKey(ctx, databases.CreateActorKeyParams{
+		UserID:        userId,
+		PublicKeyPem:  publicPEM,
+		PrivateKeyPem: privatePEM,
+	})
+	if err != nil {
+		return databases.ActorKey{}, err
+	}
+	return cfg.dbQueries.GetActorKey(ctx, userId)
+}
+
+// federatedUser loads a user that has a handle, reporting false for
+// unknown users and users without one.
+func (cfg *apiConfig) federatedUser(ctx context.Context, userId uuid.UUID) (databases.User, bool, error) {
+	user, err := cfg.dbQueries.GetUserById(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, false, nil
+	}
+	if err != nil {
+		return user, false, err
+	}
+	return user, user.Handle.Valid, nil
+}
+
+func (cfg *apiConfig) chirpNote(chirpId, userId uuid.UUID, body string, createdAt time.Time) activitypub.Note {
+	actor := cfg.actorIRI(userId)
+	note := activitypub.Note{
+		ID:           cfg.noteIRI(chirpId),
+		Type:         "Note",
+		AttributedTo: actor,
+		Content:      activitypub.HTML(body),
+		URL:          cfg.baseURL + "/api/chirps/" + chirpId.String(),
+		Published:    createdAt.UTC(),
+		To:           activitypub.Audience{activitypub.Public},
+		Cc:           activitypub.Audience{actor + "/followers"},
+	}
+	for _, tag := range stream.Tags(body) {
+		note.Tag = append(note.Tag, activitypub.Tag{
+			Type: "Hashtag",
+			Href: cfg.baseURL + "/tags/" + url.PathEscape(tag) + "/feed.atom",
+			Name: "#" + tag,
+		})
+	}
+	return note
+}
+
+func (cfg *apiConfig) createActivity(note activitypub.Note) (activitypub.Activity, error) {
+	activity, err := activitypub.NewActivity(note.ID+"/activity", "Create", note.AttributedTo, note)
+	activity.To, activity.Cc, activity.Published = note.To, note.Cc, &note.Published
+	return activity, err
+}
+
+func respondWithActivity(w http.ResponseWriter, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", activitypub.ContentType)
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// webFinger answers acct:handle@host lookups, and lookups by actor IRI.
+func webFinger(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resource := r.URL.Query().Get("resource")
+		var user databases.User
+		var err error
+		if userId, ok := apiCfg.localID(resource, "/ap/users/"); ok {
+			var federated bool
+			user, federated, err = apiCfg.federatedUser(r.Context(), userId)
+			if err == nil && !federated {
+				err = sql.ErrNoRows
+			}
+		} else {
+			handle, host, parseErr := activitypub.ParseAccount(resource)
+			if parseErr != nil || host != apiCfg.federationHost {
+				w.WriteHeader(404)
+				return
+			}
+			user, err = apiCfg.dbQueries.GetUserByHandle(r.Context(), sql.NullString{String: strings.ToLower(handle), Valid: true})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		actor := apiCfg.actorIRI(user.ID)
+		data, err := json.Marshal(activitypub.JRD{
+			Subject: "acct:" + user.Handle.String + "@" + apiCfg.federationHost,
+			Aliases: []string{actor},
+			Links: []activitypub.Link{
+				{Rel: "self", Type: activitypub.ContentType, Href: actor},
+				{Rel: "alternate", Type: "application/atom+xml", Href: apiCfg.baseURL + "/users/" + user.Handle.String + "/feed.atom"},
+			},
+		})
+		if err != nil {
+			log.Printf("Error marshalling json: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		w.Header().Set("Content-Type", activitypub.JRDContentType)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write(data)
+	}
+}
+
+func getActor(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		user, federated, err := apiCfg.federatedUser(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if !federated {
+			w.WriteHeader(404)
+			return
+		}
+		key, err := apiCfg.actorKey(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error loading actor key: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		id := apiCfg.actorIRI(userId)
+		respondWithActivity(w, activitypub.Actor{
+			Context:           activitypub.Context,
+			ID:                id,
+			Type:              "Person",
+			PreferredUsername: user.Handle.String,
+			Name:              user.Handle.String,
+			Inbox:             id + "/inbox",
+			Outbox:            id + "/outbox",
+			Followers:         id + "/followers",
+			Endpoints:         &activitypub.Endpoints{SharedInbox: apiCfg.baseURL + "/ap/inbox"},
+			PublicKey: activitypub.PublicKey{
+				ID:           id + "#main-key",
+				Owner:        id,
+				PublicKeyPem: key.PublicKeyPem,
+			},
+			Published: &user.CreatedAt,
+		})
+	}
+}
+
+// getActorOutbox lists Create activities for the user's newest chirps.
+func getActorOutbox(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		_, federated, err := apiCfg.federatedUser(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if !federated {
+			w.WriteHeader(404)
+			return
+		}
+		chirps, err := apiCfg.dbQueries.GetChirpsByUSer(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		outbox := activitypub.OrderedCollection{
+			Context:    activitypub.Context,
+			ID:         apiCfg.actorIRI(userId) + "/outbox",
+			Type:       "OrderedCollection",
+			TotalItems: len(chirps),
+		}
+		// oldest first; the collection is newest first
+		for i := len(chirps) - 1; i >= max(len(chirps)-outboxSize, 0); i-- {
+			activity, err := apiCfg.createActivity(apiCfg.chirpNote(chirps[i].ID, userId, chirps[i].Body, chirps[i].CreatedAt))
+			if err != nil {
+				log.Printf("Error building activity: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			activity.Context = nil
+			outbox.OrderedItems = append(outbox.OrderedItems, activity)
+		}
+		respondWithActivity(w, outbox)
+	}
+}
+
+// getActorFollowers only gives the count; who follows whom isn't published.
+func getActorFollowers(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		_, federated, err := apiCfg.federatedUser(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if !federated {
+			w.WriteHeader(404)
+			return
+		}
+		count, err := apiCfg.dbQueries.CountRemoteFollowers(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithActivity(w, activitypub.OrderedCollection{
+			Context:    activitypub.Context,
+			ID:         apiCfg.actorIRI(userId) + "/followers",
+			Type:       "OrderedCollection",
+			TotalItems: int(count),
+		})
+	}
+}
+
+func getNote(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		chirp, err := apiCfg.dbQueries.GetChirpById(r.Context(), chirpId)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		_, federated, err := apiCfg.federatedUser(r.Context(), chirp.UserID)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if !federated {
+			w.WriteHeader(404)
+			return
+		}
+		note := apiCfg.chirpNote(chirp.ID, chirp.UserID, chirp.Body, chirp.CreatedAt)
+		note.Context = activitypub.Context
+		respondWithActivity(w, note)
+	}
+}
+
+// refreshRemoteActor fetches an actor document and caches it.
+func (cfg *apiConfig) refreshRemoteActor(ctx context.Context, id string) (databases.RemoteActor, error) {
+	actor, err := cfg.apClient.FetchActor(ctx, id)
+	if err != nil {
+		return databases.RemoteActor{}, err
+	}
+	u, err := url.Parse(actor.ID)
+	if err != nil {
+		return databases.RemoteActor{}, err
+	}
+	sharedInbox := sql.NullString{}
+	if actor.SharedInbox() != actor.Inbox && activitypub.SameHost(actor.ID, actor.SharedInbox()) {
+		sharedInbox = sql.NullString{String: actor.SharedInbox(), Valid: true}
+	}
+	err = cfg.dbQueries.UpsertRemoteActor(ctx, databases.UpsertRemoteActorParams{
+		ID:           actor.ID,
+		Handle:       actor.PreferredUsername + "@" + u.Host,
+		Inbox:        actor.Inbox,
+		SharedInbox:  sharedInbox,
+		KeyID:        actor.PublicKey.ID,
+		PublicKeyPem: actor.PublicKey.PublicKeyPem,
+	})
+	if err != nil {
+		return databases.RemoteActor{}, err
+	}
+	return cfg.dbQueries.GetRemoteActor(ctx, actor.ID)
+}
+
+var errUnknownKey = errors.New("signing key does not belong to a known actor")
+
+// actorRefetchWait is how long a cached actor is trusted before a bad
+// signature may fetch it again, so forged requests can't be used to make us
+// hammer the actor's server.
+const actorRefetchWait = time.Minute
+
+// verifyInboxSignature returns the actor whose key signed the request. A
+// key we haven't seen is fetched from its owner, and a cached key that
+// doesn't verify is fetched again in case the actor rotated it, at most
+// once per actorRefetchWait.
+func (cfg *apiConfig) verifyInboxSignature(r *http.Request, body []byte) (databases.RemoteActor, error) {
+	sig, err := activitypub.ParseSignature(r.Header)
+	if err != nil {
+		return databases.RemoteActor{}, err
+	}
+	verify := func(actor databases.RemoteActor) error {
+		if actor.KeyID != sig.KeyID {
+			return errUnknownKey
+		}
+		key, err := activitypub.ParsePublicKey(actor.PublicKeyPem)
+		if err != nil {
+			return err
+		}
+		return sig.Verify(r, body, key, time.Now())
+	}
+	actor, err := cfg.dbQueries.GetRemoteActorByKey(r.Context(), sig.KeyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		actor, err = cfg.refreshRemoteActor(r.Context(), activitypub.KeyOwner(sig.KeyID))
+		if err != nil {
+			return databases.RemoteActor{}, err
+		}
+		return actor, verify(actor)
+	}
+	if err != nil {
+		return databases.RemoteActor{}, err
+	}
+	err = verify(actor)
+	if errors.Is(err, activitypub.ErrBadSignature) && time.Since(actor.FetchedAt) >= actorRefetchWait {
+		actor, err = cfg.refreshRemoteActor(r.Context(), actor.ID)
+		if err != nil {
+			return databases.RemoteActor{}, err
+		}
+		err = verify(actor)
+	}
+	return actor, err
+}
+
+// apInbox receives activities for local actors. The shared inbox and the
+// per-user inboxes behave the same, since every activity names its object.
+func apInbox(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Activity too large")
+			return
+		}
+		var activity activitypub.Activity
+		err = json.Unmarshal(body, &activity)
+		if err != nil || activity.ID == "" || activity.Type == "" {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode activity")
+			return
+		}
+		actor, err := apiCfg.verifyInboxSignature(r, body)
+		if err != nil {
+			log.Printf("Rejected activity %s: %s", activity.ID, err)
+			respondWithError(w, http.StatusUnauthorized, "Invalid signature")
+			return
+		}
+		if activity.Actor != actor.ID || !activitypub.SameHost(actor.ID, activity.ID) {
+			respondWithError(w, http.StatusUnauthorized, "Activity wasn't signed by its actor")
+			return
+		}
+		rows, err := apiCfg.dbQueries.RecordInboxActivity(r.Context(), activity.ID)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			// seen it already
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		err = apiCfg.handleActivity(r.Context(), actor, activity)
+		if err != nil {
+			log.Printf("Error handling activity %s: %s", activity.ID, err)
+			// let the sender's retry be handled again
+			err = apiCfg.dbQueries.ForgetInboxActivity(context.WithoutCancel(r.Context()), activity.ID)
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+			}
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// handleActivity applies an activity from actor. Activities about objects
+// we don't know are ignored.
+func (cfg *apiConfig) handleActivity(ctx context.Context, actor databases.RemoteActor, activity activitypub.Activity) error {
+	object := activity.ObjectID()
+	switch activity.Type {
+	case "Follow":
+		return cfg.acceptFollow(ctx, actor, activity)
+	case "Undo":
+		// the only undo with state here is a follow; likes only notified
+		_, err := cfg.dbQueries.RemoveRemoteFollower(ctx, databases.RemoveRemoteFollowerParams{
+			ActorID:  actor.ID,
+			FollowID: object,
+		})
+		return err
+	case "Accept", "Reject":
+		followId, ok := cfg.localID(object, "/ap/follows/")
+		if !ok {
+			return nil
+		}
+		var err error
+		if activity.Type == "Accept" {
+			_, err = cfg.dbQueries.AcceptRemoteFollow(ctx, databases.AcceptRemoteFollowParams{ID: followId, ActorID: actor.ID})
+		} else {
+			_, err = cfg.dbQueries.RejectRemoteFollow(ctx, databases.RejectRemoteFollowParams{ID: followId, ActorID: actor.ID})
+		}
+		return err
+	case "Create":
+		if activity.ObjectType() != "Note" {
+			return nil
+		}
+		var note activitypub.Note
+		err := json.Unmarshal(activity.Object, &note)
+		if err != nil || note.AttributedTo != actor.ID || !activitypub.SameHost(actor.ID, note.ID) {
+			return nil
+		}
+		if note.Published.IsZero() {
+			note.Published = time.Now()
+		}
+		_, err = cfg.dbQueries.CreateRemotePost(ctx, databases.CreateRemotePostParams{
+			ID:          note.ID,
+			ActorID:     actor.ID,
+			Url:         sql.NullString{String: note.URL, Valid: note.URL != ""},
+			Content:     activitypub.PlainText(note.Content),
+			PublishedAt: note.Published.UTC(),
+		})
+		return err
+	case "Delete":
+		if object == actor.ID {
+			return cfg.dbQueries.DeleteRemoteActor(ctx, actor.ID)
+		}
+		_, err := cfg.dbQueries.DeleteRemotePost(ctx, databases.DeleteRemotePostParams{ID: object, ActorID: actor.ID})
+		return err
+	case "Like":
+		chirpId, ok := cfg.localID(object, "/ap/chirps/")
+		if !ok {
+			return nil
+		}
+		chirp, err := cfg.dbQueries.GetChirpById(ctx, chirpId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return cfg.addNotification(ctx, databases.CreateNotificationParams{
+			UserID:        chirp.UserID,
+			Type:          notificationLike,
+			ChirpID:       uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			RemoteActorID: sql.NullString{String: actor.ID, Valid: true},
+		})
+	}
+	return nil
+}
+
+// acceptFollow records a remote follower and answers with an Accept. Its
+// id comes from the Follow's, so a redelivered Follow isn't accepted twice.
+func (cfg *apiConfig) acceptFollow(ctx context.Context, actor databases.RemoteActor, follow activitypub.Activity) error {
+	userId, ok := cfg.localID(follow.ObjectID(), "/ap/users/")
+	if !ok {
+		return nil
+	}
+	_, federated, err := cfg.federatedUser(ctx, userId)
+	if err != nil || !federated {
+		return err
+	}
+	_, err = cfg.actorKey(ctx, userId)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(follow.ID))
+	follow.Context = nil
+	accept, err := activitypub.NewActivity(cfg.actorIRI(userId)+"#accepts/"+hex.EncodeToString(sum[:16]), "Accept", cfg.actorIRI(userId), follow)
+	if err != nil {
+		return err
+	}
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+	err = qtx.AddRemoteFollower(ctx, databases.AddRemoteFollowerParams{
+		UserID:   userId,
+		ActorID:  actor.ID,
+		FollowID: follow.ID,
+	})
+	if err != nil {
+		return err
+	}
+	err = queueActivity(ctx, qtx, userId, actor.Inbox, accept)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return cfg.addNotification(ctx, databases.CreateNotificationParams{
+		UserID:        userId,
+		Type:          notificationFollow,
+		RemoteActorID: sql.NullString{String: actor.ID, Valid: true},
+	})
+}
+
+// queueActivity schedules delivery of an activity to one inbox.
+func queueActivity(ctx context.Context, q *databases.Queries, userId uuid.UUID, inbox string, activity activitypub.Activity) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", activity.ID, err)
+	}
+	return q.QueueActivityDelivery(ctx, databases.QueueActivityDeliveryParams{
+		UserID:     userId,
+		ActivityID: activity.ID,
+		Inbox:      inbox,
+		Body:       body,
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"main.go/internal/analytics"
+	"main.go/internal/databases"
+)
+
+// Series shown on /admin/metrics, each ending with the current period.
+const (
+	dailyVisitPeriods   = 30
+	weeklyVisitPeriods  = 12
+	monthlyVisitPeriods = 12
+)
+
+// flushVisits adds this instance's pending visits to the stored buckets.
+// Buckets that fail to flush go back to the counter for the next try.
+func (cfg *apiConfig) flushVisits(ctx context.Context) error {
+	buckets := cfg.visits.Take()
+	for i, bucket := range buckets {
+		err := cfg.flushVisitBucket(ctx, bucket)
+		if err != nil {
+			cfg.visits.Put(buckets[i:])
+			return fmt.Errorf("flushing visits for %s: %w", bucket.Start.Format(time.DateOnly), err)
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) flushVisitBucket(ctx context.Context, bucket analytics.Bucket) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+	stored, err := qtx.LockVisitBucket(ctx, bucket.Start)
+	if err != nil {
+		return err
+	}
+	visitors, err := analytics.ParseSketch(stored)
+	if err != nil {
+		return err
+	}
+	visitors.Merge(bucket.Visitors)
+	err = qtx.AddVisits(ctx, databases.AddVisitsParams{
+		BucketStart: bucket.Start,
+		Hits:        bucket.Visits,
+		Visitors:    visitors.Bytes(),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type adminMetrics struct {
+	Visits int64 `json:"visits"`
+	// Requests and ChirpsCreated come from this instance's registry and
+	// count since it started; the metrics listener has the rest.
+	Requests      float64           `json:"requests"`
+	ChirpsCreated float64           `json:"chirps_created"`
+	ActiveUsers   float64           `json:"active_users"`
+	Daily         []analytics.Point `json:"daily"`
+	Weekly        []analytics.Point `json:"weekly"`
+	Monthly       []analytics.Point `json:"monthly"`
+}
+
+// loadAdminMetrics reads the stored visits, so each instance's latest
+// visits show up once its periodic flush has run.
+func (cfg *apiConfig) loadAdminMetrics(ctx context.Context) (adminMetrics, error) {
+	var m adminMetrics
+	var err error
+	m.Visits, err = cfg.dbQueries.CountVisits(ctx)
+	if err != nil {
+		return adminMetrics{}, err
+	}
+	for name, value := range map[string]*float64{
+		"chirpy_http_requests_total":  &m.Requests,
+		"chirpy_chirps_created_total": &m.ChirpsCreated,
+		"chirpy_active_users":         &m.ActiveUsers,
+	} {
+		*value, err = cfg.metrics.Value(name)
+		if err != nil {
+			return adminMetrics{}, err
+		}
+	}
+	now := time.Now()
+	since := analytics.Since(analytics.Daily, dailyVisitPeriods, now)
+	for _, first := range []time.Time{
+		analytics.Since(analytics.Weekly, weeklyVisitPeriods, now),
+		analytics.Since(analytics.Monthly, monthlyVisitPeriods, now),
+	} {
+		if first.Before(since) {
+			since = first
+		}
+	}
+	rows, err := cfg.dbQueries.ListVisitBuckets(ctx, since)
+	if err != nil {
+		return adminMetrics{}, err
+	}
+	buckets := make([]analytics.Bucket, 0, len(rows))
+	for _, row := range rows {
+		visitors, err := analytics.ParseSketch(row.Visitors)
+		if err != nil {
+			return adminMetrics{}, fmt.Errorf("visit bucket %s: %w", row.BucketStart.Format(time.DateOnly), err)
+		}
+		buckets = append(buckets, analytics.Bucket{Start: row.BucketStart, Visits: row.Hits, Visitors: visitors})
+	}
+	m.Daily = analytics.Series(buckets, analytics.Daily, dailyVisitPeriods, now)
+	m.Weekly = analytics.Series(buckets, analytics.Weekly, weeklyVisitPeriods, now)
+	m.Monthly = analytics.Series(buckets, analytics.Monthly, monthlyVisitPeriods, now)
+	return m, nil
+}
+
+// displayServerHits is the admin metrics page. It serves JSON for
+// ?format=json or an Accept of application/json, and HTML otherwise.
+func displayServerHits(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		m, err := apiCfg.loadAdminMetrics(r.Context())
+		if err != nil {
+			log.Printf("Error loading metrics: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			respondWithJSON(w, http.StatusOK, m)
+			return
+		}
+		var page strings.Builder
+		page.WriteString("<html><body> <h1>Welcome, Chirpy Admin</h1>")
+		fmt.Fprintf(&page, "<p>Chirpy has been visited %d times!</p>", m.Visits)
+		fmt.Fprintf(&page, "<p>Active users: %.0f</p>", m.ActiveUsers)
+		fmt.Fprintf(&page, "<p>Since this instance started: %.0f requests served, %.0f chirps posted</p>", m.Requests, m.ChirpsCreated)
+		for _, series := range []struct {
+			title  string
+			layout string
+			points []analytics.Point
+		}{
+			{"Daily visits", time.DateOnly, m.Daily},
+			{"Weekly visits", "week of " + time.DateOnly, m.Weekly},
+			{"Monthly visits", "January 2006", m.Monthly},
+		} {
+			fmt.Fprintf(&page, "<h2>%s</h2><table><tr><th>Period</th><th>Visits</th><th>Unique visitors</th></tr>", series.title)
+			for i := len(series.points) - 1; i >= 0; i-- {
+				p := series.points[i]
+				fmt.Fprintf(&page, "<tr><td>%s</td><td>%d</td><td>%d</td></tr>", p.Start.Format(series.layout), p.Visits, p.UniqueVisitors)
+			}
+			page.WriteString("</table>")
+		}
+		page.WriteString("<p>Everything else is at /metrics on the metrics listener.</p></body></html>")
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page.String()))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+
+	"main.go/internal/databases"
+	"main.go/internal/metrics"
+)
+
+// fakeResult is what a fake query returns: column names and rows for
+// queries that read, or the number of affected rows for those that don't.
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+type fakeQuery func(args []driver.Value) (fakeResult, error)
+
+// fakeDB stands in for Postgres in handler tests. Queries are answered by
+// their sqlc name; one that has no answer fails the call, so a test only
+// has to describe the queries its handler actually runs. Transactions are
+// accepted but not isolated.
+type fakeDB struct {
+	mu      sync.Mutex
+	queries map[string]fakeQuery
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{queries: map[string]fakeQuery{}}
+}
+
+func (f *fakeDB) on(name string, q fakeQuery) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries[name] = q
+}
+
+func (f *fakeDB) open() (*sql.DB, *databases.Queries) {
+	db := sql.OpenDB(fakeConnector{f})
+	return db, databases.New(db)
+}
+
+func (f *fakeDB) run(query string, args []driver.NamedValue) (fakeResult, error) {
+	name := metrics.QueryName(query)
+	f.mu.Lock()
+	q, ok := f.queries[name]
+	f.mu.Unlock()
+	if !ok {
+		return fakeResult{}, fmt.Errorf("fake database has no answer for %s", name)
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return q(values)
+}
+
+// fakeValue answers a query returning a single value, such as an EXISTS.
+func fakeValue(v driver.Value) fakeQuery {
+	return func([]driver.Value) (fakeResult, error) {
+		return fakeResult{columns: []string{"value"}, rows: [][]driver.Value{{v}}}, nil
+	}
+}
+
+// fakeTable answers with rows. Scans are positional, so the columns are
+// only counted.
+func fakeTable(rows ...[]driver.Value) fakeResult {
+	result := fakeResult{rows: rows}
+	if len(rows) > 0 {
+		for i := range rows[0] {
+			result.columns = append(result.columns, fmt.Sprintf("column%d", i+1))
+		}
+	}
+	return result
+}
+
+// fakeExec answers a query that returns no rows.
+func fakeExec(affected int64) fakeQuery {
+	return func([]driver.Value) (fakeResult, error) {
+		return fakeResult{affected: affected}, nil
+	}
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("use fakeDB.open")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.affected), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return fakeConn{s.db}.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return fakeConn{s.db}.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	out := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		out[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return out
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
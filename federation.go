@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/activitypub"
+	"main.go/internal/databases"
+	"main.go/internal/events"
+)
+
+const (
+	activityMaxAttempts = 10
+	activityBatchSize   = 50
+	activityConcurrency = 8
+	// activityLease is how long ClaimActivityDeliveries holds a delivery.
+	activityLease = 5 * time.Minute
+)
+
+// Retries start after a minute and double, so a server that is down has
+// about eight hours to come back before we give up on the delivery.
+var activityRetryBackoff = auth.Backoff{Free: 0, Base: time.Minute, Max: 6 * time.Hour}
+
+var federatedEventTypes = []string{eventChirpCreated, eventChirpDeleted}
+
+// federateChirps is the event bus subscriber that sends new and deleted
+// chirps to the author's remote followers. Deliveries are unique per
+// activity and inbox, so seeing an event twice is harmless.
+func (cfg *apiConfig) federateChirps(ctx context.Context, e events.Event) error {
+	var chirp struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		Body      string    `json:"body"`
+		UserID    uuid.UUID `json:"user_id"`
+	}
+	err := json.Unmarshal(e.Payload, &chirp)
+	if err != nil {
+		return err
+	}
+	var activity activitypub.Activity
+	switch e.Type {
+	case eventChirpCreated:
+		activity, err = cfg.createActivity(cfg.chirpNote(chirp.ID, chirp.UserID, chirp.Body, chirp.CreatedAt))
+	case eventChirpDeleted:
+		note := cfg.noteIRI(chirp.ID)
+		activity, err = activitypub.NewActivity(note+"#delete", "Delete", cfg.actorIRI(chirp.UserID), activitypub.Tombstone{ID: note, Type: "Tombstone"})
+		activity.To = activitypub.Audience{activitypub.Public}
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	return cfg.dbQueries.QueueFollowerDeliveries(ctx, databases.QueueFollowerDeliveriesParams{
+		UserID:     chirp.UserID,
+		ActivityID: activity.ID,
+		Body:       body,
+	})
+}
+
+// deliverActivities sends the activities that are due. Claims are leased,
+// as with webhooks, so every instance can run this. A batch is delivered
+// concurrently and stops starting deliveries halfway through the lease, so
+// slow inboxes can't hold claims past it and get the activity sent twice.
+func (cfg *apiConfig) deliverActivities(ctx context.Context) error {
+	deliveries, err := cfg.dbQueries.ClaimActivityDeliveries(ctx, activityBatchSize)
+	if err != nil {
+		return fmt.Errorf("claiming deliveries: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, activityLease/2)
+	defer cancel()
+	sem := make(chan struct{}, activityConcurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, delivery := range deliveries {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cfg.attemptActivityDelivery(ctx, delivery)
+		}()
+	}
+	return nil
+}
+
+func (cfg *apiConfig) attemptActivityDelivery(ctx context.Context, delivery databases.ClaimActivityDeliveriesRow) {
+	update := databases.UpdateActivityDeliveryParams{
+		ID:            delivery.ID,
+		Status:        "delivered",
+		Attempts:      delivery.Attempts + 1,
+		NextAttemptAt: time.Now(),
+	}
+	key, err := activitypub.ParsePrivateKey(delivery.PrivateKeyPem)
+	if err == nil {
+		var status int
+		status, err = cfg.apClient.Deliver(ctx, delivery.Inbox, delivery.Body, cfg.actorIRI(delivery.UserID)+"#main-key", key)
+		if status != 0 {
+			update.ResponseStatus = sql.NullInt32{Int32: int32(status), Valid: true}
+		}
+	}
+	if err != nil {
+		update.LastError = sql.NullString{String: err.Error(), Valid: true}
+		update.Status = "pending"
+		update.NextAttemptAt = time.Now().Add(activityRetryBackoff.Delay(int(update.Attempts)))
+		status := update.ResponseStatus.Int32
+		// a server refusing the activity won't change its mind
+		permanent := status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+		if permanent || update.Attempts >= activityMaxAttempts {
+			update.Status = "failed"
+		}
+	}
+	err = cfg.dbQueries.UpdateActivityDelivery(context.WithoutCancel(ctx), update)
+	if err != nil {
+		log.Printf("Error recording activity delivery %s: %s", delivery.ID, err)
+	}
+}
+
+type RemoteFollow struct {
+	ID        uuid.UUID `json:"id"`
+	Account   string    `json:"account"`
+	ActorID   string    `json:"actor_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Accepted  bool      `json:"accepted"`
+}
+
+// followRemote follows an account on another server, given as
+// user@example.com. The follow is pending until the server accepts it.
+func followRemote(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type paramBody struct {
+			Account string `json:"account"`
+		}
+		userId, err := apiCfg.authorize(r, auth.ScopeProfileWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		params := paramBody{}
+		err = json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		_, host, err := activitypub.ParseAccount(params.Account)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Account must look like user@example.com")
+			return
+		}
+		if host == apiCfg.federationHost {
+			respondWithError(w, http.StatusBadRequest, "Follow local users with /api/users/{userID}/follow")
+			return
+		}
+		_, federated, err := apiCfg.federatedUser(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if !federated {
+			respondWithError(w, http.StatusConflict, "Choose a handle before following remote accounts")
+			return
+		}
+		actorId, err := apiCfg.apClient.Finger(r.Context(), params.Account)
+		if err != nil {
+			log.Printf("Error looking up %s: %s", params.Account, err)
+			respondWithError(w, http.StatusBadGateway, "Couldn't find that account")
+			return
+		}
+		actor, err := apiCfg.refreshRemoteActor(r.Context(), actorId)
+		if err != nil {
+			log.Printf("Error fetching %s: %s", actorId, err)
+			respondWithError(w, http.StatusBadGateway, "Couldn't fetch that account")
+			return
+		}
+		_, err = apiCfg.actorKey(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error loading actor key: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		follow, err := qtx.CreateRemoteFollow(r.Context(), databases.CreateRemoteFollowParams{
+			UserID:  userId,
+			ActorID: actor.ID,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if !follow.AcceptedAt.Valid {
+			activity, err := activitypub.NewActivity(apiCfg.followIRI(follow.ID), "Follow", apiCfg.actorIRI(userId), actor.ID)
+			if err == nil {
+				err = queueActivity(r.Context(), qtx, userId, actor.Inbox, activity)
+			}
+			if err != nil {
+				log.Printf("Error queueing follow: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusAccepted, RemoteFollow{
+			ID:        follow.ID,
+			Account:   actor.Handle,
+			ActorID:   actor.ID,
+			CreatedAt: follow.CreatedAt,
+			Accepted:  follow.AcceptedAt.Valid,
+		})
+	}
+}
+
+func listRemoteFollows(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authorize(r, auth.ScopeChirpsRead)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		follows, err := apiCfg.dbQueries.ListRemoteFollows(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		resp := []RemoteFollow{}
+		for _, follow := range follows {
+			resp = append(resp, RemoteFollow{
+				ID:        follow.ID,
+				Account:   follow.Handle,
+				ActorID:   follow.ActorID,
+				CreatedAt: follow.CreatedAt,
+				Accepted:  follow.AcceptedAt.Valid,
+			})
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+// unfollowRemote drops a remote follow and sends the server an Undo.
+func unfollowRemote(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authorize(r, auth.ScopeProfileWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		followId, err := uuid.Parse(r.PathValue("followID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		follow, err := qtx.DeleteRemoteFollow(r.Context(), databases.DeleteRemoteFollowParams{
+			ID:     followId,
+			UserID: userId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		actor, err := qtx.GetRemoteActor(r.Context(), follow.ActorID)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		followActivity, err := activitypub.NewActivity(apiCfg.followIRI(follow.ID), "Follow", apiCfg.actorIRI(userId), actor.ID)
+		if err != nil {
+			log.Printf("Error building activity: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		followActivity.Context = nil
+		undo, err := activitypub.NewActivity(followActivity.ID+"#undo", "Undo", followActivity.Actor, followActivity)
+		if err == nil {
+			err = queueActivity(r.Context(), qtx, userId, actor.Inbox, undo)
+		}
+		if err != nil {
+			log.Printf("Error queueing undo: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+type RemotePost struct {
+	ID          string    `json:"id"`
+	Account     string    `json:"account"`
+	URL         string    `json:"url,omitempty"`
+	Content     string    `json:"content"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// remoteTimeline lists posts from followed remote accounts, newest first,
+// up to ?limit= (default 20, at most 100).
+func remoteTimeline(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authorize(r, auth.ScopeChirpsRead)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				respondWithError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = min(limit, 100)
+		}
+		posts, err := apiCfg.dbQueries.ListRemoteTimeline(r.Context(), databases.ListRemoteTimelineParams{
+			UserID: userId,
+			Limit:  int32(limit),
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		resp := []RemotePost{}
+		for _, post := range posts {
+			resp = append(resp, RemotePost{
+				ID:          post.ID,
+				Account:     post.Handle,
+				URL:         post.Url.String,
+				Content:     post.Content,
+				PublishedAt: post.PublishedAt,
+			})
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
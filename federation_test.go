@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/activitypub"
+	"main.go/internal/events"
+	"main.go/internal/metrics"
+)
+
+type fedFollow struct {
+	userID, actorID string
+	acceptedAt      driver.Value
+}
+
+type fedDelivery struct {
+	id, userID, inbox string
+	body              []byte
+	status            string
+	attempts          int64
+	claimed           bool
+	lastError         driver.Value
+}
+
+// fedInstance is a Chirpy server on an httptest listener whose database
+// keeps just enough state for federation to run against another one.
+type fedInstance struct {
+	t      *testing.T
+	cfg    *apiConfig
+	server *httptest.Server
+	host   string
+
+	mu         sync.Mutex
+	users      map[string]string    // id to handle
+	keys       map[string][2]string // user id to public and private PEM
+	actors     map[string][]driver.Value
+	follows    map[string]*fedFollow
+	followers  map[string][]string // user id to follower actor ids
+	deliveries []*fedDelivery
+	seen       map[string]bool
+	posts      map[string][]driver.Value
+	chirps     map[string]string // chirp id to user id
+	outbox     []events.Event
+	notified   int
+}
+
+func newFedInstance(t *testing.T) *fedInstance {
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := &fedInstance{
+		t:         t,
+		users:     map[string]string{},
+		keys:      map[string][2]string{},
+		actors:    map[string][]driver.Value{},
+		follows:   map[string]*fedFollow{},
+		followers: map[string][]string{},
+		seen:      map[string]bool{},
+		posts:     map[string][]driver.Value{},
+		chirps:    map[string]string{},
+	}
+	db := newFakeDB()
+	db.on("IsAccessTokenDenied", fakeValue(false))
+	db.on("TouchSession", fakeExec(1))
+	db.on("IsSessionActive", fakeValue(true))
+	for name, q := range fi.queries() {
+		db.on(name, func(args []driver.Value) (fakeResult, error) {
+			fi.mu.Lock()
+			defer fi.mu.Unlock()
+			return q(args)
+		})
+	}
+
+	mux := http.NewServeMux()
+	fi.server = httptest.NewServer(mux)
+	t.Cleanup(fi.server.Close)
+	fi.host = strings.TrimPrefix(fi.server.URL, "http://")
+	fi.cfg = &apiConfig{
+		jwtConfig:      auth.JWTConfig{Keys: auth.NewKeySet(key), Issuer: "chirpy", Audience: "chirpy"},
+		metrics:        metrics.New(),
+		events:         events.NewDispatcher(nil),
+		baseURL:        fi.server.URL,
+		federationHost: fi.host,
+		apClient:       activitypub.NewClient("chirpy-test", true),
+	}
+	fi.cfg.db, fi.cfg.dbQueries = db.open()
+
+	mux.HandleFunc("GET /.well-known/webfinger", webFinger(fi.cfg))
+	mux.HandleFunc("GET /ap/users/{userID}", getActor(fi.cfg))
+	mux.HandleFunc("POST /ap/users/{userID}/inbox", apInbox(fi.cfg))
+	mux.HandleFunc("POST /ap/inbox", apInbox(fi.cfg))
+	mux.HandleFunc("POST /api/fediverse/follows", followRemote(fi.cfg))
+	mux.HandleFunc("GET /api/fediverse/timeline", remoteTimeline(fi.cfg))
+	mux.HandleFunc("POST /api/chirps", createChirp(fi.cfg))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", deleteChirp(fi.cfg))
+	return fi
+}
+
+// queries are the answers the federation handlers need, called with mu held.
+func (fi *fedInstance) queries() map[string]fakeQuery {
+	now := time.Now()
+	user := func(id string) (fakeResult, error) {
+		handle, ok := fi.users[id]
+		if !ok {
+			return fakeTable(), nil
+		}
+		return fakeTable([]driver.Value{id, now, now, handle + "@example.com", nil, false, now, nil, nil, nil, handle}), nil
+	}
+	actor := func(match func(row []driver.Value) bool) (fakeResult, error) {
+		for _, row := range fi.actors {
+			if match(row) {
+				return fakeTable(row), nil
+			}
+		}
+		return fakeTable(), nil
+	}
+	return map[string]fakeQuery{
+		"GetUserById": func(args []driver.Value) (fakeResult, error) {
+			return user(args[0].(string))
+		},
+		"GetUserByHandle": func(args []driver.Value) (fakeResult, error) {
+			for id, handle := range fi.users {
+				if handle == args[0] {
+					return user(id)
+				}
+			}
+			return fakeTable(), nil
+		},
+		"GetActorKey": func(args []driver.Value) (fakeResult, error) {
+			key, ok := fi.keys[args[0].(string)]
+			if !ok {
+				return fakeTable(), nil
+			}
+			return fakeTable([]driver.Value{args[0], key[0], key[1], now}), nil
+		},
+		"CreateActorKey": func(args []driver.Value) (fakeResult, error) {
+			if _, ok := fi.keys[args[0].(string)]; !ok {
+				fi.keys[args[0].(string)] = [2]string{args[1].(string), args[2].(string)}
+			}
+			return fakeResult{affected: 1}, nil
+		},
+		"UpsertRemoteActor": func(args []driver.Value) (fakeResult, error) {
+			fi.actors[args[0].(string)] = append(slices.Clone(args), time.Now())
+			return fakeResult{affected: 1}, nil
+		},
+		"GetRemoteActor": func(args []driver.Value) (fakeResult, error) {
+			return actor(func(row []driver.Value) bool { return row[0] == args[0] })
+		},
+		"GetRemoteActorByKey": func(args []driver.Value) (fakeResult, error) {
+			return actor(func(row []driver.Value) bool { return row[4] == args[0] })
+		},
+		"CreateRemoteFollow": func(args []driver.Value) (fakeResult, error) {
+			id := uuid.NewString()
+			follow := &fedFollow{userID: args[0].(string), actorID: args[1].(string)}
+			fi.follows[id] = follow
+			return fakeTable([]driver.Value{id, follow.userID, follow.actorID, now, nil}), nil
+		},
+		"AcceptRemoteFollow": func(args []driver.Value) (fakeResult, error) {
+			follow, ok := fi.follows[args[0].(string)]
+			if !ok || follow.actorID != args[1] {
+				return fakeResult{}, nil
+			}
+			follow.acceptedAt = time.Now()
+			return fakeResult{affected: 1}, nil
+		},
+		"AddRemoteFollower": func(args []driver.Value) (fakeResult, error) {
+			userId := args[0].(string)
+			fi.followers[userId] = append(fi.followers[userId], args[1].(string))
+			return fakeResult{affected: 1}, nil
+		},
+		"QueueActivityDelivery": func(args []driver.Value) (fakeResult, error) {
+			fi.queue(args[0].(string), args[2].(string), args[3].([]byte))
+			return fakeResult{affected: 1}, nil
+		},
+		"QueueFollowerDeliveries": func(args []driver.Value) (fakeResult, error) {
+			inboxes := map[string]bool{}
+			for _, actorId := range fi.followers[args[0].(string)] {
+				row := fi.actors[actorId]
+				inbox := row[2]
+				if row[3] != nil {
+					inbox = row[3]
+				}
+				if !inboxes[inbox.(string)] {
+					inboxes[inbox.(string)] = true
+					fi.queue(args[0].(string), inbox.(string), args[2].([]byte))
+				}
+			}
+			return fakeResult{affected: int64(len(inboxes))}, nil
+		},
+		"ClaimActivityDeliveries": func(args []driver.Value) (fakeResult, error) {
+			var rows [][]driver.Value
+			for _, d := range fi.deliveries {
+				if d.status == "pending" && !d.claimed {
+					d.claimed = true
+					rows = append(rows, []driver.Value{d.id, d.userID, d.inbox, d.body, d.attempts, fi.keys[d.userID][1]})
+				}
+			}
+			return fakeTable(rows...), nil
+		},
+		"UpdateActivityDelivery": func(args []driver.Value) (fakeResult, error) {
+			for _, d := range fi.deliveries {
+				if d.id == args[0] {
+					d.status, d.attempts, d.lastError = args[1].(string), args[2].(int64), args[5]
+					d.claimed = false
+				}
+			}
+			return fakeResult{affected: 1}, nil
+		},
+		"RecordInboxActivity": func(args []driver.Value) (fakeResult, error) {
+			if fi.seen[args[0].(string)] {
+				return fakeResult{}, nil
+			}
+			fi.seen[args[0].(string)] = true
+			return fakeResult{affected: 1}, nil
+		},
+		"ForgetInboxActivity": func(args []driver.Value) (fakeResult, error) {
+			delete(fi.seen, args[0].(string))
+			return fakeResult{affected: 1}, nil
+		},
+		"CreateRemotePost": func(args []driver.Value) (fakeResult, error) {
+			fi.posts[args[0].(string)] = append(slices.Clone(args), time.Now())
+			return fakeResult{affected: 1}, nil
+		},
+		"DeleteRemotePost": func(args []driver.Value) (fakeResult, error) {
+			post, ok := fi.posts[args[0].(string)]
+			if !ok || post[1] != args[1] {
+				return fakeResult{}, nil
+			}
+			delete(fi.posts, args[0].(string))
+			return fakeResult{affected: 1}, nil
+		},
+		"ListRemoteTimeline": func(args []driver.Value) (fakeResult, error) {
+			var rows [][]driver.Value
+			for _, post := range fi.posts {
+				for _, follow := range fi.follows {
+					if follow.userID == args[0] && follow.actorID == post[1] && follow.acceptedAt != nil {
+						rows = append(rows, append(slices.Clone(post), fi.actors[follow.actorID][1]))
+					}
+				}
+			}
+			return fakeTable(rows...), nil
+		},
+		"CreateNotification": func(args []driver.Value) (fakeResult, error) {
+			fi.notified++
+			return fakeTable([]driver.Value{uuid.NewString(), args[0], args[1], args[2], args[3], args[4], now, nil, args[5]}), nil
+		},
+		"CreateOutboxEvent": func(args []driver.Value) (fakeResult, error) {
+			fi.outbox = append(fi.outbox, events.Event{Type: args[0].(string), Payload: bytes.Clone(args[1].([]byte))})
+			return fakeResult{affected: 1}, nil
+		},
+		"CreateChirp": func(args []driver.Value) (fakeResult, error) {
+			id := uuid.NewString()
+			fi.chirps[id] = args[1].(string)
+			return fakeTable([]driver.Value{id, now, now, args[0], args[1]}), nil
+		},
+		"UserIdFromChirp": func(args []driver.Value) (fakeResult, error) {
+			userId, ok := fi.chirps[args[0].(string)]
+			if !ok {
+				return fakeTable(), nil
+			}
+			return fakeValue(userId)(nil)
+		},
+		"DeleteChirp": func(args []driver.Value) (fakeResult, error) {
+			delete(fi.chirps, args[0].(string))
+			return fakeResult{affected: 1}, nil
+		},
+	}
+}
+
+func (fi *fedInstance) queue(userId, inbox string, body []byte) {
+	fi.deliveries = append(fi.deliveries, &fedDelivery{
+		id:     uuid.NewString(),
+		userID: userId,
+		inbox:  inbox,
+		body:   bytes.Clone(body),
+		status: "pending",
+	})
+}
+
+func (fi *fedInstance) addUser(handle string) (uuid.UUID, string) {
+	id := uuid.New()
+	fi.mu.Lock()
+	fi.users[id.String()] = handle
+	fi.mu.Unlock()
+	token, err := auth.MakeSessionJWT(id, uuid.New(), fi.cfg.jwtConfig, time.Hour)
+	if err != nil {
+		fi.t.Fatal(err)
+	}
+	return id, token
+}
+
+func (fi *fedInstance) do(method, path, token string, body any, want int) []byte {
+	fi.t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			fi.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, fi.server.URL+path, &reqBody)
+	if err != nil {
+		fi.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fi.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	if resp.StatusCode != want {
+		fi.t.Fatalf("%s %s: got %d %s, want %d", method, path, resp.StatusCode, respBody.String(), want)
+	}
+	return respBody.Bytes()
+}
+
+// publish hands the recorded events to the federation subscriber, as the
+// event bus would.
+func (fi *fedInstance) publish() {
+	fi.t.Helper()
+	fi.mu.Lock()
+	outbox := fi.outbox
+	fi.outbox = nil
+	fi.mu.Unlock()
+	for _, e := range outbox {
+		if !slices.Contains(federatedEventTypes, e.Type) {
+			continue
+		}
+		if err := fi.cfg.federateChirps(context.Background(), e); err != nil {
+			fi.t.Fatal(err)
+		}
+	}
+}
+
+// deliver sends every queued activity and fails unless all arrived.
+func (fi *fedInstance) deliver() {
+	fi.t.Helper()
+	if err := fi.cfg.deliverActivities(context.Background()); err != nil {
+		fi.t.Fatal(err)
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if len(fi.deliveries) == 0 {
+		fi.t.Fatal("nothing was delivered")
+	}
+	for _, d := range fi.deliveries {
+		if d.status != "delivered" {
+			fi.t.Fatalf("delivery to %s is %s: %v", d.inbox, d.status, d.lastError)
+		}
+	}
+	fi.deliveries = nil
+}
+
+func (fi *fedInstance) timeline(token string) []RemotePost {
+	fi.t.Helper()
+	var posts []RemotePost
+	if err := json.Unmarshal(fi.do("GET", "/api/fediverse/timeline", token, nil, http.StatusOK), &posts); err != nil {
+		fi.t.Fatal(err)
+	}
+	return posts
+}
+
+func TestFederationBetweenInstances(t *testing.T) {
+	a, b := newFedInstance(t), newFedInstance(t)
+	alice, aliceToken := a.addUser("alice")
+	bob, bobToken := b.addUser("bob")
+
+	var follow RemoteFollow
+	err := json.Unmarshal(a.do("POST", "/api/fediverse/follows", aliceToken, map[string]string{"account": "bob@" + b.host}, http.StatusAccepted), &follow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if follow.ActorID != b.cfg.actorIRI(bob) || follow.Account != "bob@"+b.host || follow.Accepted {
+		t.Fatalf("follow = %+v", follow)
+	}
+
+	// the Follow reaches b, which records alice and answers with an Accept
+	a.deliver()
+	b.mu.Lock()
+	followers, notified := b.followers[bob.String()], b.notified
+	b.mu.Unlock()
+	if !slices.Equal(followers, []string{a.cfg.actorIRI(alice)}) || notified != 1 {
+		t.Fatalf("bob's followers = %v, %d notifications", followers, notified)
+	}
+	b.deliver()
+	a.mu.Lock()
+	accepted := a.follows[follow.ID.String()].acceptedAt != nil
+	a.mu.Unlock()
+	if !accepted {
+		t.Fatal("the Accept didn't mark the follow accepted")
+	}
+
+	var chirp struct {
+		ID uuid.UUID `json:"id"`
+	}
+	err = json.Unmarshal(b.do("POST", "/api/chirps", bobToken, map[string]string{"body": "hello from bob"}, http.StatusCreated), &chirp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.publish()
+	b.deliver()
+	posts := a.timeline(aliceToken)
+	if len(posts) != 1 {
+		t.Fatalf("alice's timeline = %+v", posts)
+	}
+	if posts[0].ID != b.cfg.noteIRI(chirp.ID) || posts[0].Account != "bob@"+b.host || posts[0].Content != "hello from bob" {
+		t.Errorf("remote post = %+v", posts[0])
+	}
+
+	b.do("DELETE", "/api/chirps/"+chirp.ID.String(), bobToken, nil, http.StatusNoContent)
+	b.publish()
+	b.deliver()
+	if posts := a.timeline(aliceToken); len(posts) != 0 {
+		t.Errorf("after the delete, alice's timeline = %+v", posts)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+	"main.go/internal/feed"
+	"main.go/internal/stream"
+)
+
+// feedSize is how many of the newest chirps a feed carries.
+const feedSize = 50
+
+// handlePattern matches the users.handle CHECK constraint.
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+func setHandle(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type paramBody struct {
+			Handle string `json:"handle"`
+		}
+		type respBody struct {
+			Handle string `json:"handle"`
+		}
+		userId, err := apiCfg.authorize(r, auth.ScopeProfileWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		params := paramBody{}
+		err = json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		handle := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(params.Handle), "@"))
+		if !handlePattern.MatchString(handle) {
+			respondWithError(w, http.StatusBadRequest, "Handles are 3 to 30 letters, digits or underscores")
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		user, err := qtx.SetUserHandle(r.Context(), databases.SetUserHandleParams{
+			Handle: sql.NullString{String: handle, Valid: true},
+			ID:     userId,
+		})
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Handle is already taken")
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = recordEvent(r.Context(), qtx, eventUserUpdated, userUpdatedEvent(user, "handle"))
+		if err != nil {
+			log.Printf("Error recording event: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		apiCfg.events.Notify()
+		respondWithJSON(w, http.StatusOK, respBody{Handle: handle})
+	}
+}
+
+// feedFormats maps the file extension in a feed URL to its renderer.
+var feedFormats = map[string]struct {
+	contentType string
+	render      func(feed.Feed) ([]byte, error)
+}{
+	"atom": {"application/atom+xml; charset=utf-8", feed.Feed.Atom},
+	"rss":  {"application/rss+xml; charset=utf-8", feed.Feed.RSS},
+}
+
+func (cfg *apiConfig) chirpEntry(id uuid.UUID, body, author string, createdAt, updatedAt time.Time) feed.Entry {
+	return feed.Entry{
+		ID:        "urn:uuid:" + id.String(),
+		Title:     feedTitle(body),
+		URL:       cfg.baseURL + "/api/chirps/" + id.String(),
+		Content:   body,
+		Author:    author,
+		Published: createdAt,
+		Updated:   updatedAt,
+	}
+}
+
+// feedTitle is the chirp's first line, cut at a word boundary if long.
+func feedTitle(body string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	const maxLen = 60
+	if len([]rune(title)) <= maxLen {
+		return title
+	}
+	cut := string([]rune(title)[:maxLen])
+	if i := strings.LastIndexByte(cut, ' '); i > maxLen/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// serveFeed renders f in the format named by the URL. The ETag is a hash of
+// the document and Last-Modified is its newest entry, so feed readers
+// polling an unchanged feed get a 304.
+func serveFeed(w http.ResponseWriter, r *http.Request, f feed.Feed, format string) {
+	body, err := feedFormats[format].render(f)
+	if err != nil {
+		log.Printf("Error rendering feed: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", feedFormats[format].contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	http.ServeContent(w, r, "", f.LastModified(), bytes.NewReader(body))
+}
+
+func userFeed(apiCfg *apiConfig, format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handle := strings.ToLower(r.PathValue("handle"))
+		if !handlePattern.MatchString(handle) {
+			w.WriteHeader(404)
+			return
+		}
+		user, err := apiCfg.dbQueries.GetUserByHandle(r.Context(), sql.NullString{String: handle, Valid: true})
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		chirps, err := apiCfg.dbQueries.GetChirpsByUSer(r.Context(), user.ID)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		// oldest first; keep the newest feedSize, newest first
+		chirps = chirps[max(len(chirps)-feedSize, 0):]
+		slices.Reverse(chirps)
+
+		self := apiCfg.baseURL + "/users/" + handle + "/feed." + format
+		f := feed.Feed{
+			ID:          self,
+			Title:       "Chirps by @" + handle,
+			Description: "The latest chirps posted by @" + handle + " on Chirpy",
+			SelfURL:     self,
+			AltURL:      apiCfg.baseURL + "/api/chirps?author_id=" + user.ID.String(),
+			Author:      "@" + handle,
+			Updated:     user.CreatedAt,
+		}
+		for _, chirp := range chirps {
+			f.Entries = append(f.Entries, apiCfg.chirpEntry(chirp.ID, chirp.Body, "", chirp.CreatedAt, chirp.UpdatedAt))
+		}
+		serveFeed(w, r, f, format)
+	}
+}
+
+func tagFeed(apiCfg *apiConfig, format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag, ok := stream.ParseTag(r.PathValue("tag"))
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		chirps, err := apiCfg.dbQueries.GetChirpsByTag(r.Context(), databases.GetChirpsByTagParams{
+			Tag:   tag,
+			Limit: feedSize,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+
+		self := apiCfg.baseURL + "/tags/" + url.PathEscape(tag) + "/feed." + format
+		f := feed.Feed{
+			ID:          self,
+			Title:       "#" + tag + " on Chirpy",
+			Description: "The latest chirps tagged #" + tag,
+			SelfURL:     self,
+			AltURL:      self,
+			// an empty feed still needs a stable Last-Modified for caching
+			Updated: time.Unix(0, 0),
+		}
+		for _, chirp := range chirps {
+			// Atom needs an author on every entry; users without a handle
+			// are named by id
+			author := chirp.UserID.String()
+			if chirp.Handle.Valid {
+				author = "@" + chirp.Handle.String
+			}
+			f.Entries = append(f.Entries, apiCfg.chirpEntry(chirp.ID, chirp.Body, author, chirp.CreatedAt, chirp.UpdatedAt))
+		}
+		serveFeed(w, r, f, format)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+const (
+	eventUserFollowed   = "user.followed"
+	eventUserUnfollowed = "user.unfollowed"
+)
+
+// userFollowed is the payload of both follow events.
+type userFollowed struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+}
+
+func followUser(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authorize(r, auth.ScopeProfileWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		followeeId, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		if followeeId == userId {
+			respondWithError(w, http.StatusBadRequest, "You can't follow yourself")
+			return
+		}
+		_, err = apiCfg.dbQueries.GetUserById(r.Context(), followeeId)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		rows, err := qtx.FollowUser(r.Context(), databases.FollowUserParams{
+			FollowerID: userId,
+			FolloweeID: followeeId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			// already following; don't notify twice
+			w.WriteHeader(204)
+			return
+		}
+		err = recordEvent(r.Context(), qtx, eventUserFollowed, userFollowed{
+			FollowerID: userId,
+			FolloweeID: followeeId,
+		})
+		if err != nil {
+			log.Printf("Error recording event: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		apiCfg.events.Notify()
+		w.WriteHeader(204)
+	}
+}
+
+func unfollowUser(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authorize(r, auth.ScopeProfileWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		followeeId, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		rows, err := qtx.UnfollowUser(r.Context(), databases.UnfollowUserParams{
+			FollowerID: userId,
+			FolloweeID: followeeId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		err = recordEvent(r.Context(), qtx, eventUserUnfollowed, userFollowed{
+			FollowerID: userId,
+			FolloweeID: followeeId,
+		})
+		if err != nil {
+			log.Printf("Error recording event: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		apiCfg.events.Notify()
+		w.WriteHeader(204)
+	}
+}
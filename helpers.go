@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	auth "main.go/internal"
+)
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func respondWithError(w http.ResponseWriter, code int, msg string) {
+	type errStruct struct {
+		Error string `json:"error"`
+	}
+	respondWithJSON(w, code, errStruct{Error: msg})
+}
+
+var (
+	errTokenRevoked         = errors.New("token has been revoked")
+	errAuthUnavailable      = errors.New("authentication backend unavailable")
+	errInvalidPersonalToken = errors.New("unknown personal access token")
+	errInvalidStreamTicket  = errors.New("unknown or used stream ticket")
+	errSessionRequired      = errors.New("only session tokens can be used here")
+	errNoPassword           = errors.New("account has no password")
+)
+
+type insufficientScopeError struct {
+	scope string
+}
+
+func (e insufficientScopeError) Error() string {
+	return "token lacks the " + e.scope + " scope"
+}
+
+// principal is whoever a request acts for. Scopes is nil for the user's own
+// session JWT, which may do anything the user can; personal access tokens and
+// tokens issued to OAuth clients are limited to the scopes they were granted.
+type principal struct {
+	UserID uuid.UUID
+	Scopes []string
+}
+
+func (p principal) can(scope string) bool {
+	return p.Scopes == nil || auth.HasScope(p.Scopes, scope)
+}
+
+// authenticateClaims validates the request's bearer JWT and checks that it
+// hasn't been denylisted.
+func (cfg *apiConfig) authenticateClaims(r *http.Request) (*auth.AccessClaims, error) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.validateAccessToken(r.Context(), tokenString)
+}
+
+// validateAccessToken is authenticateClaims for a token that didn't come in
+// the Authorization header, such as one sent over an open WebSocket.
+func (cfg *apiConfig) validateAccessToken(ctx context.Context, tokenString string) (*auth.AccessClaims, error) {
+	if auth.IsPersonalAccessToken(tokenString) {
+		return nil, errSessionRequired
+	}
+	claims, err := auth.ValidateJWT(tokenString, cfg.jwtConfig)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := cfg.dbQueries.IsAccessTokenDenied(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+	}
+	if denied {
+		return nil, errTokenRevoked
+	}
+	// tokens issued to an OAuth client die with it
+	if claims.ClientID != "" {
+		clientId, err := uuid.Parse(claims.ClientID)
+		if err != nil {
+			return nil, errTokenRevoked
+		}
+		_, err = cfg.dbQueries.GetOAuthClient(ctx, clientId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errTokenRevoked
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+		}
+	}
+	// a revoked session takes its outstanding access tokens with it
+	if sessionId, err := uuid.Parse(claims.SessionID); err == nil {
+		active, err := cfg.dbQueries.IsSessionActive(ctx, sessionId)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+		}
+		if !active {
+			return nil, errTokenRevoked
+		}
+		err = cfg.dbQueries.TouchSession(ctx, sessionId)
+		if err != nil {
+			log.Printf("Error recording session use: %s", err)
+		}
+	}
+	return claims, nil
+}
+
+// authenticateSession is authenticateClaims restricted to the user's own
+// session tokens, refusing tokens issued to OAuth clients.
+func (cfg *apiConfig) authenticateSession(r *http.Request) (*auth.AccessClaims, error) {
+	claims, err := cfg.authenticateClaims(r)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ClientID != "" {
+		return nil, errSessionRequired
+	}
+	return claims, nil
+}
+
+// authenticate returns the user id carried by the request's bearer JWT.
+// Only session tokens are accepted; see authorize for endpoints that bots
+// and OAuth clients may call.
+func (cfg *apiConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	claims, err := cfg.authenticateSession(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+// authenticatePrincipal accepts a session JWT, an OAuth client's JWT or a
+// personal access token sent as the bearer token.
+func (cfg *apiConfig) authenticatePrincipal(r *http.Request) (principal, error) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+	if !auth.IsPersonalAccessToken(tokenString) {
+		claims, err := cfg.authenticateClaims(r)
+		if err != nil {
+			return principal{}, err
+		}
+		userId, err := claims.UserID()
+		return principal{UserID: userId, Scopes: claims.Scopes()}, err
+	}
+	pat, err := cfg.dbQueries.GetPersonalAccessToken(r.Context(), auth.HashToken(tokenString))
+	if errors.Is(err, sql.ErrNoRows) {
+		return principal{}, errInvalidPersonalToken
+	}
+	if err != nil {
+		return principal{}, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+	}
+	if pat.RevokedAt.Valid {
+		return principal{}, errTokenRevoked
+	}
+	if pat.ExpiresAt.Valid && pat.ExpiresAt.Time.Before(time.Now()) {
+		return principal{}, auth.ErrTokenExpired
+	}
+	err = cfg.dbQueries.TouchPersonalAccessToken(r.Context(), pat.ID)
+	if err != nil {
+		log.Printf("Error recording token use: %s", err)
+	}
+	return principal{UserID: pat.UserID, Scopes: strings.Fields(pat.Scopes)}, nil
+}
+
+// authorize authenticates the request and checks that it may act with scope.
+func (cfg *apiConfig) authorize(r *http.Request, scope string) (uuid.UUID, error) {
+	p, err := cfg.authenticatePrincipal(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !p.can(scope) {
+		return uuid.Nil, insufficientScopeError{scope: scope}
+	}
+	return p.UserID, nil
+}
+
+// respondWithAuthError turns an authenticate error into a 401 whose
+// WWW-Authenticate header says why the token was refused (RFC 6750).
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errAuthUnavailable) {
+		log.Printf("Error authenticating request: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	var scopeErr insufficientScopeError
+	if errors.As(err, &scopeErr) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="insufficient_scope", scope=%q`, scopeErr.scope))
+		respondWithError(w, http.StatusForbidden, "Token lacks the "+scopeErr.scope+" scope")
+		return
+	}
+	if errors.Is(err, errSessionRequired) {
+		respondWithError(w, http.StatusForbidden, "Only session tokens can be used here")
+		return
+	}
+	var description string
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		description = "Token expired"
+	case errors.Is(err, auth.ErrTokenMalformed):
+		description = "Malformed token"
+	case errors.Is(err, auth.ErrTokenSignature):
+		description = "Invalid token signature"
+	case errors.Is(err, auth.ErrTokenClaims):
+		description = "Invalid token claims"
+	case errors.Is(err, errTokenRevoked):
+		description = "Token revoked"
+	case errors.Is(err, errInvalidPersonalToken):
+		description = "Invalid token"
+	case errors.Is(err, errInvalidStreamTicket):
+		description = "Invalid or used stream ticket"
+	default:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+		respondWithError(w, http.StatusUnauthorized, "Missing or malformed authorization header")
+		return
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="invalid_token", error_description=%q`, description))
+	respondWithError(w, http.StatusUnauthorized, description)
+}
+
+// isAdmin checks an "Authorization: ApiKey <key>" header against
+// ADMIN_API_KEY. Admin endpoints are closed while no key is configured.
+func (cfg *apiConfig) isAdmin(r *http.Request) bool {
+	if cfg.adminAPIKey == "" {
+		return false
+	}
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(cfg.adminAPIKey)) == 1
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// clientIP returns the address of the caller. X-Forwarded-For is only
+// honoured when TRUST_PROXY is set, and then only the hop added by our proxy.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// runPeriodically runs job every interval until ctx is cancelled. Failures
+// are logged and retried on the next tick.
+func runPeriodically(ctx context.Context, interval time.Duration, name string, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := job(ctx)
+			if err != nil {
+				log.Printf("Error running %s: %s", name, err)
+			}
+		}
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
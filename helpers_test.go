@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+)
+
+// captureLog sends the standard logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+	return &buf
+}
+
+func TestPersonalAccessTokenNotLogged(t *testing.T) {
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId := uuid.New()
+	db := newFakeDB()
+	db.on("GetPersonalAccessToken", func(args []driver.Value) (fakeResult, error) {
+		if args[0] != auth.HashToken(token) {
+			return fakeTable(), nil
+		}
+		now := time.Now()
+		return fakeTable([]driver.Value{uuid.NewString(), now, userId.String(), "bot", args[0], auth.ScopeChirpsRead, nil, nil, nil}), nil
+	})
+	db.on("TouchPersonalAccessToken", fakeExec(1))
+	cfg := &apiConfig{}
+	cfg.db, cfg.dbQueries = db.open()
+	logs := captureLog(t)
+
+	r := httptest.NewRequest("GET", "/api/chirps", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if got, ok := cfg.rateLimitUser(r); !ok || got != userId {
+		t.Errorf("rate limit user = %s, %v", got, ok)
+	}
+	got, err := cfg.authorize(r, auth.ScopeChirpsRead)
+	if err != nil || got != userId {
+		t.Fatalf("authorize = %s, %v", got, err)
+	}
+	if strings.Contains(logs.String(), strings.TrimPrefix(token, auth.PersonalTokenPrefix)) {
+		t.Errorf("the token was logged: %s", logs)
+	}
+}
+
+func TestRevokedSessionToken(t *testing.T) {
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	revoked := map[string]bool{}
+	db := newFakeDB()
+	db.on("IsAccessTokenDenied", fakeValue(false))
+	db.on("TouchSession", fakeExec(1))
+	db.on("IsSessionActive", func(args []driver.Value) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return fakeValue(!revoked[args[0].(string)])(nil)
+	})
+	db.on("RevokeUserTokenFamily", func(args []driver.Value) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		revoked[args[0].(string)] = true
+		return fakeExec(1)(nil)
+	})
+	db.on("ListActiveSessions", func([]driver.Value) (fakeResult, error) { return fakeTable(), nil })
+	cfg := &apiConfig{jwtConfig: auth.JWTConfig{Keys: auth.NewKeySet(key), Issuer: "chirpy", Audience: "chirpy"}}
+	cfg.db, cfg.dbQueries = db.open()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sessions", listSessions(cfg))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", revokeSession(cfg))
+
+	userId, here, there := uuid.New(), uuid.New(), uuid.New()
+	token := func(sessionId uuid.UUID) string {
+		token, err := auth.MakeSessionJWT(userId, sessionId, cfg.jwtConfig, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	do := func(method, path, token string) int {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+	hereToken, thereToken := token(here), token(there)
+	if code := do("GET", "/api/sessions", thereToken); code != http.StatusOK {
+		t.Fatalf("before revoking, got %d", code)
+	}
+	if code := do("DELETE", "/api/sessions/"+there.String(), hereToken); code != http.StatusNoContent {
+		t.Fatalf("revoking got %d", code)
+	}
+	if code := do("GET", "/api/sessions", thereToken); code != http.StatusUnauthorized {
+		t.Errorf("the revoked session's token got %d", code)
+	}
+	if code := do("GET", "/api/sessions", hereToken); code != http.StatusOK {
+		t.Errorf("the other session's token got %d", code)
+	}
+}
@@ -0,0 +1,202 @@
+// Package activitypub holds the ActivityPub vocabulary Chirpy federates
+// with, WebFinger lookups, HTTP Signatures and a client for talking to
+// other servers.
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// ContentType is what actors, objects and activities are served as.
+	ContentType = "application/activity+json"
+	// ldContentType is the other media type servers use for them.
+	ldContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+	acceptHeader  = ContentType + ", " + ldContentType
+	// JRDContentType is the WebFinger response type.
+	JRDContentType = "application/jrd+json"
+
+	// Public addresses an object to everyone.
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// Context is the JSON-LD context of documents we serve. The security
+// vocabulary defines publicKey.
+var Context = []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type Actor struct {
+	Context           any        `json:"@context,omitempty"`
+	ID                string     `json:"id"`
+	Type              string     `json:"type"`
+	PreferredUsername string     `json:"preferredUsername"`
+	Name              string     `json:"name,omitempty"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox,omitempty"`
+	Followers         string     `json:"followers,omitempty"`
+	Endpoints         *Endpoints `json:"endpoints,omitempty"`
+	PublicKey         PublicKey  `json:"publicKey"`
+	Published         *time.Time `json:"published,omitempty"`
+}
+
+// SharedInbox is where activities for several of the actor's followers on
+// one server can be sent once.
+func (a Actor) SharedInbox() string {
+	if a.Endpoints != nil && a.Endpoints.SharedInbox != "" {
+		return a.Endpoints.SharedInbox
+	}
+	return a.Inbox
+}
+
+// Audience is a to or cc list. Servers send a single address as a bare
+// string.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if json.Unmarshal(data, &one) == nil {
+		*a = Audience{one}
+		return nil
+	}
+	var many []string
+	err := json.Unmarshal(data, &many)
+	*a = many
+	return err
+}
+
+type Activity struct {
+	Context   any             `json:"@context,omitempty"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Object    json.RawMessage `json:"object"`
+	To        Audience        `json:"to,omitempty"`
+	Cc        Audience        `json:"cc,omitempty"`
+	Published *time.Time      `json:"published,omitempty"`
+}
+
+// NewActivity wraps object, which may be an id or a document to embed, in
+// an activity.
+func NewActivity(id, activityType, actor string, object any) (Activity, error) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return Activity{}, err
+	}
+	return Activity{Context: Context, ID: id, Type: activityType, Actor: actor, Object: raw}, nil
+}
+
+// ObjectID is the id of the activity's object, which may be embedded or
+// given by reference.
+func (a Activity) ObjectID() string {
+	var id string
+	if json.Unmarshal(a.Object, &id) == nil {
+		return id
+	}
+	var object struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(a.Object, &object)
+	return object.ID
+}
+
+// ObjectType is the type of an embedded object, or "" for a reference.
+func (a Activity) ObjectType() string {
+	var object struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(a.Object, &object)
+	return object.Type
+}
+
+type Tag struct {
+	Type string `json:"type"`
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type Note struct {
+	Context      any        `json:"@context,omitempty"`
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	AttributedTo string     `json:"attributedTo"`
+	Content      string     `json:"content"`
+	URL          string     `json:"url,omitempty"`
+	InReplyTo    string     `json:"inReplyTo,omitempty"`
+	Published    time.Time  `json:"published"`
+	Updated      *time.Time `json:"updated,omitempty"`
+	To           Audience   `json:"to,omitempty"`
+	Cc           Audience   `json:"cc,omitempty"`
+	Tag          []Tag      `json:"tag,omitempty"`
+}
+
+type Tombstone struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type OrderedCollection struct {
+	Context      any    `json:"@context,omitempty"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	TotalItems   int    `json:"totalItems"`
+	OrderedItems []any  `json:"orderedItems,omitempty"`
+}
+
+// HTML turns a plain-text chirp into Note content.
+func HTML(text string) string {
+	escaped := html.EscapeString(strings.TrimSpace(text))
+	return "<p>" + strings.ReplaceAll(escaped, "\n", "<br>") + "</p>"
+}
+
+var (
+	lineBreak = regexp.MustCompile(`(?i)<br\s*/?>|</p>\s*<p[^>]*>`)
+	anyTag    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// PlainText reduces the HTML content of a remote note to text, keeping
+// line and paragraph breaks as newlines.
+func PlainText(content string) string {
+	text := lineBreak.ReplaceAllString(content, "\n")
+	text = anyTag.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// JRD is a WebFinger response (RFC 7033).
+type JRD struct {
+	Subject string   `json:"subject"`
+	Aliases []string `json:"aliases,omitempty"`
+	Links   []Link   `json:"links"`
+}
+
+type Link struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+var ErrBadAccount = errors.New("account must look like user@example.com")
+
+// ParseAccount splits "user@host", "@user@host" or "acct:user@host".
+func ParseAccount(account string) (user, host string, err error) {
+	account = strings.TrimPrefix(strings.TrimSpace(account), "acct:")
+	account = strings.TrimPrefix(account, "@")
+	user, host, ok := strings.Cut(account, "@")
+	if !ok || user == "" || host == "" || strings.ContainsAny(host, "@/?#") {
+		return "", "", ErrBadAccount
+	}
+	return user, strings.ToLower(host), nil
+}
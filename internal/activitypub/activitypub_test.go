@@ -0,0 +1,236 @@
+package activitypub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) (privatePEM, publicPEM string) {
+	t.Helper()
+	privatePEM, publicPEM, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privatePEM, publicPEM
+}
+
+func signedRequest(t *testing.T, privatePEM string, body []byte, now time.Time) *http.Request {
+	t.Helper()
+	key, err := ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "https://chirpy.example/ap/inbox?x=1", strings.NewReader(string(body)))
+	err = Sign(req, "https://remote.example/users/ada#main-key", key, body, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignatureRoundTrip(t *testing.T) {
+	privatePEM, publicPEM := testKey(t)
+	pub, err := ParsePublicKey(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	body := []byte(`{"type":"Follow"}`)
+
+	req := signedRequest(t, privatePEM, body, now)
+	sig, err := ParseSignature(req.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.KeyID != "https://remote.example/users/ada#main-key" || KeyOwner(sig.KeyID) != "https://remote.example/users/ada" {
+		t.Errorf("key id = %q", sig.KeyID)
+	}
+	if err := sig.Verify(req, body, pub, now); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	if err := sig.Verify(req, []byte(`{"type":"Block"}`), pub, now); err == nil {
+		t.Error("a changed body verified")
+	}
+	moved := req.Clone(context.Background())
+	moved.URL.Path = "/ap/users/someone/inbox"
+	if err := sig.Verify(moved, body, pub, now); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("a changed target = %v, want ErrBadSignature", err)
+	}
+	if err := sig.Verify(req, body, pub, now.Add(2*MaxClockSkew)); err == nil {
+		t.Error("a stale signature verified")
+	}
+	_, otherPEM := testKey(t)
+	other, _ := ParsePublicKey(otherPEM)
+	if err := sig.Verify(req, body, other, now); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("another key = %v, want ErrBadSignature", err)
+	}
+
+	narrow := sig
+	narrow.Headers = []string{"(request-target)", "host", "date"}
+	if err := narrow.Verify(req, body, pub, now); err == nil {
+		t.Error("a signature without the digest verified a body")
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	h := http.Header{}
+	if _, err := ParseSignature(h); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("unsigned = %v", err)
+	}
+	h.Set("Signature", `keyId="https://a.example/u#k", algorithm="hs2019", headers="(request-target) Host Date", signature="c2ln"`)
+	sig, err := ParseSignature(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Algorithm != "hs2019" || strings.Join(sig.Headers, " ") != "(request-target) host date" || string(sig.Value) != "sig" {
+		t.Errorf("parsed %+v", sig)
+	}
+	for _, bad := range []string{`keyId=https://a`, `keyId="k",signature="!!"`, `signature="c2ln"`, `keyId="k`} {
+		h.Set("Signature", bad)
+		if _, err := ParseSignature(h); err == nil {
+			t.Errorf("ParseSignature(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestVocabulary(t *testing.T) {
+	var a Activity
+	err := json.Unmarshal([]byte(`{"type":"Undo","to":"https://www.w3.org/ns/activitystreams#Public","cc":["x","y"],
+		"object":{"id":"https://r.example/follows/1","type":"Follow"}}`), &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.To) != 1 || a.To[0] != Public || len(a.Cc) != 2 {
+		t.Errorf("audience = %v %v", a.To, a.Cc)
+	}
+	if a.ObjectID() != "https://r.example/follows/1" || a.ObjectType() != "Follow" {
+		t.Errorf("embedded object = %s %s", a.ObjectID(), a.ObjectType())
+	}
+	a.Object = json.RawMessage(`"https://r.example/notes/2"`)
+	if a.ObjectID() != "https://r.example/notes/2" || a.ObjectType() != "" {
+		t.Errorf("referenced object = %s %s", a.ObjectID(), a.ObjectType())
+	}
+
+	if got := HTML("fish & <chips>\nyes"); got != "<p>fish &amp; &lt;chips&gt;<br>yes</p>" {
+		t.Errorf("HTML() = %q", got)
+	}
+	content := `<p>Hi <span class="h-card"><a href="https://c.example/@ada">@<span>ada</span></a></span> &amp; all</p><p>second<br/>line</p>`
+	if got := PlainText(content); got != "Hi @ada & all\nsecond\nline" {
+		t.Errorf("PlainText() = %q", got)
+	}
+}
+
+func TestParseAccount(t *testing.T) {
+	for _, in := range []string{"ada@Remote.example", "@ada@remote.example", "acct:ada@remote.example"} {
+		user, host, err := ParseAccount(in)
+		if err != nil || user != "ada" || host != "remote.example" {
+			t.Errorf("ParseAccount(%q) = %q, %q, %v", in, user, host, err)
+		}
+	}
+	for _, bad := range []string{"ada", "@ada", "ada@", "ada@host/path", "ada@a@b"} {
+		if _, _, err := ParseAccount(bad); err == nil {
+			t.Errorf("ParseAccount(%q) succeeded", bad)
+		}
+	}
+}
+
+// remoteServer is another instance with one actor, ada, whose inbox checks
+// signatures against the key given to it.
+func remoteServer(t *testing.T, inboxKey func() string, received chan<- string) *httptest.Server {
+	t.Helper()
+	_, publicPEM := testKey(t)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actorID := srv.URL + "/users/ada"
+		switch r.URL.Path {
+		case "/.well-known/webfinger":
+			if r.URL.Query().Get("resource") != "acct:ada@"+r.Host {
+				w.WriteHeader(404)
+				return
+			}
+			json.NewEncoder(w).Encode(JRD{
+				Subject: "acct:ada@" + r.Host,
+				Links:   []Link{{Rel: "self", Type: ContentType, Href: actorID}},
+			})
+		case "/users/ada":
+			json.NewEncoder(w).Encode(Actor{
+				Context:   Context,
+				ID:        actorID,
+				Type:      "Person",
+				Inbox:     actorID + "/inbox",
+				PublicKey: PublicKey{ID: actorID + "#main-key", Owner: actorID, PublicKeyPem: publicPEM},
+			})
+		case "/users/impostor":
+			json.NewEncoder(w).Encode(Actor{ID: actorID, Inbox: actorID + "/inbox"})
+		case "/users/ada/inbox":
+			body, _ := io.ReadAll(r.Body)
+			sig, err := ParseSignature(r.Header)
+			if err == nil {
+				pub, _ := ParsePublicKey(inboxKey())
+				err = sig.Verify(r, body, pub, time.Now())
+			}
+			if err != nil {
+				w.WriteHeader(401)
+				return
+			}
+			received <- string(body)
+			w.WriteHeader(202)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	senderPrivate, senderPublic := testKey(t)
+	received := make(chan string, 1)
+	srv := remoteServer(t, func() string { return senderPublic }, received)
+	account := "ada@" + strings.TrimPrefix(srv.URL, "http://")
+	ctx := context.Background()
+
+	c := NewClient("chirpy-test", true)
+	actorID, err := c.Finger(ctx, account)
+	if err != nil || actorID != srv.URL+"/users/ada" {
+		t.Fatalf("Finger() = %q, %v", actorID, err)
+	}
+	actor, err := c.FetchActor(ctx, actorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actor.SharedInbox() != actorID+"/inbox" {
+		t.Errorf("shared inbox = %q", actor.SharedInbox())
+	}
+	if _, err := c.FetchActor(ctx, srv.URL+"/users/impostor"); err == nil {
+		t.Error("an actor document with another id was accepted")
+	}
+
+	key, _ := ParsePrivateKey(senderPrivate)
+	body := []byte(`{"type":"Follow"}`)
+	status, err := c.Deliver(ctx, actor.Inbox, body, "https://chirpy.example/ap/users/1#main-key", key)
+	if err != nil || status != 202 {
+		t.Fatalf("Deliver() = %d, %v", status, err)
+	}
+	if got := <-received; got != string(body) {
+		t.Errorf("inbox got %s", got)
+	}
+	_, wrongKey := testKey(t)
+	senderPublic = wrongKey
+	if status, err := c.Deliver(ctx, actor.Inbox, body, "k", key); err == nil || status != 401 {
+		t.Errorf("delivery signed with an unknown key = %d, %v", status, err)
+	}
+
+	strict := NewClient("chirpy-test", false)
+	if _, err := strict.FetchActor(ctx, actorID); !errors.Is(err, errLocalAddress) {
+		t.Errorf("fetching from loopback = %v, want errLocalAddress", err)
+	}
+}
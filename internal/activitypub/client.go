@@ -0,0 +1,166 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxDocumentSize caps what we read from another server.
+const maxDocumentSize = 1 << 20
+
+var errLocalAddress = errors.New("refusing to connect to a local address")
+
+// Client fetches documents from and delivers activities to other servers.
+type Client struct {
+	HTTP *http.Client
+	// Scheme is used for WebFinger lookups, which only have a host to go on.
+	Scheme    string
+	UserAgent string
+}
+
+// NewClient returns a client that refuses to connect to loopback, private
+// and link-local addresses, since the URLs it fetches come from other
+// servers. allowLocal lifts that and looks accounts up over plain http, for
+// federating between instances on one machine or network.
+func NewClient(userAgent string, allowLocal bool) *Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	scheme := "http"
+	if !allowLocal {
+		scheme = "https"
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+				return errLocalAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &Client{
+		HTTP:      &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		Scheme:    scheme,
+		UserAgent: userAgent,
+	}
+}
+
+func (c *Client) get(ctx context.Context, target, accept string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(v)
+}
+
+// Finger resolves an account such as "user@example.com" to its actor id.
+func (c *Client) Finger(ctx context.Context, account string) (string, error) {
+	user, host, err := ParseAccount(account)
+	if err != nil {
+		return "", err
+	}
+	target := (&url.URL{
+		Scheme:   c.Scheme,
+		Host:     host,
+		Path:     "/.well-known/webfinger",
+		RawQuery: url.Values{"resource": {"acct:" + user + "@" + host}}.Encode(),
+	}).String()
+	var jrd JRD
+	err = c.get(ctx, target, JRDContentType, &jrd)
+	if err != nil {
+		return "", err
+	}
+	for _, link := range jrd.Links {
+		if link.Rel == "self" && (link.Type == ContentType || link.Type == ldContentType) {
+			return link.Href, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no ActivityPub actor", account)
+}
+
+// FetchActor gets the actor document at id. The document must say it is
+// id, and its key must belong to it, or any server could speak for actors
+// on another.
+func (c *Client) FetchActor(ctx context.Context, id string) (Actor, error) {
+	var actor Actor
+	err := c.get(ctx, id, acceptHeader, &actor)
+	if err != nil {
+		return Actor{}, err
+	}
+	if actor.ID != id {
+		return Actor{}, fmt.Errorf("document at %s is %s", id, actor.ID)
+	}
+	if actor.Inbox == "" || actor.PublicKey.PublicKeyPem == "" || actor.PublicKey.Owner != actor.ID {
+		return Actor{}, fmt.Errorf("%s is not an actor we can federate with", id)
+	}
+	if !SameHost(actor.ID, actor.PublicKey.ID, actor.Inbox) {
+		return Actor{}, fmt.Errorf("%s names a key or inbox on another host", id)
+	}
+	return actor, nil
+}
+
+// SameHost reports whether every URL is on id's host, as the objects an
+// actor sends about itself must be.
+func SameHost(id string, others ...string) bool {
+	u, err := url.Parse(id)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, other := range others {
+		o, err := url.Parse(other)
+		if err != nil || o.Host != u.Host {
+			return false
+		}
+	}
+	return true
+}
+
+// Deliver posts an activity to an inbox, signed with the sending actor's
+// key. It returns the status code when the server answered.
+func (c *Client) Deliver(ctx context.Context, inbox string, body []byte, keyID string, key *rsa.PrivateKey) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("User-Agent", c.UserAgent)
+	err = Sign(req, keyID, key, body, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("inbox answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,234 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HTTP Signatures as the fediverse uses them: draft-cavage-http-signatures
+// with rsa-sha256 over (request-target), host, date and, for requests with
+// a body, a SHA-256 digest header.
+
+var (
+	ErrNoSignature  = errors.New("request is not signed")
+	ErrBadSignature = errors.New("signature does not verify")
+)
+
+// MaxClockSkew is how far a signed Date may be from our clock.
+const MaxClockSkew = time.Hour
+
+// GenerateKey makes an actor's key pair, PEM encoded.
+func GenerateKey() (privatePEM, publicPEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	privatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	publicPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return privatePEM, publicPEM, nil
+}
+
+func ParsePrivateKey(privatePEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("no PEM data in private key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// ParsePublicKey reads the publicKeyPem of an actor, which is PKIX or,
+// from some servers, PKCS #1.
+func ParsePublicKey(publicPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicPEM))
+	if block == nil {
+		return nil, errors.New("no PEM data in public key")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+	return rsaKey, nil
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// signingString builds the text that is signed from the named headers.
+func signingString(req *http.Request, headers []string) (string, error) {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		var value string
+		switch h {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			value = requestHost(req)
+		default:
+			if strings.HasPrefix(h, "(") {
+				return "", fmt.Errorf("unsupported signature parameter %s", h)
+			}
+			values := req.Header.Values(h)
+			if len(values) == 0 {
+				return "", fmt.Errorf("signed header %s is missing", h)
+			}
+			value = strings.Join(values, ", ")
+		}
+		lines = append(lines, h+": "+value)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Sign adds Date, Digest (when there is a body) and Signature headers to
+// req. keyID is the id of the actor's publicKey.
+func Sign(req *http.Request, keyID string, key *rsa.PrivateKey, body []byte, now time.Time) error {
+	headers := []string{"(request-target)", "host", "date"}
+	req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	if body != nil {
+		req.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+	text, err := signingString(req, headers)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(text))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId=%q,algorithm="rsa-sha256",headers=%q,signature=%q`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+type Signature struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Value     []byte
+}
+
+// ParseSignature reads the request's Signature header.
+func ParseSignature(header http.Header) (Signature, error) {
+	raw := header.Get("Signature")
+	if raw == "" {
+		return Signature{}, ErrNoSignature
+	}
+	params := map[string]string{}
+	for raw != "" {
+		name, rest, ok := strings.Cut(raw, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return Signature{}, errors.New("malformed Signature header")
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return Signature{}, errors.New("malformed Signature header")
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = rest[1 : end+1]
+		raw = strings.TrimLeft(rest[end+2:], ", ")
+	}
+	sig := Signature{
+		KeyID:     params["keyid"],
+		Algorithm: params["algorithm"],
+		Headers:   strings.Fields(strings.ToLower(params["headers"])),
+	}
+	if len(sig.Headers) == 0 {
+		sig.Headers = []string{"date"}
+	}
+	value, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil || sig.KeyID == "" || len(value) == 0 {
+		return Signature{}, errors.New("malformed Signature header")
+	}
+	sig.Value = value
+	return sig, nil
+}
+
+// Verify checks sig, parsed from req, against key. The signature must
+// cover the request target, host and date, and the digest of body when
+// there is one, and the date must be within MaxClockSkew of now.
+func (sig Signature) Verify(req *http.Request, body []byte, key *rsa.PublicKey, now time.Time) error {
+	switch sig.Algorithm {
+	case "", "rsa-sha256", "hs2019":
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	required := []string{"(request-target)", "host", "date"}
+	if len(body) > 0 {
+		required = append(required, "digest")
+	}
+	for _, h := range required {
+		if !slices.Contains(sig.Headers, h) {
+			return fmt.Errorf("signature does not cover %s", h)
+		}
+	}
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return errors.New("bad date header")
+	}
+	if skew := now.Sub(date); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("date is %s away from now", skew.Round(time.Second))
+	}
+	if len(body) > 0 {
+		// only SHA-256 is sent in practice; other algorithms can't be
+		// checked and so don't count
+		ok := false
+		for _, d := range strings.Split(req.Header.Get("Digest"), ",") {
+			d = strings.TrimSpace(d)
+			if algo, _, _ := strings.Cut(d, "="); strings.EqualFold(algo, "SHA-256") {
+				ok = subtle.ConstantTimeCompare([]byte("SHA-256"+d[len(algo):]), []byte(digest(body))) == 1
+				break
+			}
+		}
+		if !ok {
+			return errors.New("digest does not match the body")
+		}
+	}
+	text, err := signingString(req, sig.Headers)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(text))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig.Value) != nil {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// KeyOwner strips the fragment from a key id, which for every common server
+// leaves the URL of the actor document.
+func KeyOwner(keyID string) string {
+	owner, _, _ := strings.Cut(keyID, "#")
+	return owner
+}
@@ -0,0 +1,221 @@
+// Package analytics counts site visits in daily buckets. Visits are
+// aggregated in memory and flushed to the database now and then, so every
+// instance adds to the same numbers. Unique visitors are estimated with a
+// HyperLogLog sketch per bucket, which merges across instances and across
+// days without storing who visited.
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// precision is the number of hash bits that pick a register. 4096
+// registers keep a bucket's sketch at 4KB with about 1.6% error.
+const precision = 12
+
+const registers = 1 << precision
+
+// Sketch is a HyperLogLog estimate of how many distinct visitors were seen.
+type Sketch struct {
+	registers [registers]uint8
+}
+
+// ParseSketch reads a sketch stored by Bytes. An empty slice is an empty
+// sketch.
+func ParseSketch(b []byte) (*Sketch, error) {
+	s := &Sketch{}
+	if len(b) == 0 {
+		return s, nil
+	}
+	if len(b) != registers {
+		return nil, fmt.Errorf("sketch has %d registers, want %d", len(b), registers)
+	}
+	copy(s.registers[:], b)
+	return s, nil
+}
+
+func (s *Sketch) Bytes() []byte {
+	return append([]byte(nil), s.registers[:]...)
+}
+
+// Add records a visitor, identified by any string that is stable for them.
+func (s *Sketch) Add(visitor string) {
+	sum := sha256.Sum256([]byte(visitor))
+	x := binary.BigEndian.Uint64(sum[:8])
+	i := x >> (64 - precision)
+	// the guard bit caps the run of zeros when the rest of x is all zero
+	rank := uint8(bits.LeadingZeros64(x<<precision|1<<(precision-1))) + 1
+	if rank > s.registers[i] {
+		s.registers[i] = rank
+	}
+}
+
+// Merge folds other into s, which then estimates the union of both.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+}
+
+func (s *Sketch) Estimate() int64 {
+	var sum float64
+	zeros := 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	const m = float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small counts leave registers empty; linear counting is better there
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// Bucket is one day of visits, starting at midnight UTC.
+type Bucket struct {
+	Start    time.Time
+	Visits   int64
+	Visitors *Sketch
+}
+
+func Day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Counter holds the visits this instance hasn't flushed yet.
+type Counter struct {
+	mu      sync.Mutex
+	pending map[time.Time]*Bucket
+}
+
+func NewCounter() *Counter {
+	return &Counter{pending: make(map[time.Time]*Bucket)}
+}
+
+func (c *Counter) Record(at time.Time, visitor string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.bucket(Day(at))
+	b.Visits++
+	b.Visitors.Add(visitor)
+}
+
+func (c *Counter) bucket(day time.Time) *Bucket {
+	b, ok := c.pending[day]
+	if !ok {
+		b = &Bucket{Start: day, Visitors: &Sketch{}}
+		c.pending[day] = b
+	}
+	return b
+}
+
+// Take removes and returns the pending buckets for flushing.
+func (c *Counter) Take() []Bucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buckets := make([]Bucket, 0, len(c.pending))
+	for _, b := range c.pending {
+		buckets = append(buckets, *b)
+	}
+	clear(c.pending)
+	return buckets
+}
+
+// Put returns buckets that could not be flushed, merging them with visits
+// recorded since.
+func (c *Counter) Put(buckets []Bucket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, unflushed := range buckets {
+		b := c.bucket(unflushed.Start)
+		b.Visits += unflushed.Visits
+		b.Visitors.Merge(unflushed.Visitors)
+	}
+}
+
+// Reset drops the pending visits.
+func (c *Counter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.pending)
+}
+
+type Period string
+
+const (
+	Daily   Period = "daily"
+	Weekly  Period = "weekly"
+	Monthly Period = "monthly"
+)
+
+// Start is the beginning of the period containing t. Weeks start on
+// Monday.
+func (p Period) Start(t time.Time) time.Time {
+	day := Day(t)
+	switch p {
+	case Weekly:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case Monthly:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
+type Point struct {
+	Start          time.Time `json:"start"`
+	Visits         int64     `json:"visits"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+}
+
+// Series adds the buckets up by period for the n periods ending with the
+// one containing now, oldest first. Periods without visits are zero.
+func Series(buckets []Bucket, period Period, n int, now time.Time) []Point {
+	starts := make([]time.Time, n)
+	start := period.Start(now)
+	for i := n - 1; i >= 0; i-- {
+		starts[i] = start
+		start = period.Start(start.AddDate(0, 0, -1))
+	}
+	index := make(map[time.Time]int, n)
+	sketches := make([]Sketch, n)
+	points := make([]Point, n)
+	for i, start := range starts {
+		index[start] = i
+		points[i].Start = start
+	}
+	for _, b := range buckets {
+		i, ok := index[period.Start(b.Start)]
+		if !ok {
+			continue
+		}
+		points[i].Visits += b.Visits
+		sketches[i].Merge(b.Visitors)
+	}
+	for i := range points {
+		points[i].UniqueVisitors = sketches[i].Estimate()
+	}
+	return points
+}
+
+// Since is the first day Series needs for n periods ending now.
+func Since(period Period, n int, now time.Time) time.Time {
+	start := period.Start(now)
+	for i := 1; i < n; i++ {
+		start = period.Start(start.AddDate(0, 0, -1))
+	}
+	return start
+}
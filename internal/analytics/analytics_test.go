@@ -0,0 +1,161 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func within(got, want int64, tolerance float64) bool {
+	return math.Abs(float64(got-want)) <= tolerance*float64(want)
+}
+
+func TestSketch(t *testing.T) {
+	var s Sketch
+	if got := s.Estimate(); got != 0 {
+		t.Errorf("empty estimate = %d", got)
+	}
+	for i := 0; i < 3; i++ {
+		s.Add("alone")
+	}
+	if got := s.Estimate(); got != 1 {
+		t.Errorf("one visitor seen three times = %d", got)
+	}
+
+	for _, n := range []int64{100, 10_000, 200_000} {
+		var s Sketch
+		for i := int64(0); i < n; i++ {
+			s.Add(fmt.Sprintf("visitor-%d", i))
+			s.Add(fmt.Sprintf("visitor-%d", i))
+		}
+		if got := s.Estimate(); !within(got, n, 0.05) {
+			t.Errorf("estimate of %d visitors = %d", n, got)
+		}
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	var a, b Sketch
+	for i := 0; i < 6000; i++ {
+		a.Add(fmt.Sprintf("visitor-%d", i))
+	}
+	for i := 4000; i < 10000; i++ {
+		b.Add(fmt.Sprintf("visitor-%d", i))
+	}
+	a.Merge(&b)
+	if got := a.Estimate(); !within(got, 10000, 0.05) {
+		t.Errorf("union estimate = %d, want about 10000", got)
+	}
+
+	stored, err := ParseSketch(a.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Estimate() != a.Estimate() {
+		t.Errorf("round trip changed the estimate")
+	}
+	if _, err := ParseSketch([]byte{1, 2, 3}); err == nil {
+		t.Error("a short sketch parsed")
+	}
+	empty, err := ParseSketch(nil)
+	if err != nil || empty.Estimate() != 0 {
+		t.Errorf("ParseSketch(nil) = %v, %v", empty, err)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter()
+	monday := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	c.Record(monday, "a")
+	c.Record(monday.Add(time.Hour), "a")
+	c.Record(monday.Add(time.Hour), "b")
+	c.Record(monday.Add(24*time.Hour), "a")
+
+	buckets := c.Take()
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+	if again := c.Take(); len(again) != 0 {
+		t.Errorf("Take left %d buckets behind", len(again))
+	}
+
+	c.Record(monday, "c")
+	c.Put(buckets)
+	var visits, visitors int64
+	for _, b := range c.Take() {
+		if b.Start.Equal(Day(monday)) {
+			visits, visitors = b.Visits, b.Visitors.Estimate()
+		}
+	}
+	if visits != 4 || visitors != 3 {
+		t.Errorf("after Put, Monday has %d visits from %d visitors, want 4 from 3", visits, visitors)
+	}
+
+	c.Record(monday, "a")
+	c.Reset()
+	if left := c.Take(); len(left) != 0 {
+		t.Errorf("Reset left %d buckets", len(left))
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	ts := time.Date(2026, 10, 22, 23, 30, 0, 0, time.FixedZone("X", -3*3600)) // Friday 02:30 UTC
+	cases := map[Period]string{
+		Daily:   "2026-10-23",
+		Weekly:  "2026-10-19",
+		Monthly: "2026-10-01",
+	}
+	for period, want := range cases {
+		if got := period.Start(ts).Format(time.DateOnly); got != want {
+			t.Errorf("%s start = %s, want %s", period, got, want)
+		}
+	}
+	sunday := time.Date(2026, 10, 25, 12, 0, 0, 0, time.UTC)
+	if got := Weekly.Start(sunday).Format(time.DateOnly); got != "2026-10-19" {
+		t.Errorf("Sunday's week starts %s", got)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	now := time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC)
+	bucket := func(day string, visits int64, visitors ...string) Bucket {
+		start, _ := time.Parse(time.DateOnly, day)
+		b := Bucket{Start: start, Visits: visits, Visitors: &Sketch{}}
+		for _, v := range visitors {
+			b.Visitors.Add(v)
+		}
+		return b
+	}
+	buckets := []Bucket{
+		bucket("2026-09-30", 5, "a"),
+		bucket("2026-10-13", 2, "a", "b"),
+		bucket("2026-10-19", 3, "a", "b"),
+		bucket("2026-10-21", 4, "b", "c"),
+	}
+
+	daily := Series(buckets, Daily, 3, now)
+	if len(daily) != 3 || daily[0].Start.Format(time.DateOnly) != "2026-10-19" {
+		t.Fatalf("daily = %+v", daily)
+	}
+	if daily[0].Visits != 3 || daily[1].Visits != 0 || daily[2].Visits != 4 || daily[2].UniqueVisitors != 2 {
+		t.Errorf("daily = %+v", daily)
+	}
+
+	weekly := Series(buckets, Weekly, 2, now)
+	if weekly[0].Visits != 2 || weekly[1].Visits != 7 || weekly[1].UniqueVisitors != 3 {
+		t.Errorf("weekly = %+v", weekly)
+	}
+
+	monthly := Series(buckets, Monthly, 2, now)
+	if monthly[0].Start.Format(time.DateOnly) != "2026-09-01" || monthly[0].Visits != 5 || monthly[1].Visits != 9 || monthly[1].UniqueVisitors != 3 {
+		t.Errorf("monthly = %+v", monthly)
+	}
+
+	if got := Since(Monthly, 2, now).Format(time.DateOnly); got != "2026-09-01" {
+		t.Errorf("Since(monthly, 2) = %s", got)
+	}
+	if got := Since(Weekly, 2, now).Format(time.DateOnly); got != "2026-10-12" {
+		t.Errorf("Since(weekly, 2) = %s", got)
+	}
+}
@@ -2,8 +2,10 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -14,17 +16,23 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// HashPassword hashes with DefaultPasswordHashing. Servers with their own
+// settings use PasswordHashing.Hash.
 func HashPassword(password string) (string, error) {
-	password_byte := []byte(password)
-	hashedPass, err := bcrypt.GenerateFromPassword(password_byte, bcrypt.DefaultCost)
+	hash, err := DefaultPasswordHashing().Hash(password)
 	if err != nil {
 		log.Printf("Failed to hash the password: %s", err)
-		return string(hashedPass), err
+		return hash, err
 	}
-	return string(hashedPass), nil
+	return hash, nil
 }
 
+// CheckPasswordHash verifies argon2id and bcrypt hashes alike, so accounts
+// created before the switch to argon2id can still log in.
 func CheckPasswordHash(password, hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return checkArgon2Hash(password, hash)
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
 		return err
@@ -32,63 +40,151 @@ func CheckPasswordHash(password, hash string) error {
 	return nil
 }
 
-func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		Issuer: "chirpy",
-		IssuedAt: jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject: userId.String(),
+var (
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenSignature = errors.New("token signature is invalid")
+	ErrTokenExpired   = errors.New("token has expired")
+	ErrTokenClaims    = errors.New("token claims are invalid")
+)
+
+// JWTConfig is what both issuing and validating access tokens need: the
+// keyset plus the issuer and audience every token must carry. Leeway absorbs
+// clock skew between us and other verifiers.
+type JWTConfig struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// AccessClaims are the claims of our access tokens. Tokens issued to an
+// OAuth client also carry the client id and the scopes the user granted it.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// SessionID is the refresh token family a session token was issued
+	// for, so its use can be recorded against the session.
+	SessionID string `json:"sid,omitempty"`
+}
+
+func (c *AccessClaims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// Scopes returns nil for a user's own session token, which is not limited to
+// any scope, and the granted scopes for a token issued to an OAuth client.
+func (c *AccessClaims) Scopes() []string {
+	if c.ClientID == "" {
+		return nil
+	}
+	return append([]string{}, strings.Fields(c.Scope)...)
+}
+
+func MakeJWT(userId uuid.UUID, cfg JWTConfig, expiresIn time.Duration) (string, error) {
+	return signAccessToken(userId, "", nil, uuid.Nil, cfg, expiresIn)
+}
+
+// MakeSessionJWT is MakeJWT for a token tied to the session sessionID.
+func MakeSessionJWT(userId, sessionID uuid.UUID, cfg JWTConfig, expiresIn time.Duration) (string, error) {
+	return signAccessToken(userId, "", nil, sessionID, cfg, expiresIn)
+}
+
+// MakeScopedJWT issues an access token on behalf of an OAuth client. It
+// validates with ValidateJWT like any other access token.
+func MakeScopedJWT(userId uuid.UUID, clientID string, scopes []string, cfg JWTConfig, expiresIn time.Duration) (string, error) {
+	if clientID == "" {
+		return "", errors.New("scoped tokens need a client id")
+	}
+	return signAccessToken(userId, clientID, scopes, uuid.Nil, cfg, expiresIn)
+}
+
+func signAccessToken(userId uuid.UUID, clientID string, scopes []string, sessionID uuid.UUID, cfg JWTConfig, expiresIn time.Duration) (string, error) {
+	key, err := cfg.Keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := &AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: cfg.Issuer,
+			Audience: jwt.ClaimStrings{cfg.Audience},
+			IssuedAt: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject: userId.String(),
+			ID: uuid.NewString(),
+		},
+		Scope: strings.Join(scopes, " "),
+		ClientID: clientID,
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString([]byte(tokenSecret))
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	ss, err := token.SignedString(key.PrivateKey)
 	if err != nil {
 		return ss, err
 	}
 	return ss, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	type MyCustomClaims struct{
-		jwt.RegisteredClaims
+// ValidateJWT verifies the signature against the keyset, pinned to the
+// asymmetric algorithms we sign with, and requires iss, aud, exp, iat, sub and
+// jti. Failures wrap one of the ErrToken* errors.
+func ValidateJWT(tokenString string, cfg JWTConfig) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token)(interface{}, error){
+		kid, _ := token.Header["kid"].(string)
+		key, ok := cfg.Keys.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+		}
+		return key.PrivateKey.Public(), nil
+	},
+		jwt.WithValidMethods([]string{AlgEdDSA, AlgRS256}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	)
+	switch {
+	case err == nil:
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return nil, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return nil, fmt.Errorf("%w: %v", ErrTokenSignature, err)
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, fmt.Errorf("%w: %v", ErrTokenExpired, err)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrTokenClaims, err)
 	}
-
-	token, err := jwt.ParseWithClaims(tokenString, &MyCustomClaims{}, func(token *jwt.Token)(interface{}, error){
-		log.Print("55 token parse with claims", token, tokenSecret)
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		log.Printf("Error retrieving the token: %s", err)
-		return uuid.Nil, err
-	}
-	claims, ok := token.Claims.(*MyCustomClaims)
-	if !ok && !token.Valid {
-		log.Print(claims, token.Valid, " validate 62")
-		return uuid.Nil, nil
-	} 
-	id, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		log.Printf("failed to parse: %s", err)
-		return uuid.Nil, err
+	if claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing iat", ErrTokenClaims)
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: missing jti", ErrTokenClaims)
 	}
-	return id, nil
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("%w: bad subject: %v", ErrTokenClaims, err)
+	}
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header)(string, error){
 	if headers == nil {
 		return "", errors.New("no headers were sent")
 	}
-	bearerString := headers.Get("Authorization")
-	if len(bearerString) < 6 {
+	scheme, token, ok := strings.Cut(headers.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
 		return "", errors.New("bad bearer token")
 	}
-	strippedString := bearerString[6:]
-	cleanStringArray := strings.Split(strippedString, " ") 
-	cleanedString := strings.Join(cleanStringArray, "")
-	log.Print(bearerString, 74)
-	log.Print(strippedString, 75)
-	log.Print(cleanStringArray, 76)
-	log.Print(cleanedString, 77)
-	return cleanedString, nil
+	return token, nil
 }
 
 func MakeRefreshToken() (string, error) {
@@ -101,6 +197,13 @@ func MakeRefreshToken() (string, error) {
 	return ecodedStr, nil
 }
 
+// HashToken returns the hex sha256 of an opaque token so it can be stored
+// and looked up without keeping the token itself in the database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	if headers == nil {
 		return "", errors.New("no headers were sent")
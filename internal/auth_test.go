@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
@@ -9,14 +10,18 @@ import (
 
 func TestJWTValidation(t *testing.T){
 	userId := uuid.New()
-	tokenSecret := "mytoken"
+	key, err := GenerateSigningKey(AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatalf("Error generating a key: %s", err)
+	}
+	cfg := JWTConfig{Keys: NewKeySet(key), Issuer: "chirpy", Audience: "chirpy"}
 	expiresIn := 5 * time.Second
-	tokenString, err := MakeJWT(userId, tokenSecret, expiresIn)
+	tokenString, err := MakeJWT(userId, cfg, expiresIn)
 	
 	if err != nil {
 		t.Fatalf("Error generating a token: %s", err)		
 	}
-	tokenId, err := ValidateJWT(tokenString, tokenSecret)
+	tokenId, err := ValidateJWT(tokenString, cfg)
 	if err != nil {
 		t.Log("token invalid")
 		return
@@ -24,14 +29,93 @@ func TestJWTValidation(t *testing.T){
 	t.Log(tokenId)
 }
 
+func TestSessionJWT(t *testing.T) {
+	userId, sessionId := uuid.New(), uuid.New()
+	key, err := GenerateSigningKey(AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := JWTConfig{Keys: NewKeySet(key), Issuer: "chirpy", Audience: "chirpy"}
+	tokenString, err := MakeSessionJWT(userId, sessionId, cfg, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateJWT(tokenString, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.SessionID != sessionId.String() || claims.Subject != userId.String() {
+		t.Errorf("claims = %+v", claims)
+	}
+	plain, _ := MakeJWT(userId, cfg, time.Minute)
+	claims, err = ValidateJWT(plain, cfg)
+	if err != nil || claims.SessionID != "" {
+		t.Errorf("MakeJWT claims = %+v, %v", claims, err)
+	}
+}
+
 func TestHeaders(t *testing.T){
-	Header := map[string][]string{
-    "Authorization": {"Bearer token_string"},
+	for header, want := range map[string]string{
+		"Bearer token_string":   "token_string",
+		"bearer  token_string ": "token_string",
+		"Basic token_string":    "",
+		"Bearertoken_string":    "",
+		"Bearer ":               "",
+		"":                      "",
+	} {
+		got, err := GetBearerToken(http.Header{"Authorization": {header}})
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("GetBearerToken(%q) = %q, %v; want %q", header, got, err, want)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T){
+	valid := map[string]string{
+		"user@example.com": "user@example.com",
+		"  User@Example.COM ": "user@example.com",
+		"first.last+tag@sub.example.org": "first.last+tag@sub.example.org",
+	}
+	for input, want := range valid {
+		got, err := NormalizeEmail(input)
+		if err != nil {
+			t.Errorf("NormalizeEmail(%q) returned error: %s", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", input, got, want)
+		}
+	}
+	invalid := []string{"", "user", "user@", "@example.com", "user@localhost", "Bob <bob@example.com>", "a b@example.com"}
+	for _, input := range invalid {
+		if _, err := NormalizeEmail(input); err == nil {
+			t.Errorf("NormalizeEmail(%q) should have failed", input)
+		}
 	}
-	cleanStr, err := GetBearerToken(Header)
+}
+
+func TestNormalizeScopes(t *testing.T){
+	scopes, err := NormalizeScopes([]string{ScopeChirpsWrite, ScopeChirpsRead, ScopeChirpsWrite})
 	if err != nil {
-		t.Logf("could not clean headers: %s", err)
+		t.Fatalf("NormalizeScopes: %s", err)
+	}
+	if len(scopes) != 2 || scopes[0] != ScopeChirpsRead || scopes[1] != ScopeChirpsWrite {
+		t.Errorf("unexpected scopes: %v", scopes)
+	}
+	if _, err := NormalizeScopes([]string{"admin"}); err == nil {
+		t.Error("unknown scope should be rejected")
 	}
-	t.Log(cleanStr)
 }
 
+func TestPersonalAccessToken(t *testing.T){
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken: %s", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("token %q is missing the prefix", token)
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJFZERTQSJ9.e30.sig") {
+		t.Error("a JWT should not look like a personal access token")
+	}
+}
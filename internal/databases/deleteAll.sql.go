@@ -11,7 +11,7 @@ import (
 
 const deleteUser = `-- name: DeleteUser :one
 DELETE FROM users
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle
 `
 
 func (q *Queries) DeleteUser(ctx context.Context) (User, error) {
@@ -24,6 +24,11 @@ func (q *Queries) DeleteUser(ctx context.Context) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
 	)
 	return i, err
 }
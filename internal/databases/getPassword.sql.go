@@ -7,6 +7,7 @@ package databases
 
 import (
 	"context"
+	"database/sql"
 )
 
 const getPassword = `-- name: GetPassword :one
@@ -14,9 +15,9 @@ SELECT hashed_password FROM users
 WHERE email = $1
 `
 
-func (q *Queries) GetPassword(ctx context.Context, email string) (string, error) {
+func (q *Queries) GetPassword(ctx context.Context, email string) (sql.NullString, error) {
 	row := q.db.QueryRowContext(ctx, getPassword, email)
-	var hashed_password string
+	var hashed_password sql.NullString
 	err := row.Scan(&hashed_password)
 	return hashed_password, err
 }
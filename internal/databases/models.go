@@ -6,11 +6,34 @@ package databases
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ActivityDelivery struct {
+	ID             uuid.UUID
+	UserID         uuid.UUID
+	ActivityID     string
+	Inbox          string
+	Body           json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
+	CreatedAt      time.Time
+}
+
+type ActorKey struct {
+	UserID        uuid.UUID
+	PublicKeyPem  string
+	PrivateKeyPem string
+	CreatedAt     time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -19,20 +42,291 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpTag struct {
+	ChirpID   uuid.UUID
+	Tag       string
 	CreatedAt time.Time
+}
+
+type EmailVerification struct {
+	TokenHash      string
+	CreatedAt      time.Time
+	UserID         uuid.UUID
+	Email          string
+	ExpiresAt      time.Time
+	UsedAt         sql.NullTime
+	Purpose        string
+	HashedPassword sql.NullString
+}
+
+type EventConsumer struct {
+	Name      string
+	LastTxid  int64
+	LastID    int64
 	UpdatedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type InboxActivity struct {
+	ID         string
+	ReceivedAt time.Time
+}
+
+type LoginChallenge struct {
+	TokenHash string
+	CreatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	Attempts  int32
+	UsedAt    sql.NullTime
+}
+
+type LoginFailure struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type Notification struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Type          string
+	ActorID       uuid.NullUUID
+	ChirpID       uuid.NullUUID
+	EventID       sql.NullInt64
+	CreatedAt     time.Time
+	ReadAt        sql.NullTime
+	RemoteActorID sql.NullString
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID
+	Type    string
+	Enabled bool
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UserID       uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	CreatedAt    time.Time
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   uuid.NullUUID
+	ExpiresAt    time.Time
+}
+
+type Outbox struct {
+	ID        int64
+	EventType string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	Txid      interface{}
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type PolkaEvent struct {
+	ID         string
+	Event      string
+	ReceivedAt time.Time
+}
+
+type RateLimitBucket struct {
+	Key         string
+	Tokens      float64
+	LastAllowed bool
+	UpdatedAt   time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+}
+
+type RemoteActor struct {
+	ID           string
+	Handle       string
+	Inbox        string
+	SharedInbox  sql.NullString
+	KeyID        string
+	PublicKeyPem string
+	FetchedAt    time.Time
+}
+
+type RemoteFollow struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	ActorID    string
+	CreatedAt  time.Time
+	AcceptedAt sql.NullTime
+}
+
+type RemoteFollower struct {
+	UserID    uuid.UUID
+	ActorID   string
+	FollowID  string
+	CreatedAt time.Time
+}
+
+type RemotePost struct {
+	ID          string
+	ActorID     string
+	Url         sql.NullString
+	Content     string
+	PublishedAt time.Time
+	ReceivedAt  time.Time
+}
+
+type RevokedAccessToken struct {
+	Jti       string
+	UserID    uuid.UUID
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
+type SigningKey struct {
+	Kid         string
+	Algorithm   string
+	PrivateKey  string
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+}
+
+type StreamTicket struct {
+	TicketHash     string
+	CreatedAt      time.Time
+	UserID         uuid.UUID
+	TokenID        string
+	SessionID      uuid.NullUUID
+	TokenExpiresAt time.Time
+	ExpiresAt      time.Time
+}
+
+type Subscription struct {
+	UserID    uuid.UUID
+	Plan      string
+	Status    string
+	StartedAt time.Time
+	RenewedAt sql.NullTime
+	ExpiresAt time.Time
+	UpdatedAt time.Time
 }
 
 type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  sql.NullString
+	IsChirpyRed     sql.NullBool
+	EmailVerifiedAt sql.NullTime
+	TotpSecret      sql.NullString
+	TotpEnabledAt   sql.NullTime
+	TotpLastStep    sql.NullInt64
+	Handle          sql.NullString
+}
+
+type UserIdentity struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Provider  string
+	Subject   string
+	Email     sql.NullString
+}
+
+type VisitBucket struct {
+	BucketStart time.Time
+	Hits        int64
+	Visitors    []byte
+	UpdatedAt   time.Time
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	OutboxID       int64
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    sql.NullBool
+}
+
+type WebhookEvent struct {
+	ID         uuid.UUID
+	Source     string
+	ReceivedAt time.Time
+	Headers    json.RawMessage
+	Body       []byte
+	Verified   bool
+	StatusCode int32
+	Result     string
+	DurationMs int32
+	ReplayOf   uuid.NullUUID
+	BodySize   int32
+	BodySha256 string
+}
+
+type WebhookSubscription struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	Url        string
+	Secret     string
+	EventTypes []string
 }
@@ -12,10 +12,10 @@ import (
 const revokeToken = `-- name: RevokeToken :exec
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1
+WHERE token_hash = $1
 `
 
-func (q *Queries) RevokeToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeToken, token)
+func (q *Queries) RevokeToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeToken, tokenHash)
 	return err
 }
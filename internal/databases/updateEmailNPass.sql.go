@@ -1,39 +0,0 @@
-// Code generated by sqlc. DO NOT EDIT.
-// versions:
-//   sqlc v1.28.0
-// source: updateEmailNPass.sql
-
-package databases
-
-import (
-	"context"
-
-	"github.com/google/uuid"
-)
-
-const updateUser = `-- name: UpdateUser :one
-UPDATE users
-SET email = $1, hashed_password = $2
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
-`
-
-type UpdateUserParams struct {
-	Email          string
-	HashedPassword string
-	ID             uuid.UUID
-}
-
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Email,
-		&i.HashedPassword,
-		&i.IsChirpyRed,
-	)
-	return i, err
-}
@@ -16,7 +16,7 @@ UPDATE users
 SET is_chirpy_red = TRUE
 WHERE id = $1
 
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle
 `
 
 func (q *Queries) UpgradeToRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -29,6 +29,11 @@ func (q *Queries) UpgradeToRed(ctx context.Context, id uuid.UUID) (User, error)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
 	)
 	return i, err
 }
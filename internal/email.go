@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail checks that email is a bare address (no display name) and
+// returns it trimmed and lower-cased so lookups don't depend on how the user
+// typed it.
+func NormalizeEmail(email string) (string, error) {
+	trimmed := strings.TrimSpace(email)
+	if trimmed == "" || len(trimmed) > 254 {
+		return "", ErrInvalidEmail
+	}
+	addr, err := mail.ParseAddress(trimmed)
+	if err != nil || addr.Name != "" || addr.Address != trimmed {
+		return "", ErrInvalidEmail
+	}
+	at := strings.LastIndex(addr.Address, "@")
+	if at < 1 || !strings.Contains(addr.Address[at+1:], ".") {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
@@ -0,0 +1,238 @@
+// Package events delivers domain events recorded in the outbox to
+// in-process subscribers. Every subscriber keeps its own offset and sees
+// each event at least once, in commit order.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Event struct {
+	ID        int64
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	// Position is where the event sits in commit order.
+	Position Position
+}
+
+// Position orders events by the transaction that wrote them and then by id.
+// Ids alone aren't enough: a transaction can take an id and commit after one
+// that took a later id, and a consumer already past the later id would never
+// see it.
+type Position struct {
+	TxID int64
+	ID   int64
+}
+
+func (p Position) Less(o Position) bool {
+	if p.TxID != o.TxID {
+		return p.TxID < o.TxID
+	}
+	return p.ID < o.ID
+}
+
+type Store interface {
+	// Read returns up to limit events after pos in Position order. It must
+	// only return events that no longer-running transaction can precede.
+	Read(ctx context.Context, after Position, limit int) ([]Event, error)
+	Offset(ctx context.Context, consumer string) (Position, error)
+	SaveOffset(ctx context.Context, consumer string, pos Position) error
+	// Latest is the position of the newest event Read would return.
+	Latest(ctx context.Context) (Position, error)
+	// Prune may drop events at or before upTo. The store decides how long
+	// it keeps them beyond that.
+	Prune(ctx context.Context, upTo Position) error
+}
+
+// A Handler returning an error gets the same event again on the next pass,
+// so handlers must be idempotent.
+type Handler func(ctx context.Context, e Event) error
+
+type subscriber struct {
+	name    string
+	types   []string
+	handler Handler
+	// live subscribers keep their position in memory, starting from the
+	// newest event when first dispatched
+	live *livePosition
+}
+
+type livePosition struct {
+	pos     Position
+	started bool
+}
+
+func (s subscriber) wants(eventType string) bool {
+	return len(s.types) == 0 || slices.Contains(s.types, eventType)
+}
+
+type Dispatcher struct {
+	store     Store
+	batchSize int
+
+	mu          sync.Mutex
+	subscribers []subscriber
+	wake        chan struct{}
+	// running serialises passes so a subscriber never runs concurrently
+	// with itself inside one process.
+	running sync.Mutex
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{store: store, batchSize: 100, wake: make(chan struct{}, 1)}
+}
+
+// Subscribe registers handler under name for the given event types, or for
+// every event when none are given. The name keys the stored offset, so it
+// must stay the same across restarts.
+func (d *Dispatcher) Subscribe(name string, handler Handler, types ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscribers = append(d.subscribers, subscriber{name: name, types: types, handler: handler})
+}
+
+// SubscribeLive registers a handler that only sees events recorded while
+// this process runs. Every process gets every event, which suits state held
+// in memory such as open streams; nothing is replayed after a restart.
+func (d *Dispatcher) SubscribeLive(name string, handler Handler, types ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscribers = append(d.subscribers, subscriber{name: name, types: types, handler: handler, live: &livePosition{}})
+}
+
+// Notify asks Run for a pass now rather than at the next tick. Call it
+// after committing a transaction that recorded events.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches every interval, and whenever notified, until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		err := d.Dispatch(ctx)
+		if err != nil {
+			log.Printf("Error dispatching events: %s", err)
+		}
+	}
+}
+
+// Dispatch brings every subscriber up to date. A subscriber whose handler
+// fails stops at that event; the others carry on.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	d.running.Lock()
+	defer d.running.Unlock()
+	d.mu.Lock()
+	subscribers := slices.Clone(d.subscribers)
+	d.mu.Unlock()
+	var errs []error
+	for _, s := range subscribers {
+		err := d.catchUp(ctx, s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Prune lets the store drop events that every durable subscriber has
+// handled. Live subscribers don't hold events back, since they never look
+// at anything recorded before they started. Every process must subscribe
+// the same durable names, or one could prune what another still needs.
+func (d *Dispatcher) Prune(ctx context.Context) error {
+	d.mu.Lock()
+	subscribers := slices.Clone(d.subscribers)
+	d.mu.Unlock()
+	var upTo Position
+	found := false
+	for _, s := range subscribers {
+		if s.live != nil {
+			continue
+		}
+		pos, err := d.store.Offset(ctx, s.name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+		if !found || pos.Less(upTo) {
+			upTo, found = pos, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return d.store.Prune(ctx, upTo)
+}
+
+func (d *Dispatcher) offset(ctx context.Context, s subscriber) (Position, error) {
+	if s.live == nil {
+		return d.store.Offset(ctx, s.name)
+	}
+	if !s.live.started {
+		pos, err := d.store.Latest(ctx)
+		if err != nil {
+			return Position{}, err
+		}
+		s.live.pos, s.live.started = pos, true
+	}
+	return s.live.pos, nil
+}
+
+func (d *Dispatcher) saveOffset(ctx context.Context, s subscriber, pos Position) error {
+	if s.live == nil {
+		return d.store.SaveOffset(ctx, s.name, pos)
+	}
+	s.live.pos = pos
+	return nil
+}
+
+func (d *Dispatcher) catchUp(ctx context.Context, s subscriber) error {
+	pos, err := d.offset(ctx, s)
+	if err != nil {
+		return err
+	}
+	for {
+		batch, err := d.store.Read(ctx, pos, d.batchSize)
+		if err != nil {
+			return err
+		}
+		done := pos
+		for _, e := range batch {
+			if s.wants(e.Type) {
+				err = s.handler(ctx, e)
+				if err != nil {
+					err = fmt.Errorf("event %d: %w", e.ID, err)
+					break
+				}
+			}
+			done = e.Position
+		}
+		if done != pos {
+			saveErr := d.saveOffset(ctx, s, done)
+			if saveErr != nil {
+				return errors.Join(err, saveErr)
+			}
+			pos = done
+		}
+		if err != nil || len(batch) < d.batchSize {
+			return err
+		}
+	}
+}
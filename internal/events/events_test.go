@@ -0,0 +1,200 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+type memoryStore struct {
+	events  []Event
+	offsets map[string]Position
+}
+
+func (s *memoryStore) Read(ctx context.Context, after Position, limit int) ([]Event, error) {
+	var out []Event
+	for _, e := range s.events {
+		if after.Less(e.Position) && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) Offset(ctx context.Context, consumer string) (Position, error) {
+	return s.offsets[consumer], nil
+}
+
+func (s *memoryStore) SaveOffset(ctx context.Context, consumer string, pos Position) error {
+	s.offsets[consumer] = pos
+	return nil
+}
+
+func (s *memoryStore) Latest(ctx context.Context) (Position, error) {
+	if len(s.events) == 0 {
+		return Position{}, nil
+	}
+	return s.events[len(s.events)-1].Position, nil
+}
+
+func (s *memoryStore) Prune(ctx context.Context, upTo Position) error {
+	s.events = slices.DeleteFunc(s.events, func(e Event) bool {
+		return !upTo.Less(e.Position)
+	})
+	return nil
+}
+
+func (s *memoryStore) add(txid int64, eventType string) {
+	id := int64(len(s.events) + 1)
+	s.events = append(s.events, Event{ID: id, Type: eventType, Position: Position{TxID: txid, ID: id}})
+	slices.SortFunc(s.events, func(a, b Event) int {
+		if a.Position.Less(b.Position) {
+			return -1
+		}
+		return 1
+	})
+}
+
+func TestDispatch(t *testing.T) {
+	store := &memoryStore{offsets: map[string]Position{}}
+	d := NewDispatcher(store)
+	d.batchSize = 2
+	var all, chirps []int64
+	d.Subscribe("all", func(ctx context.Context, e Event) error {
+		all = append(all, e.ID)
+		return nil
+	})
+	d.Subscribe("chirps", func(ctx context.Context, e Event) error {
+		chirps = append(chirps, e.ID)
+		return nil
+	}, "chirp.created")
+
+	store.add(10, "chirp.created")
+	store.add(11, "user.created")
+	store.add(11, "chirp.created")
+	if err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(all, []int64{1, 2, 3}) || !slices.Equal(chirps, []int64{1, 3}) {
+		t.Fatalf("all = %v, chirps = %v", all, chirps)
+	}
+	if got := store.offsets["chirps"]; got != (Position{TxID: 11, ID: 3}) {
+		t.Errorf("chirps offset = %+v", got)
+	}
+
+	// nothing new: nothing is redelivered
+	store.add(12, "chirp.created")
+	if err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(all, []int64{1, 2, 3, 4}) || !slices.Equal(chirps, []int64{1, 3, 4}) {
+		t.Fatalf("all = %v, chirps = %v", all, chirps)
+	}
+}
+
+func TestDispatchRetriesFailedEvent(t *testing.T) {
+	store := &memoryStore{offsets: map[string]Position{}}
+	d := NewDispatcher(store)
+	fail := true
+	var seen, other []int64
+	d.Subscribe("flaky", func(ctx context.Context, e Event) error {
+		if e.ID == 2 && fail {
+			return errors.New("down")
+		}
+		seen = append(seen, e.ID)
+		return nil
+	})
+	d.Subscribe("other", func(ctx context.Context, e Event) error {
+		other = append(other, e.ID)
+		return nil
+	})
+	store.add(1, "a")
+	store.add(2, "a")
+	store.add(3, "a")
+
+	if err := d.Dispatch(context.Background()); err == nil {
+		t.Fatal("Dispatch succeeded with a failing handler")
+	}
+	if !slices.Equal(seen, []int64{1}) || !slices.Equal(other, []int64{1, 2, 3}) {
+		t.Fatalf("seen = %v, other = %v", seen, other)
+	}
+	fail = false
+	if err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(seen, []int64{1, 2, 3}) || !slices.Equal(other, []int64{1, 2, 3}) {
+		t.Fatalf("seen = %v, other = %v", seen, other)
+	}
+}
+
+func TestSubscribeLive(t *testing.T) {
+	store := &memoryStore{offsets: map[string]Position{}}
+	d := NewDispatcher(store)
+	var seen []int64
+	d.SubscribeLive("stream", func(ctx context.Context, e Event) error {
+		seen = append(seen, e.ID)
+		return nil
+	})
+	store.add(1, "a")
+	store.add(2, "a")
+	if err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 0 {
+		t.Fatalf("live subscriber saw old events %v", seen)
+	}
+	store.add(3, "a")
+	if err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(seen, []int64{3}) {
+		t.Fatalf("seen = %v", seen)
+	}
+	if _, ok := store.offsets["stream"]; ok {
+		t.Error("live subscriber stored an offset")
+	}
+}
+
+func TestPruneKeepsUnhandledEvents(t *testing.T) {
+	store := &memoryStore{offsets: map[string]Position{}}
+	d := NewDispatcher(store)
+	fail := true
+	d.Subscribe("fast", func(ctx context.Context, e Event) error { return nil })
+	d.Subscribe("slow", func(ctx context.Context, e Event) error {
+		if e.ID == 2 && fail {
+			return errors.New("down")
+		}
+		return nil
+	})
+	d.SubscribeLive("stream", func(ctx context.Context, e Event) error { return nil })
+	store.add(1, "a")
+	store.add(2, "a")
+	store.add(3, "a")
+	d.Dispatch(context.Background())
+
+	if err := d.Prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.events) != 2 || store.events[0].ID != 2 {
+		t.Fatalf("after pruning, events = %+v; want 2 and 3 kept for slow", store.events)
+	}
+	fail = false
+	d.Dispatch(context.Background())
+	if err := d.Prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.events) != 0 {
+		t.Errorf("%d events left after every consumer passed them", len(store.events))
+	}
+}
+
+func TestPositionLess(t *testing.T) {
+	// a later id from an earlier transaction still comes first
+	if !(Position{TxID: 5, ID: 9}).Less(Position{TxID: 6, ID: 2}) {
+		t.Error("positions must order by transaction first")
+	}
+	if !(Position{TxID: 5, ID: 1}).Less(Position{TxID: 5, ID: 2}) {
+		t.Error("positions in one transaction must order by id")
+	}
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"main.go/internal/databases"
+)
+
+// PostgresStore reads the outbox table and keeps offsets in
+// event_consumers.
+type PostgresStore struct {
+	Queries *databases.Queries
+}
+
+func (s PostgresStore) Read(ctx context.Context, after Position, limit int) ([]Event, error) {
+	rows, err := s.Queries.ReadOutboxEvents(ctx, databases.ReadOutboxEventsParams{
+		AfterTxid: after.TxID,
+		AfterID:   after.ID,
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, Event{
+			ID:        row.ID,
+			Type:      row.EventType,
+			Payload:   row.Payload,
+			CreatedAt: row.CreatedAt,
+			Position:  Position{TxID: row.Txid, ID: row.ID},
+		})
+	}
+	return events, nil
+}
+
+func (s PostgresStore) Offset(ctx context.Context, consumer string) (Position, error) {
+	row, err := s.Queries.GetEventConsumer(ctx, consumer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Position{}, nil
+	}
+	if err != nil {
+		return Position{}, err
+	}
+	return Position{TxID: row.LastTxid, ID: row.LastID}, nil
+}
+
+func (s PostgresStore) SaveOffset(ctx context.Context, consumer string, pos Position) error {
+	return s.Queries.SaveEventConsumer(ctx, databases.SaveEventConsumerParams{
+		Name:     consumer,
+		LastTxid: pos.TxID,
+		LastID:   pos.ID,
+	})
+}
+
+func (s PostgresStore) Prune(ctx context.Context, upTo Position) error {
+	return s.Queries.PruneOutbox(ctx, databases.PruneOutboxParams{
+		UptoTxid: upTo.TxID,
+		UptoID:   upTo.ID,
+	})
+}
+
+func (s PostgresStore) Latest(ctx context.Context) (Position, error) {
+	row, err := s.Queries.GetLatestOutboxPosition(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Position{}, nil
+	}
+	if err != nil {
+		return Position{}, err
+	}
+	return Position{TxID: row.Txid, ID: row.ID}, nil
+}
@@ -0,0 +1,189 @@
+// Package feed renders lists of chirps as Atom (RFC 4287) and RSS 2.0
+// documents.
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+)
+
+type Feed struct {
+	// ID is a permanent IRI for the feed; the self URL works.
+	ID          string
+	Title       string
+	Description string
+	// SelfURL is where this document is served, AltURL the page it
+	// describes.
+	SelfURL string
+	AltURL  string
+	Author  string
+	Entries []Entry
+	// Updated is used when there are no entries.
+	Updated time.Time
+}
+
+type Entry struct {
+	// ID is a permanent IRI such as "urn:uuid:...".
+	ID        string
+	Title     string
+	URL       string
+	Content   string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+}
+
+// LastModified is the newest entry update, or f.Updated for an empty feed.
+func (f Feed) LastModified() time.Time {
+	latest := f.Updated
+	for _, e := range f.Entries {
+		if e.Updated.After(latest) {
+			latest = e.Updated
+		}
+	}
+	return latest.UTC().Truncate(time.Second)
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     atomText    `xml:"title"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Content   atomText    `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    atomText    `xml:"title"`
+	Subtitle *atomText   `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   *atomPerson `xml:"author,omitempty"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+func person(name string) *atomPerson {
+	if name == "" {
+		return nil
+	}
+	return &atomPerson{Name: name}
+}
+
+// Atom renders the feed. Atom requires an author for every entry, so
+// either the feed or each entry must have one.
+func (f Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		ID:      f.ID,
+		Title:   atomText{Type: "text", Body: f.Title},
+		Updated: f.LastModified().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.SelfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.AltURL, Rel: "alternate"},
+		},
+		Author: person(f.Author),
+	}
+	if f.Description != "" {
+		doc.Subtitle = &atomText{Type: "text", Body: f.Description}
+	}
+	for _, e := range f.Entries {
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:        e.ID,
+			Title:     atomText{Type: "text", Body: e.Title},
+			Link:      atomLink{Href: e.URL, Rel: "alternate"},
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+			Author:    person(e.Author),
+			Content:   atomText{Type: "text", Body: e.Content},
+		})
+	}
+	return render(doc)
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	AtomLink      atomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// RSS renders the feed as RSS 2.0. RSS has no author name without an email
+// address, so authors are left out.
+func (f Feed) RSS() ([]byte, error) {
+	description := f.Description
+	if description == "" {
+		description = f.Title
+	}
+	doc := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.AltURL,
+			Description:   description,
+			LastBuildDate: f.LastModified().Format(time.RFC1123Z),
+			AtomLink:      atomLink{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	for _, e := range f.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.URL,
+			Description: e.Content,
+			GUID:        rssGUID{IsPermaLink: false, Value: e.ID},
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return render(doc)
+}
+
+func render(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
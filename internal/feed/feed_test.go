@@ -0,0 +1,325 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() Feed {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return Feed{
+		ID:      "https://chirpy.example/users/ada/feed.atom",
+		Title:   "Chirps by @ada",
+		SelfURL: "https://chirpy.example/users/ada/feed.atom",
+		AltURL:  "https://chirpy.example/users/ada",
+		Author:  "ada",
+		Updated: t0.Add(-time.Hour),
+		Entries: []Entry{
+			{
+				ID:        "urn:uuid:7c9e6679-7425-40de-944b-e07fc1f90ae7",
+				Title:     "Fish & chips <3",
+				URL:       "https://chirpy.example/api/chirps/7c9e6679-7425-40de-944b-e07fc1f90ae7",
+				Content:   "Fish & chips <3 #lunch",
+				Published: t0,
+				Updated:   t0.Add(time.Minute),
+			},
+			{
+				ID:        "urn:uuid:9b2f0e1a-4c1d-4d4e-8f5a-2b3c4d5e6f70",
+				Title:     "hello",
+				URL:       "https://chirpy.example/api/chirps/9b2f0e1a-4c1d-4d4e-8f5a-2b3c4d5e6f70",
+				Content:   "hello",
+				Published: t0.Add(-time.Hour),
+				Updated:   t0.Add(-time.Hour),
+			},
+		},
+	}
+}
+
+// The structs below read documents back the way a validator sees them and
+// check what RFC 4287 and the RSS 2.0 specification require. Elements that
+// must appear exactly once are read into slices so that a missing or
+// repeated one is caught.
+
+type parsedPerson struct {
+	Names []string `xml:"name"`
+}
+
+type parsedLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type parsedAtom struct {
+	XMLName xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	IDs     []string       `xml:"id"`
+	Titles  []string       `xml:"title"`
+	Updated []string       `xml:"updated"`
+	Links   []parsedLink   `xml:"link"`
+	Authors []parsedPerson `xml:"author"`
+	Entries []parsedEntry  `xml:"entry"`
+}
+
+type parsedEntry struct {
+	IDs       []string       `xml:"id"`
+	Titles    []string       `xml:"title"`
+	Updated   []string       `xml:"updated"`
+	Published []string       `xml:"published"`
+	Links     []parsedLink   `xml:"link"`
+	Authors   []parsedPerson `xml:"author"`
+	Content   struct {
+		Type string `xml:"type,attr"`
+		Body string `xml:",chardata"`
+	} `xml:"content"`
+}
+
+// one returns the only value of an element that must appear exactly once.
+func one(t *testing.T, what string, values []string) string {
+	t.Helper()
+	if len(values) != 1 || strings.TrimSpace(values[0]) == "" {
+		t.Errorf("%s must appear exactly once and not be empty, got %q", what, values)
+		return ""
+	}
+	return values[0]
+}
+
+func checkIRI(t *testing.T, what, s string) {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		t.Errorf("%s %q is not an absolute IRI", what, s)
+	}
+}
+
+func checkRFC3339(t *testing.T, what, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Errorf("%s %q is not an RFC 3339 date", what, s)
+	}
+	return d
+}
+
+func checkAuthors(t *testing.T, what string, authors []parsedPerson) {
+	t.Helper()
+	for _, a := range authors {
+		one(t, what+" author name", a.Names)
+	}
+}
+
+func validateAtom(t *testing.T, data []byte) parsedAtom {
+	t.Helper()
+	var doc parsedAtom
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("atom does not parse: %v", err)
+	}
+	checkIRI(t, "feed id", one(t, "atom:feed/id", doc.IDs))
+	one(t, "atom:feed/title", doc.Titles)
+	feedUpdated := checkRFC3339(t, "feed updated", one(t, "atom:feed/updated", doc.Updated))
+	checkAuthors(t, "feed", doc.Authors)
+	self := false
+	for _, l := range doc.Links {
+		if l.Rel == "self" {
+			checkIRI(t, "self link", l.Href)
+			self = true
+		}
+	}
+	if !self {
+		t.Error("atom:feed should have a self link")
+	}
+	ids := map[string]bool{}
+	for i, e := range doc.Entries {
+		what := fmt.Sprintf("entry %d", i)
+		id := one(t, what+" id", e.IDs)
+		checkIRI(t, what+" id", id)
+		if ids[id] {
+			t.Errorf("duplicate entry id %s", id)
+		}
+		ids[id] = true
+		one(t, what+" title", e.Titles)
+		updated := checkRFC3339(t, what+" updated", one(t, what+" updated", e.Updated))
+		if updated.After(feedUpdated) {
+			t.Errorf("%s was updated after the feed", what)
+		}
+		if len(e.Published) > 1 {
+			t.Errorf("%s has %d published dates", what, len(e.Published))
+		}
+		for _, p := range e.Published {
+			if checkRFC3339(t, what+" published", p).After(updated) {
+				t.Errorf("%s was published after it was updated", what)
+			}
+		}
+		alternate := false
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				checkIRI(t, what+" link", l.Href)
+				alternate = true
+			}
+		}
+		// content is inline, so RFC 4287 4.1.1.1 asks for no alternate
+		// link, but a reader has nowhere to go without one
+		if !alternate {
+			t.Errorf("%s has no alternate link", what)
+		}
+		checkAuthors(t, what, e.Authors)
+		if len(doc.Authors) == 0 && len(e.Authors) == 0 {
+			t.Errorf("%s needs an author when the feed has none", what)
+		}
+	}
+	return doc
+}
+
+type parsedRSS struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Titles []string `xml:"title"`
+		// Both the RSS link and atom:link match here; the namespace tells
+		// them apart.
+		Links []struct {
+			XMLName xml.Name
+			Href    string `xml:"href,attr"`
+			Rel     string `xml:"rel,attr"`
+			Value   string `xml:",chardata"`
+		} `xml:"link"`
+		Descriptions  []string `xml:"description"`
+		LastBuildDate []string `xml:"lastBuildDate"`
+		Items         []struct {
+			Title       string   `xml:"title"`
+			Links       []string `xml:"link"`
+			Description string   `xml:"description"`
+			GUIDs       []string `xml:"guid"`
+			PubDates    []string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// checkRFC822 accepts the RFC 822 dates RSS uses, with four digit years as
+// RSS 2.0 recommends.
+func checkRFC822(t *testing.T, what, s string) {
+	t.Helper()
+	_, err := time.Parse(time.RFC1123Z, s)
+	if err != nil {
+		_, err = time.Parse(time.RFC1123, s)
+	}
+	if err != nil {
+		t.Errorf("%s %q is not an RFC 822 date", what, s)
+	}
+}
+
+func validateRSS(t *testing.T, data []byte) parsedRSS {
+	t.Helper()
+	var doc parsedRSS
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("rss does not parse: %v", err)
+	}
+	if doc.Version != "2.0" {
+		t.Errorf("rss version = %q", doc.Version)
+	}
+	c := doc.Channel
+	one(t, "channel title", c.Titles)
+	one(t, "channel description", c.Descriptions)
+	var links []string
+	self := false
+	for _, l := range c.Links {
+		switch l.XMLName.Space {
+		case "":
+			links = append(links, l.Value)
+		case "http://www.w3.org/2005/Atom":
+			if l.Rel == "self" {
+				checkIRI(t, "atom:link self", l.Href)
+				self = true
+			}
+		}
+	}
+	checkIRI(t, "channel link", one(t, "channel link", links))
+	if !self {
+		t.Error("channel should have an atom:link to itself")
+	}
+	if len(c.LastBuildDate) > 1 {
+		t.Errorf("channel has %d lastBuildDates", len(c.LastBuildDate))
+	}
+	for _, d := range c.LastBuildDate {
+		checkRFC822(t, "lastBuildDate", d)
+	}
+	guids := map[string]bool{}
+	for i, item := range c.Items {
+		what := fmt.Sprintf("item %d", i)
+		if item.Title == "" && item.Description == "" {
+			t.Errorf("%s needs a title or description", what)
+		}
+		guid := one(t, what+" guid", item.GUIDs)
+		if guids[guid] {
+			t.Errorf("duplicate guid %s", guid)
+		}
+		guids[guid] = true
+		checkRFC822(t, what+" pubDate", one(t, what+" pubDate", item.PubDates))
+		for _, l := range item.Links {
+			checkIRI(t, what+" link", l)
+		}
+	}
+	return doc
+}
+
+func TestAtom(t *testing.T) {
+	f := testFeed()
+	data, err := f.Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := validateAtom(t, data)
+	if len(doc.Entries) != 2 || doc.Entries[0].Content.Body != "Fish & chips <3 #lunch" {
+		t.Errorf("entries = %+v", doc.Entries)
+	}
+	if doc.Updated[0] != "2024-05-01T12:01:00Z" {
+		t.Errorf("updated = %s, want the newest entry", doc.Updated)
+	}
+	if !strings.Contains(string(data), "Fish &amp; chips &lt;3") {
+		t.Error("content is not escaped")
+	}
+}
+
+func TestAtomWithoutFeedAuthor(t *testing.T) {
+	f := testFeed()
+	f.Author = ""
+	for i := range f.Entries {
+		f.Entries[i].Author = "grace"
+	}
+	data, err := f.Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateAtom(t, data)
+}
+
+func TestRSS(t *testing.T) {
+	data, err := testFeed().RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := validateRSS(t, data)
+	if len(doc.Channel.Items) != 2 || doc.Channel.Items[0].PubDates[0] != "Wed, 01 May 2024 12:00:00 +0000" {
+		t.Errorf("items = %+v", doc.Channel.Items)
+	}
+}
+
+func TestEmptyFeed(t *testing.T) {
+	f := testFeed()
+	f.Entries = nil
+	if got := f.LastModified(); !got.Equal(f.Updated) {
+		t.Errorf("LastModified() = %s, want %s", got, f.Updated)
+	}
+	atom, err := f.Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateAtom(t, atom)
+	rss, err := f.RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateRSS(t, rss)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func signClaims(t *testing.T, key *SigningKey, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	ss, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		t.Fatalf("SignedString: %s", err)
+	}
+	return ss
+}
+
+func validClaims() jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		Audience:  jwt.ClaimStrings{"chirpy"},
+		Subject:   uuid.NewString(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		ID:        uuid.NewString(),
+	}
+}
+
+func TestValidateJWTTypedErrors(t *testing.T) {
+	key, _ := GenerateSigningKey(AlgEdDSA, time.Now())
+	other, _ := GenerateSigningKey(AlgEdDSA, time.Now())
+	other.ID = key.ID
+	cfg := JWTConfig{Keys: NewKeySet(key), Issuer: "chirpy", Audience: "chirpy", Leeway: 5 * time.Second}
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "someone-else"
+	wrongAudience := validClaims()
+	wrongAudience.Audience = jwt.ClaimStrings{"other-service"}
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = nil
+	noIssuedAt := validClaims()
+	noIssuedAt.IssuedAt = nil
+	futureIssuedAt := validClaims()
+	futureIssuedAt.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	noJTI := validClaims()
+	noJTI.ID = ""
+
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"garbage", "not.a.jwt", ErrTokenMalformed},
+		{"wrong key", signClaims(t, other, validClaims()), ErrTokenSignature},
+		{"expired", signClaims(t, key, expired), ErrTokenExpired},
+		{"wrong issuer", signClaims(t, key, wrongIssuer), ErrTokenClaims},
+		{"wrong audience", signClaims(t, key, wrongAudience), ErrTokenClaims},
+		{"no exp", signClaims(t, key, noExpiry), ErrTokenClaims},
+		{"no iat", signClaims(t, key, noIssuedAt), ErrTokenClaims},
+		{"iat in the future", signClaims(t, key, futureIssuedAt), ErrTokenClaims},
+		{"no jti", signClaims(t, key, noJTI), ErrTokenClaims},
+	}
+	for _, c := range cases {
+		_, err := ValidateJWT(c.token, cfg)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	if _, err := ValidateJWT(signClaims(t, key, validClaims()), cfg); err != nil {
+		t.Errorf("valid token rejected: %s", err)
+	}
+}
+
+func TestValidateJWTRejectsNoneAlgorithm(t *testing.T) {
+	key, _ := GenerateSigningKey(AlgEdDSA, time.Now())
+	cfg := JWTConfig{Keys: NewKeySet(key), Issuer: "chirpy", Audience: "chirpy"}
+	token := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims())
+	token.Header["kid"] = key.ID
+	ss, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("SignedString: %s", err)
+	}
+	if _, err := ValidateJWT(ss, cfg); err == nil {
+		t.Error("alg=none token should be rejected")
+	}
+}
+
+func TestValidateJWTLeeway(t *testing.T) {
+	key, _ := GenerateSigningKey(AlgEdDSA, time.Now())
+	cfg := JWTConfig{Keys: NewKeySet(key), Issuer: "chirpy", Audience: "chirpy", Leeway: time.Minute}
+	justExpired := validClaims()
+	justExpired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second))
+	if _, err := ValidateJWT(signClaims(t, key, justExpired), cfg); err != nil {
+		t.Errorf("token within leeway rejected: %s", err)
+	}
+}
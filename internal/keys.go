@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+
+	rsaKeyBits = 2048
+)
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// SigningKey is one entry of the keyset, identified in token headers by kid.
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	PrivateKey  crypto.Signer
+	ActivatesAt time.Time
+}
+
+func GenerateSigningKey(alg string, activatesAt time.Time) (*SigningKey, error) {
+	var signer crypto.Signer
+	switch alg {
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer = priv
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		signer = priv
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	kid := make([]byte, 12)
+	_, err := rand.Read(kid)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		ID:          base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:   alg,
+		PrivateKey:  signer,
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+// MarshalPrivateKey encodes the private key as PKCS#8 PEM for storage.
+func (k *SigningKey) MarshalPrivateKey() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func ParseSigningKey(id, alg, privatePEM string, activatesAt time.Time) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data", id)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	key := &SigningKey{ID: id, Algorithm: alg, ActivatesAt: activatesAt}
+	switch priv := parsed.(type) {
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return nil, fmt.Errorf("key %s: ed25519 key stored as %s", id, alg)
+		}
+		key.PrivateKey = priv
+	case *rsa.PrivateKey:
+		if alg != AlgRS256 {
+			return nil, fmt.Errorf("key %s: rsa key stored as %s", id, alg)
+		}
+		key.PrivateKey = priv
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+	return key, nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// KeySet holds the key used to sign new tokens plus every key whose tokens
+// may still be in circulation. It is safe for concurrent use and is swapped
+// wholesale when keys rotate.
+type KeySet struct {
+	mu      sync.RWMutex
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+func NewKeySet(signing *SigningKey, verifyOnly ...*SigningKey) *KeySet {
+	ks := &KeySet{}
+	ks.Replace(signing, verifyOnly)
+	return ks
+}
+
+func (ks *KeySet) Replace(signing *SigningKey, verifyOnly []*SigningKey) {
+	keys := make(map[string]*SigningKey, len(verifyOnly)+1)
+	for _, k := range verifyOnly {
+		keys[k.ID] = k
+	}
+	if signing != nil {
+		keys[signing.ID] = signing
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.signing = signing
+	ks.keys = keys
+}
+
+func (ks *KeySet) SigningKey() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return ks.signing, nil
+}
+
+func (ks *KeySet) Key(kid string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// JWK is the public half of a signing key as published in the JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		set.Keys = append(set.Keys, k.PublicJWK())
+	}
+	return set
+}
+
+func (k *SigningKey) PublicJWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+	switch pub := k.PrivateKey.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
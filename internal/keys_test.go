@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestSignAndValidateEachAlgorithm(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		key, err := GenerateSigningKey(alg, time.Now())
+		if err != nil {
+			t.Fatalf("%s: GenerateSigningKey: %s", alg, err)
+		}
+		keys := NewKeySet(key)
+		userId := uuid.New()
+		tokenString, err := MakeJWT(userId, testJWTConfig(keys), time.Minute)
+		if err != nil {
+			t.Fatalf("%s: MakeJWT: %s", alg, err)
+		}
+		header := decodeHeader(t, tokenString)
+		if header["alg"] != alg || header["kid"] != key.ID {
+			t.Errorf("%s: unexpected header %v", alg, header)
+		}
+		claims, err := ValidateJWT(tokenString, testJWTConfig(keys))
+		if err != nil {
+			t.Fatalf("%s: ValidateJWT: %s", alg, err)
+		}
+		if got, _ := claims.UserID(); got != userId {
+			t.Errorf("%s: got user %s, want %s", alg, claims.Subject, userId)
+		}
+	}
+}
+
+func TestRotationKeepsOldTokensValid(t *testing.T) {
+	oldKey, _ := GenerateSigningKey(AlgEdDSA, time.Now().Add(-time.Hour))
+	keys := NewKeySet(oldKey)
+	userId := uuid.New()
+	oldToken, err := MakeJWT(userId, testJWTConfig(keys), time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT: %s", err)
+	}
+
+	newKey, _ := GenerateSigningKey(AlgEdDSA, time.Now())
+	keys.Replace(newKey, []*SigningKey{oldKey})
+	if _, err := ValidateJWT(oldToken, testJWTConfig(keys)); err != nil {
+		t.Fatalf("token from the previous key should still validate: %s", err)
+	}
+	newToken, _ := MakeJWT(userId, testJWTConfig(keys), time.Minute)
+	if decodeHeader(t, newToken)["kid"] != newKey.ID {
+		t.Error("new tokens should be signed with the new key")
+	}
+
+	keys.Replace(newKey, nil)
+	if _, err := ValidateJWT(oldToken, testJWTConfig(keys)); err == nil {
+		t.Error("token from a retired key should be rejected")
+	}
+}
+
+func TestValidateRejectsAlgorithmMismatch(t *testing.T) {
+	key, _ := GenerateSigningKey(AlgRS256, time.Now())
+	keys := NewKeySet(key)
+	// an HS256 token claiming the RSA key's kid must not be accepted
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: uuid.New().String()})
+	forged.Header["kid"] = key.ID
+	tokenString, err := forged.SignedString([]byte("guess"))
+	if err != nil {
+		t.Fatalf("SignedString: %s", err)
+	}
+	if _, err := ValidateJWT(tokenString, testJWTConfig(keys)); err == nil {
+		t.Error("token with mismatched algorithm should be rejected")
+	}
+}
+
+func TestSigningKeyPEMRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		key, _ := GenerateSigningKey(alg, time.Now())
+		encoded, err := key.MarshalPrivateKey()
+		if err != nil {
+			t.Fatalf("%s: MarshalPrivateKey: %s", alg, err)
+		}
+		parsed, err := ParseSigningKey(key.ID, alg, encoded, key.ActivatesAt)
+		if err != nil {
+			t.Fatalf("%s: ParseSigningKey: %s", alg, err)
+		}
+		if parsed.PublicJWK() != key.PublicJWK() {
+			t.Errorf("%s: public key changed across PEM round trip", alg)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	ed, _ := GenerateSigningKey(AlgEdDSA, time.Now())
+	rsaKey, _ := GenerateSigningKey(AlgRS256, time.Now())
+	keys := NewKeySet(ed, rsaKey)
+	data, err := json.Marshal(keys.JWKS())
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	var doc struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	json.Unmarshal(data, &doc)
+	if len(doc.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(doc.Keys))
+	}
+	for _, k := range doc.Keys {
+		switch k["kty"] {
+		case "OKP":
+			if k["crv"] != "Ed25519" || k["x"] == "" || k["kid"] != ed.ID {
+				t.Errorf("bad OKP key: %v", k)
+			}
+		case "RSA":
+			if k["n"] == "" || k["e"] != "AQAB" || k["kid"] != rsaKey.ID {
+				t.Errorf("bad RSA key: %v", k)
+			}
+		default:
+			t.Errorf("unexpected key type: %v", k)
+		}
+		if _, ok := k["d"]; ok {
+			t.Error("JWKS must not contain private key material")
+		}
+	}
+}
+
+func testJWTConfig(keys *KeySet) JWTConfig {
+	return JWTConfig{Keys: keys, Issuer: "chirpy", Audience: "chirpy"}
+}
+
+func decodeHeader(t *testing.T, tokenString string) map[string]interface{} {
+	t.Helper()
+	raw, err := base64.RawURLEncoding.DecodeString(strings.Split(tokenString, ".")[0])
+	if err != nil {
+		t.Fatalf("decode header: %s", err)
+	}
+	header := map[string]interface{}{}
+	json.Unmarshal(raw, &header)
+	return header
+}
@@ -0,0 +1,26 @@
+package auth
+
+import "time"
+
+// Backoff says how long logins are blocked after repeated failures: not at
+// all for the first Free failures, then Base, doubling with every further
+// failure up to Max.
+type Backoff struct {
+	Free int
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b Backoff) Delay(failures int) time.Duration {
+	if failures <= b.Free {
+		return 0
+	}
+	delay := b.Base
+	for i := b.Free + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= b.Max {
+			return b.Max
+		}
+	}
+	return min(delay, b.Max)
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Free: 3, Base: 30 * time.Second, Max: 10 * time.Minute}
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, 30 * time.Second},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{9, 10 * time.Minute},
+		{1000, 10 * time.Minute},
+	}
+	for _, tc := range cases {
+		if got := b.Delay(tc.failures); got != tc.want {
+			t.Errorf("Delay(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
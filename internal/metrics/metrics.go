@@ -0,0 +1,248 @@
+// Package metrics keeps Chirpy's Prometheus registry: HTTP requests by
+// route and status, database query timings, and a few application gauges
+// and counters. The admin page reads from the same registry that /metrics
+// exposes, so the two never disagree.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chirpy"
+
+// unmatchedRoute labels requests no route pattern matched, so that probes
+// for random paths don't each get a series.
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	// FileServerHits counts requests for the static app and assets.
+	FileServerHits prometheus.Counter
+	ChirpsCreated  prometheus.Counter
+	// ActiveUsers is set from the database by whoever owns it.
+	ActiveUsers prometheus.Gauge
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		FileServerHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fileserver_hits_total",
+			Help:      "Requests for the static app and assets.",
+		}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Chirps posted.",
+		}),
+		ActiveUsers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_users",
+			Help:      "Users who made an authenticated request in the last 24 hours.",
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern and status code.",
+		}, []string{"route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to serve HTTP requests by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time to run database queries by query name.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"query"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_query_errors_total",
+			Help:      "Database queries that failed, by query name.",
+		}, []string{"query"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.FileServerHits,
+		m.ChirpsCreated,
+		m.ActiveUsers,
+		m.requests,
+		m.requestDuration,
+		m.queryDuration,
+		m.queryErrors,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Value is the sum of every series of a counter or gauge, or 0 when the
+// metric has no series yet.
+func (m *Metrics) Value(name string) (float64, error) {
+	families, err := m.Registry.Gather()
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.Counter != nil:
+				total += metric.Counter.GetValue()
+			case metric.Gauge != nil:
+				total += metric.Gauge.GetValue()
+			}
+		}
+	}
+	return total, nil
+}
+
+// Middleware records every request handled by next, which should be the
+// ServeMux so that the route is the pattern it matched rather than the
+// path.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		route := r.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(route, strconv.Itoa(rec.status)).Inc()
+	})
+}
+
+// statusRecorder remembers the status code written. Unwrap and Hijack keep
+// http.ResponseController and WebSocket upgrades working through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func (rec *statusRecorder) Flush() {
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rec.ResponseWriter).Hijack()
+}
+
+// DBTX matches the interface sqlc's Queries run against, which *sql.DB and
+// *sql.Tx both satisfy.
+type DBTX interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// DB times the queries run through db, labelled by their sqlc name.
+func (m *Metrics) DB(db DBTX) DBTX {
+	return instrumentedDB{db: db, m: m}
+}
+
+type instrumentedDB struct {
+	db DBTX
+	m  *Metrics
+}
+
+func (i instrumentedDB) observe(query string, start time.Time, err error) {
+	name := QueryName(query)
+	i.m.queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		i.m.queryErrors.WithLabelValues(name).Inc()
+	}
+}
+
+func (i instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := i.db.ExecContext(ctx, query, args...)
+	i.observe(query, start, err)
+	return result, err
+}
+
+func (i instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return i.db.PrepareContext(ctx, query)
+}
+
+func (i instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	i.observe(query, start, err)
+	return rows, err
+}
+
+// QueryRowContext runs the query before returning, so its time is all
+// here; the error surfaces later from Scan.
+func (i instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	i.observe(query, start, row.Err())
+	return row
+}
+
+// QueryName reads the name from the "-- name: GetUser :one" line sqlc puts
+// at the top of every query, or returns "other".
+func QueryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "other"
+	}
+	line, _, _ := strings.Cut(rest, "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "other"
+	}
+	return fields[0]
+}
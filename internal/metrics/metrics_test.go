@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func value(t *testing.T, m *Metrics, name string) float64 {
+	t.Helper()
+	v, err := m.Value(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("chirpID") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("GET /api/stream", func(w http.ResponseWriter, r *http.Request) {
+		err := http.NewResponseController(w).Flush()
+		if err != nil {
+			t.Errorf("Flush() through the recorder = %v", err)
+		}
+	})
+	srv := httptest.NewServer(m.Middleware(mux))
+	defer srv.Close()
+
+	for _, path := range []string{"/api/chirps/1", "/api/chirps/2", "/api/chirps/missing", "/nope/1", "/nope/2", "/api/stream"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposition := rec.Body.String()
+	for _, want := range []string{
+		`chirpy_http_requests_total{code="200",route="GET /api/chirps/{chirpID}"} 2`,
+		`chirpy_http_requests_total{code="404",route="GET /api/chirps/{chirpID}"} 1`,
+		`chirpy_http_requests_total{code="404",route="unmatched"} 2`,
+		`chirpy_http_requests_total{code="200",route="GET /api/stream"} 1`,
+		`chirpy_http_request_duration_seconds_count{route="GET /api/chirps/{chirpID}"} 3`,
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+	if got := value(t, m, "chirpy_http_requests_total"); got != 6 {
+		t.Errorf("requests = %v, want 6", got)
+	}
+}
+
+func TestValue(t *testing.T) {
+	m := New()
+	if got := value(t, m, "chirpy_chirps_created_total"); got != 0 {
+		t.Errorf("fresh counter = %v", got)
+	}
+	m.ChirpsCreated.Inc()
+	m.ChirpsCreated.Inc()
+	m.ActiveUsers.Set(7)
+	if got := value(t, m, "chirpy_chirps_created_total"); got != 2 {
+		t.Errorf("chirps created = %v, want 2", got)
+	}
+	if got := value(t, m, "chirpy_active_users"); got != 7 {
+		t.Errorf("active users = %v, want 7", got)
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	cases := map[string]string{
+		"-- name: GetUserById :one\nSELECT 1": "GetUserById",
+		"-- name: PruneOutbox :exec\nDELETE":  "PruneOutbox",
+		"SELECT 1":                            "other",
+		"-- name: \nSELECT 1":                 "other",
+	}
+	for query, want := range cases {
+		if got := QueryName(query); got != want {
+			t.Errorf("QueryName(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+// fakeDB answers Exec with err and nothing else.
+type fakeDB struct {
+	DBTX
+	err error
+}
+
+func (f fakeDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, f.err
+}
+
+func TestDB(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+	m.DB(fakeDB{}).ExecContext(ctx, "-- name: PruneOutbox :exec\nDELETE FROM outbox")
+	m.DB(fakeDB{err: errors.New("boom")}).ExecContext(ctx, "-- name: PruneOutbox :exec\nDELETE FROM outbox")
+	m.DB(fakeDB{err: sql.ErrNoRows}).ExecContext(ctx, "UPDATE x")
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposition := rec.Body.String()
+	for _, want := range []string{
+		`chirpy_db_query_duration_seconds_count{query="PruneOutbox"} 2`,
+		`chirpy_db_query_duration_seconds_count{query="other"} 1`,
+		`chirpy_db_query_errors_total{query="PruneOutbox"} 1`,
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+	if strings.Contains(exposition, `chirpy_db_query_errors_total{query="other"}`) {
+		t.Error("sql.ErrNoRows counted as an error")
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+)
+
+const PKCEMethodS256 = "S256"
+
+// ValidCodeVerifier reports whether v is a PKCE code verifier as defined by
+// RFC 7636: 43 to 128 characters from the unreserved URI set.
+func ValidCodeVerifier(v string) bool {
+	if len(v) < 43 || len(v) > 128 {
+		return false
+	}
+	for _, c := range v {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// PKCEChallenge derives the S256 code challenge for a verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks a code verifier against the S256 challenge sent with the
+// authorization request. Only S256 is supported; plain would let anyone who
+// saw the authorization request redeem the code.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !ValidCodeVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// ValidRedirectURI accepts absolute https URIs without a fragment, and http
+// only for loopback addresses used by native apps.
+func ValidRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("PKCEChallenge = %q, want %q", got, challenge)
+	}
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("VerifyPKCE rejected the RFC example")
+	}
+	if VerifyPKCE(verifier+"x", challenge) {
+		t.Error("VerifyPKCE accepted the wrong verifier")
+	}
+	if VerifyPKCE("short", PKCEChallenge("short")) {
+		t.Error("VerifyPKCE accepted a verifier shorter than 43 characters")
+	}
+	if ValidCodeVerifier(strings.Repeat("a", 42) + "!") {
+		t.Error("ValidCodeVerifier accepted a reserved character")
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	cases := map[string]bool{
+		"https://app.example/callback":      true,
+		"http://127.0.0.1:8123/callback":    true,
+		"http://localhost/cb":               true,
+		"http://app.example/callback":       false,
+		"https://app.example/callback#frag": false,
+		"/relative":                         false,
+		"javascript:alert(1)":               false,
+	}
+	for uri, want := range cases {
+		if got := ValidRedirectURI(uri); got != want {
+			t.Errorf("ValidRedirectURI(%q) = %v, want %v", uri, got, want)
+		}
+	}
+}
+
+func TestScopedJWT(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %s", err)
+	}
+	cfg := testJWTConfig(NewKeySet(key))
+	userId := uuid.New()
+
+	session, err := MakeJWT(userId, cfg, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT: %s", err)
+	}
+	claims, err := ValidateJWT(session, cfg)
+	if err != nil {
+		t.Fatalf("ValidateJWT(session): %s", err)
+	}
+	if claims.Scopes() != nil {
+		t.Errorf("session token scopes = %v, want nil", claims.Scopes())
+	}
+
+	scoped, err := MakeScopedJWT(userId, "client-1", []string{ScopeChirpsRead}, cfg, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT: %s", err)
+	}
+	claims, err = ValidateJWT(scoped, cfg)
+	if err != nil {
+		t.Fatalf("ValidateJWT(scoped): %s", err)
+	}
+	if claims.ClientID != "client-1" {
+		t.Errorf("client_id = %q, want client-1", claims.ClientID)
+	}
+	if got := claims.Scopes(); len(got) != 1 || got[0] != ScopeChirpsRead {
+		t.Errorf("scopes = %v, want [%s]", got, ScopeChirpsRead)
+	}
+
+	none, err := MakeScopedJWT(userId, "client-1", nil, cfg, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT: %s", err)
+	}
+	claims, _ = ValidateJWT(none, cfg)
+	if got := claims.Scopes(); got == nil || len(got) != 0 {
+		t.Errorf("scopes = %#v, want empty but non-nil", got)
+	}
+
+	if _, err := MakeScopedJWT(userId, "", nil, cfg, time.Minute); err == nil {
+		t.Error("MakeScopedJWT accepted an empty client id")
+	}
+}
@@ -0,0 +1,210 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that hands out whatever ID token the test prepared.
+type mockProvider struct {
+	t        *testing.T
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	kid      string
+	idToken  string
+	jwksHits int
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	m := &mockProvider{t: t, key: key, kid: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.jwksHits++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: m.kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "chirpy" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken, "token_type": "Bearer"})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "chirpy",
+		"sub":            "user-42",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "Ada@Example.com",
+		"email_verified": "true",
+	}
+}
+
+func (m *mockProvider) sign(claims jwt.MapClaims) string {
+	m.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	ss, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatalf("SignedString: %s", err)
+	}
+	return ss
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       m.server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://chirpy.example/auth/oidc/mock/callback",
+	})
+}
+
+func TestLoginFlow(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %s", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") || q.Get("state") != "the-state" ||
+		q.Get("nonce") != "the-nonce" || q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "chirpy" {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+
+	m.idToken = m.sign(m.claims("the-nonce"))
+	raw, err := p.Exchange(ctx, "good-code", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange: %s", err)
+	}
+	claims, err := p.VerifyIDToken(ctx, raw, "the-nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %s", err)
+	}
+	if claims.Subject != "user-42" || !claims.IsEmailVerified() || claims.Email != "Ada@Example.com" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	if _, err := p.Exchange(ctx, "bad-code", "verifier"); err == nil {
+		t.Error("Exchange accepted a bad code")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	with := func(edit func(jwt.MapClaims)) string {
+		claims := m.claims("n")
+		edit(claims)
+		return m.sign(claims)
+	}
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, m.claims("n"))
+	hmacToken, _ := hmac.SignedString([]byte("s3cret"))
+
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"wrong nonce", m.sign(m.claims("other")), ErrNonceMismatch},
+		{"wrong issuer", with(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }), ErrInvalidIDToken},
+		{"wrong audience", with(func(c jwt.MapClaims) { c["aud"] = "someone-else" }), ErrInvalidIDToken},
+		{"foreign azp", with(func(c jwt.MapClaims) { c["aud"] = []string{"chirpy", "other"}; c["azp"] = "other" }), ErrInvalidIDToken},
+		{"expired", with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), ErrInvalidIDToken},
+		{"no subject", with(func(c jwt.MapClaims) { delete(c, "sub") }), ErrInvalidIDToken},
+		{"hmac with client secret", hmacToken, ErrInvalidIDToken},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := p.VerifyIDToken(ctx, tc.token, "n")
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, m.sign(m.claims("n")), "n"); err != nil {
+		t.Fatalf("VerifyIDToken: %s", err)
+	}
+	m.kid = "key-2"
+	rotated := m.sign(m.claims("n"))
+	if _, err := p.VerifyIDToken(ctx, rotated, "n"); err == nil {
+		t.Fatal("accepted an unknown kid before the refetch window")
+	}
+	p.keysFetched = time.Now().Add(-2 * keyRefreshWait)
+	if _, err := p.VerifyIDToken(ctx, rotated, "n"); err != nil {
+		t.Fatalf("VerifyIDToken after rotation: %s", err)
+	}
+	if m.jwksHits != 2 {
+		t.Errorf("jwks fetched %d times, want 2", m.jwksHits)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	p := NewProvider(Config{Issuer: m.server.URL + "/", ClientID: "chirpy"})
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatal("accepted a discovery document for a different issuer")
+	}
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Argon2Params are the argon2id cost parameters. MemoryKiB is in kibibytes.
+type Argon2Params struct {
+	Time      uint32
+	MemoryKiB uint32
+	Threads   uint8
+}
+
+// PasswordHashing says how new password hashes are made. Hashes made with
+// other settings still verify; NeedsRehash tells the caller to upgrade them.
+type PasswordHashing struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// DefaultPasswordHashing is argon2id with the second recommended option
+// from RFC 9106 (64 MiB, three passes).
+func DefaultPasswordHashing() PasswordHashing {
+	return PasswordHashing{
+		Algorithm:  HashArgon2id,
+		Argon2:     Argon2Params{Time: 3, MemoryKiB: 64 * 1024, Threads: 4},
+		BcryptCost: 12,
+	}
+}
+
+func (h PasswordHashing) Validate() error {
+	switch h.Algorithm {
+	case HashArgon2id:
+		if h.Argon2.Time < 1 || h.Argon2.MemoryKiB < 8*uint32(h.Argon2.Threads) || h.Argon2.Threads < 1 {
+			return fmt.Errorf("invalid argon2id parameters %+v", h.Argon2)
+		}
+	case HashBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unsupported password hash %q", h.Algorithm)
+	}
+	return nil
+}
+
+func (h PasswordHashing) Hash(password string) (string, error) {
+	if h.Algorithm == HashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hash), err
+	}
+	salt := make([]byte, argon2SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	p := h.Argon2
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKiB, p.Threads, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.MemoryKiB, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// NeedsRehash reports whether hash was made with a different algorithm or
+// cost than h and should be replaced after the next successful login.
+func (h PasswordHashing) NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, _, _, err := parseArgon2Hash(hash)
+		return err != nil || h.Algorithm != HashArgon2id || params != h.Argon2
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || h.Algorithm != HashBcrypt || cost != h.BcryptCost
+}
+
+func parseArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	// $argon2id$v=19$m=65536,t=3,p=4$salt$key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	var p Argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.MemoryKiB, &p.Time, &p.Threads)
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("bad argon2 parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("bad argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, errors.New("bad argon2 key")
+	}
+	return p, salt, key, nil
+}
+
+func checkArgon2Hash(password, hash string) error {
+	p, salt, key, err := parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKiB, p.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordBreached = errors.New("password appears in a known data breach")
+)
+
+// PasswordPolicy is what a new password has to satisfy. Lengths count
+// characters, not bytes.
+//
+// BreachedDir, when set, holds a local copy of the Pwned Passwords range
+// files: one file per 5-character SHA-1 prefix (e.g. "21BD1.txt") listing
+// "SUFFIX:COUNT" lines. Only the file for the password's prefix is read.
+type PasswordPolicy struct {
+	MinLength   int
+	MaxLength   int
+	BreachedDir string
+}
+
+func (p PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrPasswordTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: use at most %d characters", ErrPasswordTooLong, p.MaxLength)
+	}
+	if p.BreachedDir == "" {
+		return nil
+	}
+	breached, err := p.isBreached(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+func (p PasswordPolicy) isBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+	f, err := os.Open(filepath.Join(p.BreachedDir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// padded range files list decoy suffixes with a count of 0
+		if strings.EqualFold(entry, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func cheapArgon2() PasswordHashing {
+	return PasswordHashing{Algorithm: HashArgon2id, Argon2: Argon2Params{Time: 1, MemoryKiB: 64, Threads: 1}, BcryptCost: bcrypt.MinCost}
+}
+
+func TestPasswordHashing(t *testing.T) {
+	argon := cheapArgon2()
+	hash, err := argon.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %s", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+	if err := CheckPasswordHash("correct horse", hash); err != nil {
+		t.Errorf("CheckPasswordHash(argon2id): %s", err)
+	}
+	if err := CheckPasswordHash("wrong horse", hash); err == nil {
+		t.Error("CheckPasswordHash accepted a wrong password")
+	}
+	if argon.NeedsRehash(hash) {
+		t.Error("fresh hash needs rehash")
+	}
+	stronger := argon
+	stronger.Argon2.Time = 2
+	if !stronger.NeedsRehash(hash) {
+		t.Error("hash with old cost doesn't need rehash")
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %s", err)
+	}
+	if err := CheckPasswordHash("correct horse", string(legacy)); err != nil {
+		t.Errorf("CheckPasswordHash(bcrypt): %s", err)
+	}
+	if !argon.NeedsRehash(string(legacy)) {
+		t.Error("bcrypt hash doesn't need rehash under argon2id")
+	}
+	bcryptOnly := PasswordHashing{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost}
+	if bcryptOnly.NeedsRehash(string(legacy)) {
+		t.Error("bcrypt hash with matching cost needs rehash")
+	}
+
+	if err := CheckPasswordHash("x", "$argon2id$v=19$m=64,t=1,p=1$broken"); err == nil {
+		t.Error("CheckPasswordHash accepted a malformed hash")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 16, BreachedDir: dir}
+	cases := []struct {
+		password string
+		want     error
+	}{
+		{"a", ErrPasswordTooShort},
+		{"pässwörd", nil},
+		{strings.Repeat("x", 17), ErrPasswordTooLong},
+		{"password", ErrPasswordBreached},
+		{"tr0ub4dor&3", nil},
+	}
+	for _, tc := range cases {
+		if err := policy.Check(tc.password); !errors.Is(err, tc.want) {
+			t.Errorf("Check(%q) = %v, want %v", tc.password, err, tc.want)
+		}
+	}
+}
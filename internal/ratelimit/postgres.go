@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"context"
+
+	"main.go/internal/databases"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every
+// instance shares them. Each Take is a single atomic upsert.
+type PostgresStore struct {
+	Queries *databases.Queries
+}
+
+func (s PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	row, err := s.Queries.TakeRateLimitToken(ctx, databases.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(limit.Requests),
+		Rate:  limit.rate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result(limit, row.Tokens, row.LastAllowed), nil
+}
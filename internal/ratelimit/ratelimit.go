@@ -0,0 +1,132 @@
+// Package ratelimit implements token-bucket rate limits with an in-memory
+// store for a single instance and a Postgres store shared between instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests requests per Per, all of which may be used in a
+// burst. The bucket refills continuously.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// ParseLimit reads limits written as "30/1m" or "1000/24h".
+func ParseLimit(s string) (Limit, error) {
+	requests, per, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q: want REQUESTS/DURATION", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q: requests must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: bad duration", s)
+	}
+	return Limit{Requests: n, Per: d}, nil
+}
+
+// Result describes the bucket after a request was counted against it.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed; zero
+	// when this one was.
+	RetryAfter time.Duration
+}
+
+// Store takes one token from the bucket named key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result builds a Result from the tokens left after the request.
+func result(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     seconds((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(s, 0) * float64(time.Second))
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in process memory. Limits are per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+const sweepEvery = 4096
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.takes++
+	if s.takes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Requests), b.tokens+now.Sub(b.updated).Seconds()*limit.rate())
+	b.updated = now
+	if b.tokens < 1 {
+		return result(limit, b.tokens, false), nil
+	}
+	b.tokens--
+	return result(limit, b.tokens, true), nil
+}
+
+// sweep drops buckets untouched for a day; every limit we configure has
+// refilled by then, so forgetting them changes nothing.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > 24*time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
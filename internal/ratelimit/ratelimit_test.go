@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("30/1m")
+	if err != nil || l.Requests != 30 || l.Per != time.Minute {
+		t.Fatalf("ParseLimit(30/1m) = %+v, %v", l, err)
+	}
+	for _, bad := range []string{"", "30", "0/1m", "-1/1m", "x/1m", "30/0s", "30/soon"} {
+		if _, err := ParseLimit(bad); err == nil {
+			t.Errorf("ParseLimit(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := Limit{Requests: 3, Per: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		res, _ := s.Take(ctx, "k", limit)
+		if !res.Allowed || res.Remaining != i || res.Limit != 3 {
+			t.Fatalf("take %d: %+v", 3-i, res)
+		}
+	}
+	res, _ := s.Take(ctx, "k", limit)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Fatalf("over limit: %+v", res)
+	}
+	if other, _ := s.Take(ctx, "other", limit); !other.Allowed {
+		t.Fatal("buckets are not independent")
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	res, _ = s.Take(ctx, "k", limit)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refill: %+v", res)
+	}
+
+	now = now.Add(time.Hour)
+	res, _ = s.Take(ctx, "k", limit)
+	if !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("refill is not capped at the burst: %+v", res)
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var AllScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// PersonalTokenPrefix marks personal access tokens so the auth path can tell
+// them apart from JWTs without trying to parse them.
+const PersonalTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return PersonalTokenPrefix + hex.EncodeToString(b), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
+
+// NormalizeScopes rejects unknown scopes and returns the rest sorted and
+// without duplicates.
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			out = append(out, scope)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range AllScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+// Package stream fans events out to many open connections. Each connection
+// has a filter and a small buffer; a connection that can't keep up is
+// dropped rather than slowing everyone else down, and can resume from the
+// hub's recent history when it reconnects.
+package stream
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	ID    string
+	Event string
+	Data  []byte
+
+	// AuthorID is set on chirp messages and checked against author and
+	// home timeline filters.
+	AuthorID uuid.UUID
+	// Tags are the hashtags of a chirp, lower case and without the '#'.
+	Tags []string
+	// Recipient, when set, limits the message to that user's connections
+	// and skips the other filters.
+	Recipient uuid.UUID
+}
+
+// Filter says which chirp messages a connection wants. The zero Filter
+// passes everything.
+type Filter struct {
+	// UserID is the connection's user; messages addressed to them always
+	// pass.
+	UserID   uuid.UUID
+	AuthorID uuid.UUID
+	Tag      string
+	// Home limits chirps to the user's own and those of Following.
+	Home      bool
+	Following map[uuid.UUID]bool
+	// AddressedOnly passes only messages addressed to UserID;
+	// ExcludeAddressed passes none of them. A connection holding several
+	// subscriptions uses them to get each addressed message once.
+	AddressedOnly    bool
+	ExcludeAddressed bool
+}
+
+func (f Filter) Match(m Message) bool {
+	if m.Recipient != uuid.Nil {
+		return !f.ExcludeAddressed && m.Recipient == f.UserID
+	}
+	if f.AddressedOnly {
+		return false
+	}
+	if f.AuthorID != uuid.Nil && m.AuthorID != f.AuthorID {
+		return false
+	}
+	if f.Tag != "" && m.Tags != nil && !contains(m.Tags, f.Tag) {
+		return false
+	}
+	if f.Home && m.AuthorID != f.UserID && !f.Following[m.AuthorID] {
+		return false
+	}
+	return true
+}
+
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxTagLength is the longest tag, in characters.
+const MaxTagLength = 64
+
+// isTagChar says what a tag is made of: letters and digits in any script,
+// and underscores.
+func isTagChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Tags returns the distinct hashtags in a chirp body: a '#' starting a
+// word, followed by the tag characters up to the first other one. Tags are
+// lower case and without the '#'.
+func Tags(body string) []string {
+	tags := []string{}
+	for _, word := range strings.Fields(body) {
+		if len(word) < 2 || word[0] != '#' {
+			continue
+		}
+		tag := word[1:]
+		if end := strings.IndexFunc(tag, func(r rune) bool { return !isTagChar(r) }); end >= 0 {
+			tag = tag[:end]
+		}
+		tag = strings.ToLower(tag)
+		if tag != "" && utf8.RuneCountInString(tag) <= MaxTagLength && !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ParseTag normalises a tag given on its own, such as in a URL, with or
+// without its '#'. It reports false for anything Tags would never return.
+func ParseTag(s string) (string, bool) {
+	tag := strings.ToLower(strings.TrimPrefix(s, "#"))
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength || strings.IndexFunc(tag, func(r rune) bool { return !isTagChar(r) }) >= 0 {
+		return "", false
+	}
+	return tag, true
+}
+
+type Subscription struct {
+	// C receives matching messages. It is closed when the subscription
+	// ends, including when the hub drops a connection that fell behind.
+	C      <-chan Message
+	c      chan Message
+	filter Filter
+}
+
+type Hub struct {
+	mu      sync.RWMutex
+	subs    map[*Subscription]struct{}
+	history []Message
+	next    int
+	full    bool
+	buffer  int
+}
+
+// NewHub keeps the last history messages for resuming and gives every
+// connection room for buffer undelivered messages.
+func NewHub(history, buffer int) *Hub {
+	return &Hub{
+		subs:    map[*Subscription]struct{}{},
+		history: make([]Message, history),
+		buffer:  buffer,
+	}
+}
+
+// Subscribe starts a subscription. When lastID is set, the matching
+// messages published after it come back as the backlog; ok is false when
+// lastID is too old to be in the history, and the caller has missed an
+// unknown number of messages.
+func (h *Hub) Subscribe(f Filter, lastID string) (sub *Subscription, backlog []Message, ok bool) {
+	c := make(chan Message, h.buffer)
+	sub = &Subscription{C: c, c: c, filter: f}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub] = struct{}{}
+	if lastID == "" {
+		return sub, nil, true
+	}
+	found := false
+	for _, m := range h.ordered() {
+		if found && f.Match(m) {
+			backlog = append(backlog, m)
+		}
+		if m.ID == lastID {
+			found = true
+		}
+	}
+	if !found {
+		return sub, nil, false
+	}
+	return sub, backlog, true
+}
+
+// ordered returns the history oldest first. Callers hold h.mu.
+func (h *Hub) ordered() []Message {
+	if !h.full {
+		return h.history[:h.next]
+	}
+	return append(append([]Message{}, h.history[h.next:]...), h.history[:h.next]...)
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.c)
+	}
+}
+
+func (h *Hub) Publish(m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.history) > 0 {
+		h.history[h.next] = m
+		h.next = (h.next + 1) % len(h.history)
+		h.full = h.full || h.next == 0
+	}
+	for sub := range h.subs {
+		if !sub.filter.Match(m) {
+			continue
+		}
+		select {
+		case sub.c <- m:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// Follow adds followee to the home timeline of follower's open
+// connections.
+func (h *Hub) Follow(follower, followee uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub.filter.Home && sub.filter.UserID == follower {
+			if sub.filter.Following == nil {
+				sub.filter.Following = map[uuid.UUID]bool{}
+			}
+			sub.filter.Following[followee] = true
+		}
+	}
+}
+
+// Unfollow takes followee off the home timeline of follower's open
+// connections.
+func (h *Hub) Unfollow(follower, followee uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub.filter.Home && sub.filter.UserID == follower {
+			delete(sub.filter.Following, followee)
+		}
+	}
+}
+
+// Len is the number of open subscriptions.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTags(t *testing.T) {
+	got := Tags("Hello #Go and #go, #gophers! # #_x #Café #東京 #c++ #a-b")
+	want := []string{"go", "gophers", "_x", "café", "東京", "c", "a"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	for in, want := range map[string]string{"Go": "go", "#go": "go", "東京": "東京", "Café": "café", "_x": "_x"} {
+		if got, ok := ParseTag(in); !ok || got != want {
+			t.Errorf("ParseTag(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "#", "a-b", "go!", "a b", strings.Repeat("x", MaxTagLength+1)} {
+		if got, ok := ParseTag(in); ok {
+			t.Errorf("ParseTag(%q) = %q, want rejected", in, got)
+		}
+	}
+	// every tag Tags finds is one ParseTag accepts unchanged
+	for _, tag := range Tags("#Go #東京 #x_1 #c++") {
+		if got, ok := ParseTag(tag); !ok || got != tag {
+			t.Errorf("ParseTag(%q) = %q, %v", tag, got, ok)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	me, friend, stranger := uuid.New(), uuid.New(), uuid.New()
+	chirp := func(author uuid.UUID, tags ...string) Message {
+		return Message{AuthorID: author, Tags: tags}
+	}
+	cases := []struct {
+		name   string
+		filter Filter
+		msg    Message
+		want   bool
+	}{
+		{"everything", Filter{UserID: me}, chirp(stranger), true},
+		{"author match", Filter{AuthorID: friend}, chirp(friend), true},
+		{"author mismatch", Filter{AuthorID: friend}, chirp(stranger), false},
+		{"tag match", Filter{Tag: "go"}, chirp(stranger, "go"), true},
+		{"tag mismatch", Filter{Tag: "go"}, chirp(stranger, "rust"), false},
+		{"untagged deletion", Filter{Tag: "go"}, Message{AuthorID: stranger}, true},
+		{"home own", Filter{UserID: me, Home: true}, chirp(me), true},
+		{"home followed", Filter{UserID: me, Home: true, Following: map[uuid.UUID]bool{friend: true}}, chirp(friend), true},
+		{"home stranger", Filter{UserID: me, Home: true, Following: map[uuid.UUID]bool{friend: true}}, chirp(stranger), false},
+		{"addressed to me", Filter{UserID: me, AuthorID: friend}, Message{Recipient: me}, true},
+		{"addressed to someone else", Filter{UserID: me}, Message{Recipient: friend}, false},
+		{"addressed only", Filter{UserID: me, AddressedOnly: true}, Message{Recipient: me}, true},
+		{"addressed only skips chirps", Filter{UserID: me, AddressedOnly: true}, chirp(me), false},
+		{"exclude addressed", Filter{UserID: me, ExcludeAddressed: true}, Message{Recipient: me}, false},
+		{"exclude addressed keeps chirps", Filter{UserID: me, ExcludeAddressed: true}, chirp(friend), true},
+	}
+	for _, tc := range cases {
+		if got := tc.filter.Match(tc.msg); got != tc.want {
+			t.Errorf("%s: Match() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	h := NewHub(3, 8)
+	for i := 1; i <= 4; i++ {
+		h.Publish(Message{ID: fmt.Sprint(i)})
+	}
+	// history holds 2, 3 and 4
+	_, backlog, ok := h.Subscribe(Filter{}, "2")
+	if !ok || len(backlog) != 2 || backlog[0].ID != "3" || backlog[1].ID != "4" {
+		t.Fatalf("resume from 2: ok=%v backlog=%v", ok, backlog)
+	}
+	if _, _, ok := h.Subscribe(Filter{}, "1"); ok {
+		t.Error("resume from an id older than the history succeeded")
+	}
+	if _, backlog, ok := h.Subscribe(Filter{}, "4"); !ok || len(backlog) != 0 {
+		t.Errorf("resume from newest: ok=%v backlog=%v", ok, backlog)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	h := NewHub(0, 2)
+	slow, _, _ := h.Subscribe(Filter{}, "")
+	fast, _, _ := h.Subscribe(Filter{}, "")
+	for i := 0; i < 3; i++ {
+		h.Publish(Message{ID: fmt.Sprint(i)})
+		<-fast.C
+	}
+	if h.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", h.Len())
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("slow subscriber got %d messages before being closed, want 2", n)
+	}
+}
+
+func TestHubFollow(t *testing.T) {
+	me, friend := uuid.New(), uuid.New()
+	h := NewHub(0, 4)
+	sub, _, _ := h.Subscribe(Filter{UserID: me, Home: true}, "")
+	h.Publish(Message{ID: "1", AuthorID: friend})
+	h.Follow(me, friend)
+	h.Publish(Message{ID: "2", AuthorID: friend})
+	h.Unfollow(me, friend)
+	h.Publish(Message{ID: "3", AuthorID: friend})
+	h.Unsubscribe(sub)
+	var got []string
+	for m := range sub.C {
+		got = append(got, m.ID)
+	}
+	if !slices.Equal(got, []string{"2"}) {
+		t.Errorf("got %v, want [2]", got)
+	}
+}
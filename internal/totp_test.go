@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors, truncated to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range cases {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode: %s", err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %s", err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	step, err := ValidateTOTP(secret, code, now)
+	if err != nil {
+		t.Fatalf("previous step should be accepted: %s", err)
+	}
+	if step != now.Unix()/30-1 {
+		t.Errorf("step = %d, want %d", step, now.Unix()/30-1)
+	}
+	old, _ := TOTPCode(secret, now.Add(-2*time.Minute))
+	if _, err := ValidateTOTP(secret, old, now); err == nil {
+		t.Error("code from two minutes ago should be rejected")
+	}
+	if _, err := ValidateTOTP(secret, "12345", now); err == nil {
+		t.Error("short code should be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "user@example.com", "Chirpy")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Chirpy") {
+		t.Errorf("uri is missing parameters: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %s", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("bad recovery code format: %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Errorf("NormalizeRecoveryCode did not round-trip %q", code)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhookVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	current, previous := []byte("current-secret"), []byte("previous-secret")
+	v := WebhookVerifier{Secrets: [][]byte{current, previous}, Tolerance: 5 * time.Minute}
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+
+	cases := []struct {
+		name   string
+		header string
+		body   []byte
+		want   error
+	}{
+		{"current secret", SignWebhook(current, now, body), body, nil},
+		{"previous secret", SignWebhook(previous, now, body), body, nil},
+		{"within tolerance", SignWebhook(current, now.Add(-4*time.Minute), body), body, nil},
+		{"clock ahead", SignWebhook(current, now.Add(4*time.Minute), body), body, nil},
+		{"too old", SignWebhook(current, now.Add(-6*time.Minute), body), body, ErrWebhookExpired},
+		{"too new", SignWebhook(current, now.Add(6*time.Minute), body), body, ErrWebhookExpired},
+		{"unknown secret", SignWebhook([]byte("other"), now, body), body, ErrWebhookSignature},
+		{"tampered body", SignWebhook(current, now, body), []byte(`{"id":"evt_2"}`), ErrWebhookSignature},
+		{"missing timestamp", "v1=00", body, ErrWebhookSignature},
+		{"missing signature", "t=1700000000", body, ErrWebhookSignature},
+		{"empty", "", body, ErrWebhookSignature},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Verify(tc.header, tc.body, now)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Verify() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestWebhookVerifyMovedTimestamp(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	secret := []byte("secret")
+	body := []byte(`{}`)
+	header := SignWebhook(secret, now.Add(-time.Hour), body)
+	// keep the old MAC but claim a fresh timestamp
+	forged := "t=1700000000" + header[len("t=1699996400"):]
+	v := WebhookVerifier{Secrets: [][]byte{secret}, Tolerance: 5 * time.Minute}
+	if err := v.Verify(forged, body, now); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("Verify() = %v, want %v", err, ErrWebhookSignature)
+	}
+}
+
+func TestWebhookVerifyMultipleSignatures(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{}`)
+	header := SignWebhook([]byte("old"), now, body) + ",v1=" + SignWebhook([]byte("new"), now, body)[len("t=1700000000,v1="):]
+	v := WebhookVerifier{Secrets: [][]byte{[]byte("new")}, Tolerance: time.Minute}
+	if err := v.Verify(header, body, now); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+	if err := (WebhookVerifier{Tolerance: time.Minute}).Verify(header, body, now); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("Verify() with no secrets = %v, want %v", err, ErrWebhookSignature)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+	"main.go/internal/metrics"
+)
+
+const (
+	// a new key is published in the JWKS this long before it starts signing,
+	// so verifiers that cache the document see it in time
+	keyPublishLead = time.Hour
+	// a superseded key stays verifiable until every token it signed has expired
+	keyRetention     = 2 * time.Hour
+	keyCheckInterval = time.Minute
+	jwksMaxAge       = "max-age=900"
+)
+
+// keyRotator keeps signing_keys on schedule and mirrors it into the
+// in-memory keyset. Every instance runs one; an advisory lock makes sure only
+// one of them creates the next key.
+type keyRotator struct {
+	db        *sql.DB
+	dbQueries *databases.Queries
+	metrics   *metrics.Metrics
+	keys      *auth.KeySet
+	algorithm string
+	interval  time.Duration
+}
+
+func (kr *keyRotator) rotate(ctx context.Context) error {
+	tx, err := kr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := databases.New(kr.metrics.DB(tx))
+	err = qtx.LockSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	stored, err := qtx.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if len(stored) == 0 {
+		err = kr.createKey(ctx, qtx, now)
+	} else if latest := stored[len(stored)-1]; !latest.ActivatesAt.After(now) && now.Sub(latest.ActivatesAt) >= kr.interval-keyPublishLead {
+		err = kr.createKey(ctx, qtx, now.Add(keyPublishLead))
+	}
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(stored)-1; i++ {
+		successor := stored[i+1]
+		if successor.ActivatesAt.Before(now.Add(-keyRetention)) {
+			err = qtx.DeleteSigningKey(ctx, stored[i].Kid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return kr.reload(ctx)
+}
+
+func (kr *keyRotator) createKey(ctx context.Context, q *databases.Queries, activatesAt time.Time) error {
+	key, err := auth.GenerateSigningKey(kr.algorithm, activatesAt)
+	if err != nil {
+		return err
+	}
+	encoded, err := key.MarshalPrivateKey()
+	if err != nil {
+		return err
+	}
+	log.Printf("Created %s signing key %s, active from %s", key.Algorithm, key.ID, activatesAt.Format(time.RFC3339))
+	return q.CreateSigningKey(ctx, databases.CreateSigningKeyParams{
+		Kid:         key.ID,
+		Algorithm:   key.Algorithm,
+		PrivateKey:  encoded,
+		ActivatesAt: activatesAt,
+	})
+}
+
+// reload loads the stored keys: the newest active one signs, the rest
+// (including the next, not yet active key) are only used to verify.
+func (kr *keyRotator) reload(ctx context.Context) error {
+	stored, err := kr.dbQueries.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var signing *auth.SigningKey
+	verifyOnly := []*auth.SigningKey{}
+	for _, row := range stored {
+		key, err := auth.ParseSigningKey(row.Kid, row.Algorithm, row.PrivateKey, row.ActivatesAt)
+		if err != nil {
+			return err
+		}
+		if !key.ActivatesAt.After(now) {
+			if signing != nil {
+				verifyOnly = append(verifyOnly, signing)
+			}
+			signing = key
+			continue
+		}
+		verifyOnly = append(verifyOnly, key)
+	}
+	kr.keys.Replace(signing, verifyOnly)
+	return nil
+}
+
+func (kr *keyRotator) run(ctx context.Context) {
+	ticker := time.NewTicker(keyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := kr.rotate(ctx)
+			if err != nil {
+				log.Printf("Error rotating signing keys: %s", err)
+			}
+		}
+	}
+}
+
+func serveJWKS(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, "+jwksMaxAge)
+		respondWithJSON(w, http.StatusOK, apiCfg.jwtConfig.Keys.JWKS())
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+// An account is locked after a handful of misses; a single address gets more
+// room because offices and carrier NAT put many users behind one IP.
+var (
+	accountLoginBackoff = auth.Backoff{Free: 5, Base: 30 * time.Second, Max: time.Hour}
+	ipLoginBackoff      = auth.Backoff{Free: 20, Base: 30 * time.Second, Max: time.Hour}
+)
+
+var (
+	errBadCredentials  = errors.New("incorrect email or password")
+	errBadSecondFactor = errors.New("invalid second factor code")
+)
+
+type loginLockedError struct {
+	retryAfter time.Duration
+}
+
+func (e loginLockedError) Error() string {
+	return fmt.Sprintf("login locked for %s", e.retryAfter)
+}
+
+func accountLoginKey(normalizedEmail string) string {
+	return "email:" + normalizedEmail
+}
+
+func (cfg *apiConfig) ipLoginKey(r *http.Request) string {
+	return "ip:" + cfg.clientIP(r)
+}
+
+// checkLoginLocked refuses with a loginLockedError while any of keys is
+// locked.
+func (cfg *apiConfig) checkLoginLocked(ctx context.Context, keys ...string) error {
+	lockouts, err := cfg.dbQueries.GetLoginLockouts(ctx, keys)
+	if err != nil {
+		return err
+	}
+	if len(lockouts) == 0 {
+		return nil
+	}
+	var until time.Time
+	for _, lockout := range lockouts {
+		if lockout.LockedUntil.Time.After(until) {
+			until = lockout.LockedUntil.Time
+		}
+	}
+	return loginLockedError{retryAfter: time.Until(until)}
+}
+
+// checkLogin verifies an email and password. Failures are counted per
+// account and per client address, and either one being locked refuses the
+// attempt before the password is looked at. Unknown emails fail exactly
+// like wrong passwords so the endpoint can't be used to find accounts.
+// For accounts with two-factor authentication the failures are only
+// cleared once the second factor passes too.
+func (cfg *apiConfig) checkLogin(r *http.Request, email, password string) (databases.User, error) {
+	ctx := r.Context()
+	normalized, err := auth.NormalizeEmail(email)
+	if err != nil {
+		normalized = strings.ToLower(strings.TrimSpace(email))
+	}
+	accountKey := accountLoginKey(normalized)
+	ipKey := cfg.ipLoginKey(r)
+	err = cfg.checkLoginLocked(ctx, accountKey, ipKey)
+	if err != nil {
+		return databases.User{}, err
+	}
+	dbUser, err := cfg.dbQueries.GetUserByEmail(ctx, normalized)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		auth.CheckPasswordHash(password, cfg.dummyPasswordHash)
+		err = errBadCredentials
+	case err != nil:
+		return databases.User{}, err
+	default:
+		if cfg.checkUserPassword(dbUser, password) != nil {
+			err = errBadCredentials
+		}
+	}
+	if err != nil {
+		cfg.recordLoginFailure(ctx, accountKey, accountLoginBackoff)
+		cfg.recordLoginFailure(ctx, ipKey, ipLoginBackoff)
+		return databases.User{}, err
+	}
+	if !dbUser.TotpEnabledAt.Valid {
+		cfg.clearLoginFailures(ctx, dbUser)
+	}
+	cfg.rehashPassword(ctx, dbUser, password)
+	return dbUser, nil
+}
+
+// checkSecondFactorLogin locks and counts second factor attempts like
+// passwords, so knowing the password doesn't buy unlimited guesses at the
+// code by starting new challenges. The code is spent through q, so a caller
+// can tie it to the transaction that completes the login.
+func (cfg *apiConfig) checkSecondFactorLogin(r *http.Request, q *databases.Queries, dbUser databases.User, code, recoveryCode string) error {
+	ctx := r.Context()
+	accountKey := accountLoginKey(dbUser.Email)
+	ipKey := cfg.ipLoginKey(r)
+	err := cfg.checkLoginLocked(ctx, accountKey, ipKey)
+	if err != nil {
+		return err
+	}
+	ok, err := checkSecondFactor(ctx, q, dbUser, code, recoveryCode)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		cfg.recordLoginFailure(ctx, accountKey, accountLoginBackoff)
+		cfg.recordLoginFailure(ctx, ipKey, ipLoginBackoff)
+		return errBadSecondFactor
+	}
+	cfg.clearLoginFailures(ctx, dbUser)
+	return nil
+}
+
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, dbUser databases.User) {
+	_, err := cfg.dbQueries.ClearLoginFailures(ctx, accountLoginKey(dbUser.Email))
+	if err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+}
+
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, key string, backoff auth.Backoff) {
+	failure, err := cfg.dbQueries.RecordLoginFailure(ctx, key)
+	if err != nil {
+		log.Printf("Error recording login failure: %s", err)
+		return
+	}
+	delay := backoff.Delay(int(failure.Failures))
+	if delay == 0 {
+		return
+	}
+	err = cfg.dbQueries.LockLogin(ctx, databases.LockLoginParams{
+		Key:         key,
+		LockedUntil: sql.NullTime{Time: time.Now().Add(delay), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error locking login: %s", err)
+	}
+}
+
+func respondWithLoginError(w http.ResponseWriter, err error) {
+	var locked loginLockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+	case errors.Is(err, errBadCredentials):
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+	default:
+		log.Printf("Error checking login: %s", err)
+		w.WriteHeader(500)
+	}
+}
+
+type Lockout struct {
+	Key           string     `json:"key"`
+	Failures      int32      `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// listLockouts shows recent failed-login counters, or only the active
+// lockouts with ?locked=true.
+func listLockouts(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		failures, err := apiCfg.dbQueries.ListLoginFailures(r.Context(), r.URL.Query().Get("locked") == "true")
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		lockouts := []Lockout{}
+		for _, failure := range failures {
+			lockout := Lockout{
+				Key:           failure.Key,
+				Failures:      failure.Failures,
+				LastFailureAt: failure.LastFailureAt,
+			}
+			if failure.LockedUntil.Valid && failure.LockedUntil.Time.After(time.Now()) {
+				lockout.LockedUntil = &failure.LockedUntil.Time
+			}
+			lockouts = append(lockouts, lockout)
+		}
+		respondWithJSON(w, http.StatusOK, lockouts)
+	}
+}
+
+// clearLockout resets the counter for a key such as "email:ada@example.com"
+// or "ip:203.0.113.7".
+func clearLockout(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		rows, err := apiCfg.dbQueries.ClearLoginFailures(r.Context(), r.PathValue("key"))
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
-	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,31 +21,49 @@ import (
 	_ "github.com/lib/pq"
 
 	auth "main.go/internal"
+	"main.go/internal/activitypub"
+	"main.go/internal/analytics"
 	"main.go/internal/databases"
+	"main.go/internal/events"
+	"main.go/internal/mailer"
+	"main.go/internal/metrics"
+	"main.go/internal/oidc"
+	"main.go/internal/ratelimit"
+	"main.go/internal/stream"
 )
 
 type apiConfig struct {
-	fileServerHits atomic.Int32
+	metrics *metrics.Metrics
+	visits *analytics.Counter
+	db *sql.DB
 	dbQueries *databases.Queries
 	platform string
-	jwtSecret string
-	polkaSecret string
+	jwtConfig auth.JWTConfig
+	polkaVerifier auth.WebhookVerifier
+	mailer mailer.Mailer
+	baseURL string
+	requireVerifiedEmail bool
+	trustProxy bool
+	oidcProviders map[string]*oidc.Provider
+	adminAPIKey string
+	passwordHashing auth.PasswordHashing
+	passwordPolicy auth.PasswordPolicy
+	dummyPasswordHash string
+	rateLimiter *rateLimiter
+	events *events.Dispatcher
+	streamHub *stream.Hub
+	apClient *activitypub.Client
+	federationHost string
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler{
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileServerHits.Add(1)
+		cfg.metrics.FileServerHits.Inc()
+		cfg.visits.Record(time.Now(), cfg.clientIP(r)+" "+r.UserAgent())
 		next.ServeHTTP(w, r)
 	})
 }
 
-func displayServerHits(apiCfg *apiConfig) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(fmt.Sprintf("<html><body> <h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>",apiCfg.fileServerHits.Load())))
-	}
-}
-
 func resetDB(apiCfg *apiConfig) http.HandlerFunc {
 	type respMsg struct {
 		Status string `json:"status"`
@@ -51,12 +73,34 @@ func resetDB(apiCfg *apiConfig) http.HandlerFunc {
 				w.WriteHeader(http.StatusForbidden)
 				return
 		}
-		_, err := apiCfg.dbQueries.DeleteUser(r.Context())
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+				log.Printf("Error starting transaction: %s", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		_, err = qtx.DeleteUser(r.Context())
+		if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+		}
+		err = qtx.DeleteVisitBuckets(r.Context())
 		if err != nil {
 				log.Printf("Error executing query: %s", err)
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 		}
+		err = tx.Commit()
+		if err != nil {
+				log.Printf("Error committing transaction: %s", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+		}
+		// other instances flush what they counted before the reset later
+		apiCfg.visits.Reset()
 		responseMsg := respMsg{
 			Status: "reset done",
 		}
@@ -82,18 +126,22 @@ func createChirp(apiCfg *apiConfig) http.HandlerFunc {
 		Error string `json:"error"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		cleanedTokenString, err := auth.GetBearerToken(r.Header)
+		userId, err := apiCfg.authorize(r, auth.ScopeChirpsWrite)
 		if err != nil {
-			log.Printf("Error cleaning the bearer token: %s", err)
-			w.WriteHeader(401)
+			respondWithAuthError(w, err)
 			return
 		}
-		
-		userId, err := auth.ValidateJWT(cleanedTokenString, apiCfg.jwtSecret)
-		if err != nil {
-			log.Printf("Invalid token: %s. Line: %d", err, 92)
-			w.WriteHeader(401)
-			return
+		if apiCfg.requireVerifiedEmail {
+			user, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			if !user.EmailVerifiedAt.Valid {
+				respondWithError(w, http.StatusForbidden, "Email address must be verified before posting")
+				return
+			}
 		}
 		decoder := json.NewDecoder(r.Body)
 		params := Chirp{}
@@ -130,12 +178,32 @@ func createChirp(apiCfg *apiConfig) http.HandlerFunc {
 			UserID: userId,
 		}
 
-		newChirp, err := apiCfg.dbQueries.CreateChirp(r.Context(), validation)
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		newChirp, err := qtx.CreateChirp(r.Context(), validation)
 		if err != nil {
 			log.Printf("Error executing query: %s", err)
 			w.WriteHeader(500)
 			return
 		}
+		if tags := stream.Tags(newChirp.Body); len(tags) > 0 {
+			err = qtx.AddChirpTags(r.Context(), databases.AddChirpTagsParams{
+				ChirpID:   newChirp.ID,
+				Tags:      tags,
+				CreatedAt: newChirp.CreatedAt,
+			})
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+		}
 		responseChirp := Chirp{
 			Id: newChirp.ID,
 			CreatedAt: newChirp.CreatedAt,
@@ -143,6 +211,20 @@ func createChirp(apiCfg *apiConfig) http.HandlerFunc {
 			Body: newChirp.Body,
 			UserId: newChirp.UserID,
 		}
+		err = recordEvent(r.Context(), qtx, eventChirpCreated, responseChirp)
+		if err != nil {
+			log.Printf("Error recording event: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		apiCfg.events.Notify()
+		apiCfg.metrics.ChirpsCreated.Inc()
 
 		marshalledChirp, err := json.Marshal(responseChirp)
 		if err != nil {
@@ -175,6 +257,7 @@ func createUser(apiCfg *apiConfig) http.HandlerFunc {
 			UpdatedAt time.Time `json:"updated_at"`
 			Email string `json:"email"`
 			IsChirpyRed bool `json:"is_chirpy_red"`
+			IsEmailVerified bool `json:"is_email_verified"`
 		}
 		type errMsg struct{
 			Body string `json:"body"`
@@ -197,27 +280,72 @@ func createUser(apiCfg *apiConfig) http.HandlerFunc {
 			w.WriteHeader(500)
 			return
 		}
-		hashed_pass, err := auth.HashPassword(params.Hashed_Pass) 
+		email, err := auth.NormalizeEmail(params.Email)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		problem, err := apiCfg.checkNewPassword(params.Hashed_Pass)
+		if err != nil {
+			log.Printf("Error checking password policy: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if problem != "" {
+			respondWithError(w, http.StatusBadRequest, problem)
+			return
+		}
+		hashed_pass, err := apiCfg.passwordHashing.Hash(params.Hashed_Pass)
 		if err != nil {
 			log.Printf("Error while hashing password: %s", err)
 			return
 		}
 		userWpass := databases.CreateUserParams{
-			Email: params.Email,
-			HashedPassword: hashed_pass,
+			Email: email,
+			HashedPassword: sql.NullString{String: hashed_pass, Valid: true},
 
 		}
-		user, err := apiCfg.dbQueries.CreateUser(r.Context(), userWpass)
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		user, err := qtx.CreateUser(r.Context(), userWpass)
 		if err != nil {
 			log.Printf("Error executing query: %s", err)
 			return
 		}
+		err = recordEvent(r.Context(), qtx, eventUserCreated, map[string]any{
+			"id": user.ID,
+			"created_at": user.CreatedAt,
+		})
+		if err != nil {
+			log.Printf("Error recording event: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		apiCfg.events.Notify()
+		err = sendVerificationEmail(r.Context(), apiCfg, user.ID, user.Email)
+		if err != nil {
+			// the account exists; the user can ask for a new link later
+			log.Printf("Error sending verification email: %s", err)
+		}
 		newUser := UserResp{
 			ID: user.ID,
 			CreatedAt: user.CreatedAt,
 			UpdatedAt: user.UpdatedAt,
 			Email: user.Email,
 			IsChirpyRed: user.IsChirpyRed.Bool,
+			IsEmailVerified: user.EmailVerifiedAt.Valid,
 		}
 		marshalledNewUser, err := json.Marshal(newUser)
 		if err != nil {
@@ -350,116 +478,128 @@ func userLogin(apiCfg *apiConfig) http.HandlerFunc {
 			w.WriteHeader(401)
 			return
 		}
-		log.Print("params line 316: ", params)
 		if params.Email == "" || params.Hashed_Pass == "" {
-			w.WriteHeader(401)
+			respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 			return
 		}
-		dbUser, err := apiCfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+		dbUser, err := apiCfg.checkLogin(r, params.Email, params.Hashed_Pass)
 		if err != nil {
-			log.Printf("failed executing query: %s", err)
-			return 
-		}
-		tryPassword := params.Hashed_Pass
-		dbPassword, err := apiCfg.dbQueries.GetPassword(r.Context(), params.Email)
-		if err != nil {
-			log.Printf("Error executing query: %s on Line 289", err)
+			respondWithLoginError(w, err)
 			return
 		}
-		err = auth.CheckPasswordHash(tryPassword, dbPassword)
-		if err != nil {
-			w.WriteHeader(401)
-			w.Write([]byte("Incorrect email or password"))
+		if dbUser.TotpEnabledAt.Valid {
+			writeTwoFactorChallenge(w, r, apiCfg, dbUser)
 			return
 		}
-		def_expiry := 3600 
-		tokenString, err := auth.MakeJWT(dbUser.ID, apiCfg.jwtSecret, time.Duration(def_expiry)*time.Second)
-		if err != nil {
-			log.Printf("Error genearting jwt: %s", err)
-			return
-		}
-		_, err = auth.ValidateJWT(tokenString, apiCfg.jwtSecret)
-		if err != nil {
-			log.Printf("Error validating token: %s. Line: %d", err, 347)
-			return
-		}
-		// Refresh tokens
-		type RefreshTokenParams struct {
-			Token     string
-			UserID    uuid.UUID
-			ExpiresAt time.Time
-			RevokedAt sql.NullTime
-		}
-		refreshToken, err := auth.MakeRefreshToken()
-		if err != nil {
-			log.Printf("Error creating refresh token: %s", err)
-			w.WriteHeader(500)
-			return
-		}
-		newRefreshToken := RefreshTokenParams{
-			Token: refreshToken,
-			UserID: dbUser.ID,
-			ExpiresAt: time.Now().Add(1460 * time.Hour),
-			RevokedAt: sql.NullTime{},
-		}
-		dbRefreshToken, err := apiCfg.dbQueries.CreateRefreshToken(r.Context(), databases.CreateRefreshTokenParams(newRefreshToken))
-		if err != nil {
-			log.Printf("Error getting refresh tokes from the db: %s", err)
-			w.WriteHeader(500)
-			return
-		}
-		// End of Refresh tokens
+		writeLoginResponse(w, r, apiCfg, dbUser)
+	}
+}
 
-		type UserResp struct{
-			ID uuid.UUID `json:"id"`
-			CreatedAt time.Time `json:"created_at"`
-			UpdatedAt time.Time `json:"updated_at"`
-			Email string `json:"email"`
-			Hashed_Pass string `json:"password"`
-			Token string `json:"token"`
-			RefreshToken string `json:"refresh_token"`
-			IsChirpyRed bool `json:"is_chirpy_red"`
-		}
-		respUser := UserResp{
-			ID: dbUser.ID,
-			CreatedAt: dbUser.CreatedAt,
-			UpdatedAt: dbUser.UpdatedAt,
-			Email: params.Email,
-			Token: tokenString,
-			RefreshToken: dbRefreshToken.Token,
-			IsChirpyRed: dbUser.IsChirpyRed.Bool,
-		}
-		marshalledResp, err := json.Marshal(respUser)
-		if err != nil {
-			log.Printf("Error marshalling response: %s", err)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		w.Write(marshalledResp)
+// writeLoginResponse issues an access token and a refresh token for a user
+// who has passed every login step.
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, apiCfg *apiConfig, dbUser databases.User) {
+	def_expiry := 3600 
+	familyId := uuid.New()
+	tokenString, err := auth.MakeSessionJWT(dbUser.ID, familyId, apiCfg.jwtConfig, time.Duration(def_expiry)*time.Second)
+	if err != nil {
+		log.Printf("Error genearting jwt: %s", err)
+		return
+	}
+	_, err = auth.ValidateJWT(tokenString, apiCfg.jwtConfig)
+	if err != nil {
+		log.Printf("Error validating token: %s. Line: %d", err, 347)
+		return
+	}
+	// Refresh tokens
+	type RefreshTokenParams struct {
+		TokenHash string
+		UserID    uuid.UUID
+		ExpiresAt time.Time
+		RevokedAt sql.NullTime
+		FamilyID  uuid.UUID
+		UserAgent string
+		Ip        string
 	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating refresh token: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	newRefreshToken := RefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID: dbUser.ID,
+		ExpiresAt: time.Now().Add(1460 * time.Hour),
+		RevokedAt: sql.NullTime{},
+		FamilyID: familyId,
+		UserAgent: sessionUserAgent(r),
+		Ip: apiCfg.clientIP(r),
+	}
+	_, err = apiCfg.dbQueries.CreateRefreshToken(r.Context(), databases.CreateRefreshTokenParams(newRefreshToken))
+	if err != nil {
+		log.Printf("Error getting refresh tokes from the db: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	// End of Refresh tokens
+
+	type UserResp struct{
+		ID uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Email string `json:"email"`
+		Hashed_Pass string `json:"password"`
+		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		IsChirpyRed bool `json:"is_chirpy_red"`
+		IsEmailVerified bool `json:"is_email_verified"`
+	}
+	respUser := UserResp{
+		ID: dbUser.ID,
+		CreatedAt: dbUser.CreatedAt,
+		UpdatedAt: dbUser.UpdatedAt,
+		Email: dbUser.Email,
+		Token: tokenString,
+		RefreshToken: refreshToken,
+		IsChirpyRed: dbUser.IsChirpyRed.Bool,
+		IsEmailVerified: dbUser.EmailVerifiedAt.Valid,
+	}
+	marshalledResp, err := json.Marshal(respUser)
+	if err != nil {
+		log.Printf("Error marshalling response: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshalledResp)
 }
 
 func findRefreshToken(apiCfg *apiConfig ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type RefreshToken struct {
 			Token string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
 		}
 		token, err := auth.GetBearerToken(r.Header)
 		if err != nil {
 			log.Printf("Error getting the bearer token: %s", err)
-			w.WriteHeader(500)
+			w.WriteHeader(401)
 			return
 		}
-		
-		log.Printf("token line 415 ////////// ////////: %s", token)
-		dbToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), token)
+		tokenHash := auth.HashToken(token)
+		dbToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), tokenHash)
 		if err != nil {
 			log.Printf("error loading refresh token from db: %s", err)
 			w.WriteHeader(401)
 			return
 		}
 		if dbToken.RevokedAt.Valid  {
-			log.Printf("Token revoked")
+			// A rotated-out token coming back means it was copied; cut off
+			// every token descended from the same login.
+			log.Printf("Revoked refresh token reused, revoking family %s", dbToken.FamilyID)
+			err = apiCfg.dbQueries.RevokeTokenFamily(r.Context(), dbToken.FamilyID)
+			if err != nil {
+				log.Printf("Failed to revoke token family: %s", err)
+			}
 			w.WriteHeader(401)
 			return
 		}
@@ -467,28 +607,70 @@ func findRefreshToken(apiCfg *apiConfig ) http.HandlerFunc {
 		if expired {
 			log.Printf("token expired")
 			w.WriteHeader(401)
+			return
 		}
 
-		userId, err := apiCfg.dbQueries.GetUserFromToken(r.Context(), dbToken.Token)
+		newRefreshToken, err := auth.MakeRefreshToken()
 		if err != nil {
-			log.Printf("failed to get user id from db: %s", err)
+			log.Printf("Error creating refresh token: %s", err)
 			w.WriteHeader(500)
 			return
 		}
-		def_expiry := 3600 
-		tokenString, err := auth.MakeJWT(userId, apiCfg.jwtSecret, time.Duration(def_expiry)*time.Second)
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			log.Printf("Error genearting jwt: %s", err)
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		rows, err := qtx.RotateRefreshToken(r.Context(), tokenHash)
+		if err != nil {
+			log.Printf("Failed to rotate refresh token: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows != 1 {
+			// another request rotated this token first
+			log.Printf("Refresh token reused concurrently, revoking family %s", dbToken.FamilyID)
+			tx.Rollback()
+			err = apiCfg.dbQueries.RevokeTokenFamily(r.Context(), dbToken.FamilyID)
+			if err != nil {
+				log.Printf("Failed to revoke token family: %s", err)
+			}
+			w.WriteHeader(401)
+			return
+		}
+		_, err = qtx.CreateRefreshToken(r.Context(), databases.CreateRefreshTokenParams{
+			TokenHash: auth.HashToken(newRefreshToken),
+			UserID: dbToken.UserID,
+			ExpiresAt: dbToken.ExpiresAt,
+			FamilyID: dbToken.FamilyID,
+			UserAgent: sessionUserAgent(r),
+			Ip: apiCfg.clientIP(r),
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
 			return
 		}
-		_, err = auth.ValidateJWT(tokenString, apiCfg.jwtSecret)
+
+		def_expiry := 3600 
+		tokenString, err := auth.MakeSessionJWT(dbToken.UserID, dbToken.FamilyID, apiCfg.jwtConfig, time.Duration(def_expiry)*time.Second)
 		if err != nil {
-			log.Printf("error validating jwt: %s", err)
+			log.Printf("Error genearting jwt: %s", err)
 			w.WriteHeader(500)
 			return
 		}
 		respToken := RefreshToken{
 			Token: tokenString,
+			RefreshToken: newRefreshToken,
 		}
 		marshalledResp, err := json.Marshal(respToken)
 		if err != nil {
@@ -496,8 +678,8 @@ func findRefreshToken(apiCfg *apiConfig ) http.HandlerFunc {
 			w.WriteHeader(500)
 			return
 		}
-		w.Write(marshalledResp)
 		w.WriteHeader(200)
+		w.Write(marshalledResp)
 	}
 }
 
@@ -509,7 +691,7 @@ func revokeToken(apiCfg *apiConfig) http.HandlerFunc {
 			w.WriteHeader(500)
 			return
 		}
-		dbToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), token)
+		dbToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), auth.HashToken(token))
 		expired := dbToken.ExpiresAt.Before(time.Now())
 		if expired {
 			log.Printf("token expired")
@@ -520,7 +702,7 @@ func revokeToken(apiCfg *apiConfig) http.HandlerFunc {
 			w.WriteHeader(401)
 			return
 		}
-		err = apiCfg.dbQueries.RevokeToken(r.Context(), dbToken.Token)
+		err = apiCfg.dbQueries.RevokeToken(r.Context(), dbToken.TokenHash)
 		if err != nil {
 			log.Printf("Failed to revoke token: %s", err)
 			w.WriteHeader(500)
@@ -530,172 +712,248 @@ func revokeToken(apiCfg *apiConfig) http.HandlerFunc {
 	}
 }
 
-func changeMailNpass(apiCfg *apiConfig) http.HandlerFunc {
+// updateUserGone answers the old combined PUT /api/users. It changed the
+// email and password without confirming either, so rather than keep it
+// working it points clients at the routes that replaced it.
+func updateUserGone(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Link", `</api/users/email>; rel="alternate"`)
+	w.Header().Add("Link", `</api/users/password>; rel="alternate"`)
+	respondWithError(w, http.StatusGone, "PUT /api/users has been replaced by PUT /api/users/email and PUT /api/users/password")
+}
+
+func changeEmail(apiCfg *apiConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type paramBody struct {
-			Password string `json:"password"`
-			Email string `json:"email"`
+			CurrentPassword string `json:"current_password"`
+			NewEmail string `json:"new_email"`
 		}
-		if r.Header == nil {
-			log.Printf("no header has been passed")
-			w.WriteHeader(401)
-			return
-		}
-		cleanedTokenString, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			log.Printf("Error cleaning the bearer token: %s", err)
-			w.WriteHeader(401)
-			return
+		type respMsg struct {
+			Status string `json:"status"`
 		}
-		userId, err := auth.ValidateJWT(cleanedTokenString, apiCfg.jwtSecret)
+		userId, err := apiCfg.authorize(r, auth.ScopeProfileWrite)
 		if err != nil {
-			log.Printf("Invalid token: %s. Line: %d", err, 92)
-			w.WriteHeader(401)
+			respondWithAuthError(w, err)
 			return
 		}
 		decoder := json.NewDecoder(r.Body)
 		params := paramBody{}
 		err = decoder.Decode(&params)
 		if err != nil {
-			log.Printf("Error decoding parameters: %s", err)
-			w.WriteHeader(500)
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
 			return
 		}
-		type UpdateUserParams struct {
-			Email          string
-			HashedPassword string
-			ID             uuid.UUID
+		newEmail, err := auth.NormalizeEmail(params.NewEmail)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
 		}
-		hashedPass, err := auth.HashPassword(params.Password)
+		dbUser, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
 		if err != nil {
-			log.Printf("Error hashing the password: %s", err)
+			log.Printf("Error executing query: %s", err)
 			w.WriteHeader(500)
 			return
 		}
-		updateUserParams := UpdateUserParams{
-			Email: params.Email,
-			HashedPassword: hashedPass,
-			ID: userId,
+		err = apiCfg.checkUserPassword(dbUser, params.CurrentPassword)
+		if errors.Is(err, errNoPassword) {
+			respondWithError(w, http.StatusForbidden, "Set a password before changing your email")
+			return
 		}
-		dbUser, err := apiCfg.dbQueries.UpdateUser(r.Context(), databases.UpdateUserParams(updateUserParams))
 		if err != nil {
-			log.Printf("Query unsuccessful: %s", err)
-			w.WriteHeader(500)
+			respondWithError(w, http.StatusUnauthorized, "Incorrect password")
 			return
 		}
-		type postUserParams struct {
-			Id uuid.UUID `json:"id"`
-			CreatedAt time.Time `json:"created_at"`
-			UpdatedAt time.Time `json:"updated_at"`
-			Email string `json:"email"`				
-			IsChirpyRed bool `json:"is_chirpy_red"`
+		if newEmail == dbUser.Email {
+			respondWithError(w, http.StatusBadRequest, "New email matches the current one")
+			return
+		}
+		existing, err := apiCfg.dbQueries.GetUserByEmail(r.Context(), newEmail)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
 		}
-		postUser := postUserParams{
-			Id: dbUser.ID,
-			CreatedAt: dbUser.CreatedAt,
-			UpdatedAt: dbUser.UpdatedAt,
-			Email: dbUser.Email, 
-			IsChirpyRed: dbUser.IsChirpyRed.Bool,
+		if existing.ID != uuid.Nil {
+			respondWithError(w, http.StatusConflict, "Email is already in use")
+			return
 		}
-		marshalledResp, err := json.Marshal(postUser)
-		if err != err {
-			log.Printf("error while marshalling rsponse: %s", err)
+		err = sendEmailChangeConfirmation(r.Context(), apiCfg, dbUser, newEmail)
+		if err != nil {
+			log.Printf("Error sending email change confirmation: %s", err)
 			w.WriteHeader(500)
 			return
 		}
-		w.WriteHeader(200)
-		w.Write(marshalledResp)
+		respondWithJSON(w, http.StatusAccepted, respMsg{Status: "confirmation sent to new address"})
 	}
 }
 
-func deleteChirp(apiCfg *apiConfig) http.HandlerFunc {
+func changePassword(apiCfg *apiConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cleanedTokenString, err := auth.GetBearerToken(r.Header)
+		type paramBody struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword string `json:"new_password"`
+		}
+		userId, err := apiCfg.authorize(r, auth.ScopeProfileWrite)
 		if err != nil {
-			log.Printf("Error cleaning the bearer token: %s", err)
-			w.WriteHeader(401)
+			respondWithAuthError(w, err)
 			return
 		}
-		userId, err := auth.ValidateJWT(cleanedTokenString, apiCfg.jwtSecret)
+		decoder := json.NewDecoder(r.Body)
+		params := paramBody{}
+		err = decoder.Decode(&params)
 		if err != nil {
-			log.Printf("Invalid token: %s. Line: %d", err, 92)
-			w.WriteHeader(401)
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
 			return
 		}
-		chirpId, err := uuid.Parse(r.PathValue("chirpID")) 
+		if params.NewPassword == "" {
+			respondWithError(w, http.StatusBadRequest, "Must include a new password")
+			return
+		}
+		dbUser, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
 		if err != nil {
-			log.Printf("Unable to parse chirpId: %s", err)
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
 			return
 		}
-		userIdFromChirp, err := apiCfg.dbQueries.UserIdFromChirp(r.Context(), chirpId)
+		// accounts that only sign in through an identity provider have no
+		// password to confirm with; a first one needs the user's own session
+		// and is confirmed by email
+		firstPassword := !dbUser.HashedPassword.Valid
+		if firstPassword {
+			_, err = apiCfg.authenticate(r)
+			if err != nil {
+				respondWithAuthError(w, err)
+				return
+			}
+		} else {
+			err = apiCfg.checkUserPassword(dbUser, params.CurrentPassword)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "Incorrect password")
+				return
+			}
+		}
+		problem, err := apiCfg.checkNewPassword(params.NewPassword)
 		if err != nil {
-			log.Printf("error executing the query: %s", err)
+			log.Printf("Error checking password policy: %s", err)
 			w.WriteHeader(500)
 			return
 		}
-		if userIdFromChirp.String() != userId.String() {
-			w.WriteHeader(403)
+		if problem != "" {
+			respondWithError(w, http.StatusBadRequest, problem)
 			return
 		}
-		chirp, err := apiCfg.dbQueries.GetChirpById(r.Context(), chirpId)
+		hashedPass, err := apiCfg.passwordHashing.Hash(params.NewPassword)
 		if err != nil {
-			log.Printf("error executing the query: %s", err)
+			log.Printf("Error hashing the password: %s", err)
 			w.WriteHeader(500)
 			return
 		}
-		log.Printf("line 604 %s", chirp.ID.String())
-		if chirp.ID == uuid.Nil {
-			log.Printf("Chirp does not exist: %s", err)
-			w.WriteHeader(404)
+		if firstPassword {
+			err = sendPasswordSetupConfirmation(r.Context(), apiCfg, dbUser, hashedPass)
+			if err != nil {
+				log.Printf("Error sending password confirmation: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
 		}
-		err = apiCfg.dbQueries.DeleteChirp(r.Context(), chirpId)
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			log.Printf("Error executing query: %s", err)
+			log.Printf("Error starting transaction: %s", err)
 			w.WriteHeader(500)
 			return
 		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		user, err := qtx.UpdateUserPassword(r.Context(), databases.UpdateUserPasswordParams{
+			HashedPassword: sql.NullString{String: hashedPass, Valid: true},
+			ID: userId,
+		})
+		if err != nil {
+			log.Printf("Query unsuccessful: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		// existing sessions were opened with the old password
+		err = qtx.RevokeUserRefreshTokens(r.Context(), userId)
+		if err != nil {
+			log.Printf("Failed to revoke refresh tokens: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = recordEvent(r.Context(), qtx, eventUserUpdated, userUpdatedEvent(user, "password"))
+		if err != nil {
+			log.Printf("Error recording event: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		apiCfg.events.Notify()
 		w.WriteHeader(204)
 	}
 }
 
-func upgradeToRed(apiCfg *apiConfig) http.HandlerFunc {
+func deleteChirp(apiCfg *apiConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		apiKey, err := auth.GetAPIKey(r.Header)
+		userId, err := apiCfg.authorize(r, auth.ScopeChirpsWrite)
 		if err != nil {
-			w.WriteHeader(401)
+			respondWithAuthError(w, err)
 			return
 		}
-		if apiKey != apiCfg.polkaSecret {
-			w.WriteHeader(401)
+		chirpId, err := uuid.Parse(r.PathValue("chirpID")) 
+		if err != nil {
+			w.WriteHeader(404)
 			return
 		}
-		type paramsBody struct {
-			Event string `json:"event"`
-			Data struct {
-				UserId uuid.UUID `json:"user_id"`
-			} `json:"data"`
+		userIdFromChirp, err := apiCfg.dbQueries.UserIdFromChirp(r.Context(), chirpId)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
 		}
-		decoder := json.NewDecoder(r.Body) 
-		params := paramsBody{}
-		err = decoder.Decode(&params)
 		if err != nil {
-			log.Printf("Error decoding parameters: %s", err)
+			log.Printf("error executing the query: %s", err)
 			w.WriteHeader(500)
 			return
 		}
-		if params.Event != "user.upgraded" {
-			w.WriteHeader(204)
+		if userIdFromChirp.String() != userId.String() {
+			w.WriteHeader(403)
 			return
 		}
-		user, err := apiCfg.dbQueries.UpgradeToRed(r.Context(), params.Data.UserId)
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
 		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
 			w.WriteHeader(500)
-			return 
+			return
 		}
-		if user.ID == uuid.Nil {
-			w.WriteHeader(404)
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		err = qtx.DeleteChirp(r.Context(), chirpId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = recordEvent(r.Context(), qtx, eventChirpDeleted, map[string]uuid.UUID{
+			"id": chirpId,
+			"user_id": userId,
+		})
+		if err != nil {
+			log.Printf("Error recording event: %s", err)
+			w.WriteHeader(500)
 			return
 		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		apiCfg.events.Notify()
 		w.WriteHeader(204)
 	}
 }
@@ -703,45 +961,259 @@ func upgradeToRed(apiCfg *apiConfig) http.HandlerFunc {
 func main() {
 	godotenv.Load()
 	dbURL := os.Getenv("DB_URL")
-	jWTSecret := os.Getenv("JWT_SECRET") 
-	polkaSecret := os.Getenv("POLKA_KEY")
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal("unable to connect to the database: ", err)
 	}
-	dbQueries := databases.New(db)
+	appMetrics := metrics.New()
+	dbQueries := databases.New(appMetrics.DB(db))
 	platform := os.Getenv("PLATFORM")
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	mailSender := mailer.New(os.Getenv("SMTP_ADDR"), os.Getenv("MAIL_FROM"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
 	mux := http.NewServeMux()
 	apiCfg := &apiConfig{
+		metrics: appMetrics,
+		visits: analytics.NewCounter(),
+		db: db,
 		dbQueries: dbQueries,
 		platform: platform,
-		jwtSecret: jWTSecret,
-		polkaSecret: polkaSecret,
+		jwtConfig: auth.JWTConfig{
+			Keys: auth.NewKeySet(nil),
+			Issuer: envOrDefault("JWT_ISSUER", "chirpy"),
+			Audience: envOrDefault("JWT_AUDIENCE", "chirpy"),
+			Leeway: 30 * time.Second,
+		},
+		mailer: mailSender,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		requireVerifiedEmail: os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
+		trustProxy: os.Getenv("TRUST_PROXY") == "true",
+		adminAPIKey: os.Getenv("ADMIN_API_KEY"),
+	}
+	publicURL, err := url.Parse(apiCfg.baseURL)
+	if err != nil || publicURL.Host == "" {
+		log.Fatalf("invalid BASE_URL %q", baseURL)
+	}
+	apiCfg.federationHost = publicURL.Host
+	if os.Getenv("FEDERATION_ENABLED") == "true" {
+		apiCfg.apClient = activitypub.NewClient("Chirpy (+"+apiCfg.baseURL+")", os.Getenv("FEDERATION_ALLOW_LOCAL") == "true")
+	}
+	apiCfg.passwordHashing, apiCfg.passwordPolicy, err = loadPasswordConfig()
+	if err != nil {
+		log.Fatal("invalid password configuration: ", err)
+	}
+	apiCfg.dummyPasswordHash, err = apiCfg.passwordHashing.Hash("not a real password")
+	if err != nil {
+		log.Fatal("unable to hash passwords: ", err)
+	}
+	apiCfg.polkaVerifier, err = loadPolkaVerifier()
+	if err != nil {
+		log.Fatal("invalid Polka configuration: ", err)
+	}
+	rateLimitRules, err := loadRateLimitRules()
+	if err != nil {
+		log.Fatal("invalid rate limit configuration: ", err)
+	}
+	apiCfg.rateLimiter = &rateLimiter{rules: rateLimitRules}
+	switch backend := envOrDefault("RATE_LIMIT_BACKEND", "memory"); backend {
+	case "memory":
+		apiCfg.rateLimiter.store = ratelimit.NewMemoryStore()
+	case "postgres":
+		apiCfg.rateLimiter.store = ratelimit.PostgresStore{Queries: dbQueries}
+		go runPeriodically(context.Background(), time.Hour, "rate limit bucket pruning", dbQueries.PruneRateLimitBuckets)
+	default:
+		log.Fatalf("invalid RATE_LIMIT_BACKEND %q: must be memory or postgres", backend)
+	}
+	if v := os.Getenv("JWT_CLOCK_SKEW"); v != "" {
+		apiCfg.jwtConfig.Leeway, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("invalid JWT_CLOCK_SKEW: ", err)
+		}
+	}
+	jwtAlg := os.Getenv("JWT_ALG")
+	if jwtAlg == "" {
+		jwtAlg = auth.AlgEdDSA
+	}
+	rotationInterval := 30 * 24 * time.Hour
+	if v := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); v != "" {
+		rotationInterval, err = time.ParseDuration(v)
+		if err != nil || rotationInterval <= keyPublishLead {
+			log.Fatalf("invalid JWT_KEY_ROTATION_INTERVAL %q: must be a duration longer than %s", v, keyPublishLead)
+		}
+	}
+	rotator := &keyRotator{
+		db: db,
+		dbQueries: dbQueries,
+		metrics: appMetrics,
+		keys: apiCfg.jwtConfig.Keys,
+		algorithm: jwtAlg,
+		interval: rotationInterval,
+	}
+	err = rotator.rotate(context.Background())
+	if err != nil {
+		log.Fatal("unable to load signing keys: ", err)
+	}
+	go rotator.run(context.Background())
+	go runPeriodically(context.Background(), time.Hour, "access token denylist pruning", dbQueries.PruneDeniedAccessTokens)
+	go runPeriodically(context.Background(), time.Hour, "login failure pruning", dbQueries.PruneLoginFailures)
+	go runPeriodically(context.Background(), time.Hour, "polka event pruning", dbQueries.PrunePolkaEvents)
+	go runPeriodically(context.Background(), time.Hour, "webhook log pruning", dbQueries.PruneWebhookEvents)
+	apiCfg.events = events.NewDispatcher(events.PostgresStore{Queries: dbQueries})
+	apiCfg.events.Subscribe("webhooks", apiCfg.queueWebhookDeliveries, outboundEventTypes...)
+	apiCfg.events.Subscribe("notifications", apiCfg.createNotifications, eventUserFollowed, eventChirpCreated)
+	apiCfg.streamHub = stream.NewHub(1000, 64)
+	apiCfg.events.SubscribeLive("stream", apiCfg.publishToStream, streamEventTypes...)
+	go apiCfg.events.Run(context.Background(), 2*time.Second)
+	go runPeriodically(context.Background(), 5*time.Second, "webhook delivery", apiCfg.deliverWebhooks)
+	go runPeriodically(context.Background(), time.Hour, "outbox pruning", apiCfg.events.Prune)
+	go runPeriodically(context.Background(), time.Hour, "notification pruning", dbQueries.PruneNotifications)
+	go runPeriodically(context.Background(), time.Hour, "stream ticket pruning", dbQueries.PruneStreamTickets)
+	go runPeriodically(context.Background(), 5*time.Minute, "subscription expiry", dbQueries.ExpireSubscriptions)
+	go runPeriodically(context.Background(), time.Minute, "active user count", apiCfg.countActiveUsers)
+	go runPeriodically(context.Background(), 30*time.Second, "visit flush", apiCfg.flushVisits)
+	if apiCfg.apClient != nil {
+		apiCfg.events.Subscribe("activitypub", apiCfg.federateChirps, federatedEventTypes...)
+		go runPeriodically(context.Background(), 5*time.Second, "activity delivery", apiCfg.deliverActivities)
+		go runPeriodically(context.Background(), time.Hour, "inbox activity pruning", dbQueries.PruneInboxActivities)
+		go runPeriodically(context.Background(), time.Hour, "activity delivery pruning", dbQueries.PruneActivityDeliveries)
+	}
+	apiCfg.oidcProviders, err = loadOIDCProviders(apiCfg.baseURL)
+	if err != nil {
+		log.Fatal("invalid OIDC configuration: ", err)
+	}
+	if len(apiCfg.oidcProviders) > 0 {
+		go runPeriodically(context.Background(), time.Hour, "oidc login state pruning", dbQueries.PruneOIDCLoginStates)
 	}
 	rootHandler := http.StripPrefix("/app", http.FileServer(http.Dir(".")))
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(rootHandler))
 	mux.Handle("/assets/", apiCfg.middlewareMetricsInc(http.FileServer(http.Dir("./assets/"))))
 
 	mux.HandleFunc("GET /api/healthz", healthRoute)
+	mux.HandleFunc("GET /.well-known/jwks.json", serveJWKS(apiCfg))
 	mux.HandleFunc("GET /admin/metrics", displayServerHits(apiCfg))
 	mux.HandleFunc("POST /admin/reset", resetDB(apiCfg))
-	mux.HandleFunc("POST /api/users", createUser(apiCfg))
-	mux.HandleFunc("POST /api/chirps", createChirp(apiCfg))
-	mux.HandleFunc("GET /api/chirps", getAllChirps(apiCfg))
-	mux.HandleFunc("GET /api/chirps/{chirpID}", getChirpById(apiCfg))
-	mux.HandleFunc("POST /api/login", userLogin(apiCfg))
-	mux.HandleFunc("POST /api/refresh", findRefreshToken(apiCfg))
+	mux.HandleFunc("GET /admin/lockouts", listLockouts(apiCfg))
+	mux.HandleFunc("DELETE /admin/lockouts/{key}", clearLockout(apiCfg))
+	mux.HandleFunc("GET /admin/webhooks", listWebhooks(apiCfg))
+	mux.HandleFunc("GET /admin/webhooks/{eventID}", getWebhook(apiCfg))
+	mux.HandleFunc("POST /admin/webhooks/{eventID}/replay", replayWebhook(apiCfg))
+	mux.HandleFunc("POST /admin/webhook-subscriptions", createWebhookSubscription(apiCfg))
+	mux.HandleFunc("GET /admin/webhook-subscriptions", listWebhookSubscriptions(apiCfg))
+	mux.HandleFunc("DELETE /admin/webhook-subscriptions/{subscriptionID}", deleteWebhookSubscription(apiCfg))
+	mux.HandleFunc("GET /admin/webhook-subscriptions/{subscriptionID}/deliveries", listWebhookDeliveries(apiCfg))
+	mux.Handle("POST /api/users", apiCfg.rateLimit("signup", createUser(apiCfg)))
+	mux.Handle("POST /api/chirps", apiCfg.rateLimit("chirps-write", createChirp(apiCfg)))
+	mux.Handle("GET /api/chirps", apiCfg.rateLimit("chirps-read", getAllChirps(apiCfg)))
+	mux.Handle("GET /api/chirps/{chirpID}", apiCfg.rateLimit("chirps-read", getChirpById(apiCfg)))
+	mux.Handle("POST /api/login", apiCfg.rateLimit("login", userLogin(apiCfg)))
+	mux.Handle("POST /api/login/2fa", apiCfg.rateLimit("login", loginTwoFactor(apiCfg)))
+	mux.HandleFunc("POST /api/2fa/enroll", enrollTOTP(apiCfg))
+	mux.HandleFunc("POST /api/2fa/confirm", confirmTOTP(apiCfg))
+	mux.HandleFunc("POST /api/2fa/disable", disableTOTP(apiCfg))
+	mux.Handle("POST /api/refresh", apiCfg.rateLimit("tokens", findRefreshToken(apiCfg)))
 	mux.HandleFunc("POST /api/revoke", revokeToken(apiCfg))
-	mux.HandleFunc("PUT /api/users", changeMailNpass(apiCfg))
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", deleteChirp(apiCfg))
-	mux.HandleFunc("POST /api/polka/webhooks", upgradeToRed(apiCfg))
+	mux.HandleFunc("POST /api/logout", logout(apiCfg))
+	mux.HandleFunc("GET /api/sessions", listSessions(apiCfg))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", revokeSession(apiCfg))
+	mux.HandleFunc("POST /api/sessions/revoke-others", revokeOtherSessions(apiCfg))
+	mux.HandleFunc("POST /api/tokens", createPersonalToken(apiCfg))
+	mux.HandleFunc("GET /api/tokens", listPersonalTokens(apiCfg))
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", revokePersonalToken(apiCfg))
+	mux.HandleFunc("POST /api/oauth/clients", registerOAuthClient(apiCfg))
+	mux.HandleFunc("GET /api/oauth/clients", listOAuthClients(apiCfg))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", deleteOAuthClient(apiCfg))
+	mux.HandleFunc("GET /oauth/authorize", oauthAuthorize(apiCfg))
+	mux.Handle("POST /oauth/authorize", apiCfg.rateLimit("login", oauthConsent(apiCfg)))
+	mux.Handle("POST /oauth/token", apiCfg.rateLimit("tokens", oauthToken(apiCfg)))
+	mux.HandleFunc("POST /oauth/revoke", oauthRevoke(apiCfg))
+	mux.HandleFunc("POST /oauth/introspect", oauthIntrospect(apiCfg))
+	mux.HandleFunc("GET /auth/oidc/{provider}/login", oidcLogin(apiCfg))
+	mux.HandleFunc("GET /auth/oidc/{provider}/callback", oidcCallback(apiCfg))
+	mux.HandleFunc("POST /api/identities/{provider}/link", linkIdentity(apiCfg))
+	mux.HandleFunc("GET /api/identities", listIdentities(apiCfg))
+	mux.HandleFunc("DELETE /api/identities/{identityID}", unlinkIdentity(apiCfg))
+	mux.HandleFunc("PUT /api/users", updateUserGone)
+	mux.HandleFunc("PUT /api/users/email", changeEmail(apiCfg))
+	mux.HandleFunc("PUT /api/users/password", changePassword(apiCfg))
+	mux.HandleFunc("PUT /api/users/handle", setHandle(apiCfg))
+	mux.Handle("GET /users/{handle}/feed.atom", apiCfg.rateLimit("chirps-read", userFeed(apiCfg, "atom")))
+	mux.Handle("GET /users/{handle}/feed.rss", apiCfg.rateLimit("chirps-read", userFeed(apiCfg, "rss")))
+	mux.Handle("GET /tags/{tag}/feed.atom", apiCfg.rateLimit("chirps-read", tagFeed(apiCfg, "atom")))
+	mux.Handle("GET /tags/{tag}/feed.rss", apiCfg.rateLimit("chirps-read", tagFeed(apiCfg, "rss")))
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.rateLimit("chirps-write", deleteChirp(apiCfg)))
+	mux.Handle("POST /api/polka/webhooks", apiCfg.rateLimit("webhooks", upgradeToRed(apiCfg)))
+	mux.HandleFunc("GET /api/subscription", getSubscription(apiCfg))
+	mux.HandleFunc("POST /api/users/{userID}/follow", followUser(apiCfg))
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", unfollowUser(apiCfg))
+	mux.HandleFunc("GET /api/notifications", listNotifications(apiCfg))
+	mux.HandleFunc("GET /api/stream", streamEvents(apiCfg))
+	mux.HandleFunc("POST /api/stream/ticket", createStreamTicket(apiCfg))
+	mux.HandleFunc("GET /api/ws", webSocket(apiCfg))
+	mux.HandleFunc("POST /api/notifications/read", markAllNotificationsRead(apiCfg))
+	mux.HandleFunc("POST /api/notifications/{notificationID}/read", markNotificationRead(apiCfg))
+	mux.HandleFunc("GET /api/notifications/preferences", getNotificationPreferences(apiCfg))
+	mux.HandleFunc("PUT /api/notifications/preferences", updateNotificationPreferences(apiCfg))
+	mux.HandleFunc("GET /api/verify-email", verifyEmail(apiCfg))
+	mux.Handle("POST /api/verify-email/resend", apiCfg.rateLimit("signup", resendVerification(apiCfg)))
+	if apiCfg.apClient != nil {
+		mux.HandleFunc("GET /.well-known/webfinger", webFinger(apiCfg))
+		mux.HandleFunc("GET /ap/users/{userID}", getActor(apiCfg))
+		mux.HandleFunc("GET /ap/users/{userID}/outbox", getActorOutbox(apiCfg))
+		mux.HandleFunc("GET /ap/users/{userID}/followers", getActorFollowers(apiCfg))
+		mux.HandleFunc("GET /ap/chirps/{chirpID}", getNote(apiCfg))
+		mux.HandleFunc("POST /ap/users/{userID}/inbox", apInbox(apiCfg))
+		mux.HandleFunc("POST /ap/inbox", apInbox(apiCfg))
+		mux.HandleFunc("POST /api/fediverse/follows", followRemote(apiCfg))
+		mux.HandleFunc("GET /api/fediverse/follows", listRemoteFollows(apiCfg))
+		mux.HandleFunc("DELETE /api/fediverse/follows/{followID}", unfollowRemote(apiCfg))
+		mux.Handle("GET /api/fediverse/timeline", apiCfg.rateLimit("chirps-read", remoteTimeline(apiCfg)))
+	}
+
+	// metrics are for the scraper, not the public, so they get their own
+	// listener that can be kept off the internet
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", apiCfg.metrics.Handler())
+	metricsServer := &http.Server{
+		Addr: envOrDefault("METRICS_ADDR", "127.0.0.1:9090"),
+		Handler: metricsMux,
+	}
+	go func() {
+		err := metricsServer.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error serving metrics: %s", err)
+		}
+	}()
 
 	server := &http.Server{
 		Addr: ":8080",
-		Handler: mux,
+		Handler: apiCfg.metrics.Middleware(mux),
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("Error starting server:", err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+	stop()
+
+	// requests in flight get a few seconds to finish; open streams are
+	// cut off when that runs out
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("Error shutting down server: %s", err)
+	}
+	metricsServer.Shutdown(shutdownCtx)
+	// visits since the last periodic flush only live in memory
+	err = apiCfg.flushVisits(context.Background())
+	if err != nil {
+		log.Printf("Error flushing visits: %s", err)
 	}
-	err = server.ListenAndServe() 
-    if err != nil {
-      fmt.Println("Error starting server:", err)
-    }
 }
\ No newline at end of file
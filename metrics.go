@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"main.go/internal/databases"
+)
+
+// withTx runs queries in tx through the same query timing as dbQueries,
+// which sqlc's WithTx would bypass.
+func (cfg *apiConfig) withTx(tx *sql.Tx) *databases.Queries {
+	return databases.New(cfg.metrics.DB(tx))
+}
+
+// countActiveUsers refreshes the active users gauge. It's a database count
+// rather than something tracked per instance, so every instance reports
+// the same number.
+func (cfg *apiConfig) countActiveUsers(ctx context.Context) error {
+	count, err := cfg.dbQueries.CountActiveUsers(ctx)
+	if err != nil {
+		return err
+	}
+	cfg.metrics.ActiveUsers.Set(float64(count))
+	return nil
+}
@@ -0,0 +1,39 @@
+-- +goose Up
+-- Addresses are compared normalized from now on, so stored ones must be too.
+-- When two accounts differ only by case the oldest keeps the address; the
+-- others get one that can't be signed in with, for an operator to sort out.
+UPDATE users
+SET email = 'duplicate+' || users.id || '+' || lower(trim(users.email))
+FROM users older
+WHERE lower(trim(older.email)) = lower(trim(users.email))
+  AND (older.created_at, older.id) < (users.created_at, users.id);
+
+UPDATE users
+SET email = lower(trim(email))
+WHERE email <> lower(trim(email));
+
+ALTER TABLE users
+ADD CONSTRAINT users_email_normalized CHECK (email = lower(trim(email)));
+
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+CREATE TABLE email_verifications (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id uuid NOT NULL,
+    email TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE email_verifications;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
+
+ALTER TABLE users
+DROP CONSTRAINT users_email_normalized;
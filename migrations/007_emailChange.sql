@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE email_verifications
+ADD COLUMN purpose TEXT NOT NULL DEFAULT 'verify';
+
+-- +goose Down
+ALTER TABLE email_verifications
+DROP COLUMN purpose;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Tokens are stored as sha256 hashes from now on; existing plaintext tokens
+-- are hashed in place so current sessions keep working.
+UPDATE refresh_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id uuid;
+
+UPDATE refresh_tokens
+SET family_id = gen_random_uuid()
+WHERE family_id IS NULL;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+-- Hashed tokens can't be turned back into plaintext, so every session is
+-- revoked on the way down.
+DROP INDEX refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN family_id;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
+
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE revoked_at IS NULL;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Holds private JWT signing keys; restrict access to this table accordingly.
+CREATE TABLE signing_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    activates_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE signing_keys;
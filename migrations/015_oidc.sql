@@ -0,0 +1,39 @@
+-- +goose Up
+ALTER TABLE users
+ALTER COLUMN hashed_password DROP NOT NULL;
+
+CREATE TABLE user_identities (
+    id uuid PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id uuid NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+CREATE TABLE oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    link_user_id uuid,
+    expires_at TIMESTAMP NOT NULL,
+
+    CONSTRAINT fk_user FOREIGN KEY (link_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE user_identities;
+
+DELETE FROM users
+WHERE hashed_password IS NULL;
+
+ALTER TABLE users
+ALTER COLUMN hashed_password SET NOT NULL;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    renewed_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscriptions_expires_at_idx ON subscriptions (expires_at)
+WHERE status IN ('active', 'past_due', 'cancelled');
+
+-- existing members predate the table; give them a period to be renewed in
+INSERT INTO subscriptions (user_id, plan, status, started_at, expires_at, updated_at)
+SELECT id, 'red', 'active', updated_at, NOW() + INTERVAL '30 days', NOW()
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY,
+    source TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    headers JSONB NOT NULL,
+    body BYTEA NOT NULL,
+    verified BOOLEAN NOT NULL,
+    status_code INTEGER NOT NULL,
+    result TEXT NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    replay_of UUID REFERENCES webhook_events(id) ON DELETE SET NULL
+);
+
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
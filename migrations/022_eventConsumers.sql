@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE outbox ADD COLUMN txid xid8 NOT NULL DEFAULT pg_current_xact_id();
+CREATE INDEX outbox_position_idx ON outbox (txid, id);
+
+CREATE TABLE event_consumers (
+    name TEXT PRIMARY KEY,
+    last_txid BIGINT NOT NULL,
+    last_id BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- webhooks move from dispatched_at to a consumer offset; start it after the
+-- events that were already turned into deliveries
+INSERT INTO event_consumers (name, last_txid, last_id, updated_at)
+SELECT 'webhooks', txid::text::bigint, id, NOW()
+FROM outbox
+WHERE dispatched_at IS NOT NULL
+ORDER BY txid DESC, id DESC
+LIMIT 1;
+
+DROP INDEX outbox_undispatched_idx;
+ALTER TABLE outbox DROP COLUMN dispatched_at;
+
+-- +goose Down
+ALTER TABLE outbox ADD COLUMN dispatched_at TIMESTAMP;
+UPDATE outbox SET dispatched_at = NOW();
+CREATE INDEX outbox_undispatched_idx ON outbox (id) WHERE dispatched_at IS NULL;
+DROP TABLE event_consumers;
+DROP INDEX outbox_position_idx;
+ALTER TABLE outbox DROP COLUMN txid;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT UNIQUE CHECK (handle ~ '^[a-z0-9_]{3,30}$');
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN handle;
@@ -0,0 +1,94 @@
+-- +goose Up
+CREATE TABLE actor_keys (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    public_key_pem TEXT NOT NULL,
+    private_key_pem TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE remote_actors (
+    id TEXT PRIMARY KEY,
+    handle TEXT NOT NULL,
+    inbox TEXT NOT NULL,
+    shared_inbox TEXT,
+    key_id TEXT NOT NULL UNIQUE,
+    public_key_pem TEXT NOT NULL,
+    fetched_at TIMESTAMP NOT NULL
+);
+
+-- remote actors following local users
+CREATE TABLE remote_followers (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id TEXT NOT NULL REFERENCES remote_actors(id) ON DELETE CASCADE,
+    follow_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, actor_id)
+);
+
+-- local users following remote actors
+CREATE TABLE remote_follows (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id TEXT NOT NULL REFERENCES remote_actors(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    UNIQUE (user_id, actor_id)
+);
+
+CREATE INDEX remote_follows_actor_idx ON remote_follows (actor_id);
+
+CREATE TABLE remote_posts (
+    id TEXT PRIMARY KEY,
+    actor_id TEXT NOT NULL REFERENCES remote_actors(id) ON DELETE CASCADE,
+    url TEXT,
+    content TEXT NOT NULL,
+    published_at TIMESTAMP NOT NULL,
+    received_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX remote_posts_actor_idx ON remote_posts (actor_id, published_at DESC);
+
+-- ids of activities already handled, since servers redeliver
+CREATE TABLE inbox_activities (
+    id TEXT PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE activity_deliveries (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    activity_id TEXT NOT NULL,
+    inbox TEXT NOT NULL,
+    body JSONB NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_attempt_at TIMESTAMP,
+    response_status INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (activity_id, inbox)
+);
+
+CREATE INDEX activity_deliveries_due_idx ON activity_deliveries (next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE notifications
+ADD COLUMN remote_actor_id TEXT REFERENCES remote_actors(id) ON DELETE CASCADE;
+
+-- federation starts with the chirps posted from now on
+INSERT INTO event_consumers (name, last_txid, last_id, updated_at)
+SELECT 'activitypub', txid::text::bigint, id, NOW()
+FROM outbox
+ORDER BY txid DESC, id DESC
+LIMIT 1;
+
+-- +goose Down
+ALTER TABLE notifications DROP COLUMN remote_actor_id;
+DELETE FROM event_consumers WHERE name = 'activitypub';
+DROP TABLE activity_deliveries;
+DROP TABLE inbox_activities;
+DROP TABLE remote_posts;
+DROP TABLE remote_follows;
+DROP TABLE remote_followers;
+DROP TABLE remote_actors;
+DROP TABLE actor_keys;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- One row per day (UTC). visitors is a HyperLogLog sketch of the day's
+-- visitors; it starts empty and is merged into by each flush.
+CREATE TABLE visit_buckets (
+    bucket_start DATE PRIMARY KEY,
+    hits BIGINT NOT NULL,
+    visitors BYTEA NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE visit_buckets;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- A first password for an account that signs in through an identity
+-- provider waits here, hashed, until the emailed link is opened.
+ALTER TABLE email_verifications
+ADD COLUMN hashed_password TEXT;
+
+-- +goose Down
+ALTER TABLE email_verifications
+DROP COLUMN hashed_password;
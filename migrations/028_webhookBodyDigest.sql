@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE webhook_events
+    ADD COLUMN body_size INTEGER,
+    ADD COLUMN body_sha256 TEXT;
+
+UPDATE webhook_events SET body_size = length(body), body_sha256 = encode(sha256(body), 'hex');
+
+-- rejected deliveries keep only the start of the body and no headers
+UPDATE webhook_events SET body = substring(body from 1 for 1024), headers = '{}'
+WHERE NOT verified;
+
+ALTER TABLE webhook_events
+    ALTER COLUMN body_size SET NOT NULL,
+    ALTER COLUMN body_sha256 SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE webhook_events
+    DROP COLUMN body_size,
+    DROP COLUMN body_sha256;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- one event can notify several users
+ALTER TABLE notifications DROP CONSTRAINT notifications_event_id_key;
+ALTER TABLE notifications ADD CONSTRAINT notifications_event_recipient_key UNIQUE (event_id, user_id);
+
+-- +goose Down
+ALTER TABLE notifications DROP CONSTRAINT notifications_event_recipient_key;
+DELETE FROM notifications n
+USING notifications dup
+WHERE n.event_id = dup.event_id AND (n.created_at, n.id) > (dup.created_at, dup.id);
+ALTER TABLE notifications ADD CONSTRAINT notifications_event_id_key UNIQUE (event_id);
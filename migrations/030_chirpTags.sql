@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE chirp_tags (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, tag)
+);
+
+CREATE INDEX chirp_tags_tag_idx ON chirp_tags (tag, created_at DESC);
+
+-- the application extracts tags from now on; this approximates it for the
+-- chirps already written
+INSERT INTO chirp_tags (chirp_id, tag, created_at)
+SELECT DISTINCT chirps.id, lower(m[1]), chirps.created_at
+FROM chirps, regexp_matches(chirps.body, '(?:^|\s)#([[:alnum:]_]+)', 'g') AS m
+WHERE char_length(m[1]) <= 64;
+
+-- +goose Down
+DROP TABLE chirp_tags;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- EventSource can't send an Authorization header, so browsers trade their
+-- access token for a one-time ticket to put in the stream URL. The ticket
+-- carries what the stream needs to know about the token behind it.
+CREATE TABLE stream_tickets (
+    ticket_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_id TEXT NOT NULL,
+    session_id UUID,
+    token_expires_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE stream_tickets;
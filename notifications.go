@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"main.go/internal/databases"
+	"main.go/internal/events"
+)
+
+// Likes only come from other servers for now; chirps can't be liked
+// locally.
+const (
+	notificationFollow  = "follow"
+	notificationLike    = "like"
+	notificationMention = "mention"
+)
+
+var notificationTypes = []string{notificationFollow, notificationLike, notificationMention}
+
+// maxMentions caps the users one chirp can notify.
+const maxMentions = 10
+
+// mentionPattern finds @handle. A mention has to start a word, so email
+// addresses don't count, and the trailing group catches @user@host, which
+// names an account elsewhere.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w+)(@?)`)
+
+// mentionedHandles returns the distinct handles mentioned in a chirp body.
+func mentionedHandles(body string) []string {
+	var handles []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(m[1])
+		if m[2] != "" || !handlePattern.MatchString(handle) || slices.Contains(handles, handle) {
+			continue
+		}
+		handles = append(handles, handle)
+		if len(handles) == maxMentions {
+			break
+		}
+	}
+	return handles
+}
+
+const eventNotificationCreated = "notification.created"
+
+// createNotifications is the event bus subscriber that turns domain events
+// into notifications.
+func (cfg *apiConfig) createNotifications(ctx context.Context, e events.Event) error {
+	switch e.Type {
+	case eventUserFollowed:
+		var followed userFollowed
+		err := json.Unmarshal(e.Payload, &followed)
+		if err != nil {
+			return err
+		}
+		return cfg.addNotification(ctx, databases.CreateNotificationParams{
+			UserID:  followed.FolloweeID,
+			Type:    notificationFollow,
+			ActorID: uuid.NullUUID{UUID: followed.FollowerID, Valid: true},
+			EventID: sql.NullInt64{Int64: e.ID, Valid: true},
+		})
+	case eventChirpCreated:
+		var chirp struct {
+			ID     uuid.UUID `json:"id"`
+			Body   string    `json:"body"`
+			UserID uuid.UUID `json:"user_id"`
+		}
+		err := json.Unmarshal(e.Payload, &chirp)
+		if err != nil {
+			return err
+		}
+		for _, handle := range mentionedHandles(chirp.Body) {
+			user, err := cfg.dbQueries.GetUserByHandle(ctx, sql.NullString{String: handle, Valid: true})
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if user.ID == chirp.UserID {
+				continue
+			}
+			err = cfg.addNotification(ctx, databases.CreateNotificationParams{
+				UserID:  user.ID,
+				Type:    notificationMention,
+				ActorID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+				ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+				EventID: sql.NullInt64{Int64: e.ID, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addNotification stores a notification and records it as an event for
+// live streams. Each notification remembers the event it came from, so a
+// redelivered event adds nothing, and a repeat of the same notification
+// within a day is dropped. Users who turned a type off get nothing of that
+// type.
+func (cfg *apiConfig) addNotification(ctx context.Context, params databases.CreateNotificationParams) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+	notification, err := qtx.CreateNotification(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = recordEvent(ctx, qtx, eventNotificationCreated, notificationCreated{
+		UserID:       notification.UserID,
+		Notification: notificationResponse(notification),
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	cfg.events.Notify()
+	return nil
+}
+
+type notificationCreated struct {
+	UserID       uuid.UUID    `json:"user_id"`
+	Notification Notification `json:"notification"`
+}
+
+type Notification struct {
+	ID      uuid.UUID  `json:"id"`
+	Type    string     `json:"type"`
+	ActorID *uuid.UUID `json:"actor_id"`
+	// RemoteActorID is the ActivityPub actor behind notifications from
+	// other servers, which have no ActorID.
+	RemoteActorID *string    `json:"remote_actor_id,omitempty"`
+	ChirpID       *uuid.UUID `json:"chirp_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReadAt        *time.Time `json:"read_at"`
+}
+
+func notificationResponse(n databases.Notification) Notification {
+	notification := Notification{
+		ID:        n.ID,
+		Type:      n.Type,
+		CreatedAt: n.CreatedAt,
+	}
+	if n.ActorID.Valid {
+		notification.ActorID = &n.ActorID.UUID
+	}
+	if n.RemoteActorID.Valid {
+		notification.RemoteActorID = &n.RemoteActorID.String
+	}
+	if n.ChirpID.Valid {
+		notification.ChirpID = &n.ChirpID.UUID
+	}
+	if n.ReadAt.Valid {
+		notification.ReadAt = &n.ReadAt.Time
+	}
+	return notification
+}
+
+// listNotifications returns the newest notifications first. ?unread=true
+// leaves out read ones, ?limit= caps the page (at most 100) and
+// ?before=<id> continues after the last notification of the previous page.
+func listNotifications(apiCfg *apiConfig) http.HandlerFunc {
+	type response struct {
+		Notifications []Notification `json:"notifications"`
+		UnreadCount   int64          `json:"unread_count"`
+		NextBefore    *uuid.UUID     `json:"next_before"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		query := r.URL.Query()
+		limit := 20
+		if v := query.Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				respondWithError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = min(limit, 100)
+		}
+		params := databases.ListNotificationsParams{
+			UserID:     userId,
+			UnreadOnly: query.Get("unread") == "true",
+			Limit:      int32(limit),
+		}
+		if v := query.Get("before"); v != "" {
+			before, err := uuid.Parse(v)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid before")
+				return
+			}
+			params.Before = uuid.NullUUID{UUID: before, Valid: true}
+		}
+		dbNotifications, err := apiCfg.dbQueries.ListNotifications(r.Context(), params)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		unread, err := apiCfg.dbQueries.CountUnreadNotifications(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		resp := response{Notifications: []Notification{}, UnreadCount: unread}
+		for _, n := range dbNotifications {
+			resp.Notifications = append(resp.Notifications, notificationResponse(n))
+		}
+		if len(dbNotifications) == limit {
+			resp.NextBefore = &dbNotifications[limit-1].ID
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+func markNotificationRead(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		notificationId, err := uuid.Parse(r.PathValue("notificationID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		rows, err := apiCfg.dbQueries.MarkNotificationRead(r.Context(), databases.MarkNotificationReadParams{
+			ID:     notificationId,
+			UserID: userId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+func markAllNotificationsRead(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		_, err = apiCfg.dbQueries.MarkAllNotificationsRead(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// notificationPreferences maps every notification type to whether the user
+// gets it. Types are on until turned off.
+func (cfg *apiConfig) notificationPreferences(ctx context.Context, userId uuid.UUID) (map[string]bool, error) {
+	dbPrefs, err := cfg.dbQueries.ListNotificationPreferences(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	prefs := map[string]bool{}
+	for _, t := range notificationTypes {
+		prefs[t] = true
+	}
+	for _, p := range dbPrefs {
+		if _, ok := prefs[p.Type]; ok {
+			prefs[p.Type] = p.Enabled
+		}
+	}
+	return prefs, nil
+}
+
+func getNotificationPreferences(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		prefs, err := apiCfg.notificationPreferences(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, prefs)
+	}
+}
+
+// updateNotificationPreferences takes a partial map such as
+// {"follow": false}; types left out keep their setting.
+func updateNotificationPreferences(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		changes := map[string]bool{}
+		err = json.NewDecoder(r.Body).Decode(&changes)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		for t := range changes {
+			if !slices.Contains(notificationTypes, t) {
+				respondWithError(w, http.StatusBadRequest, "Unknown notification type "+t)
+				return
+			}
+		}
+		for t, enabled := range changes {
+			err = apiCfg.dbQueries.SetNotificationPreference(r.Context(), databases.SetNotificationPreferenceParams{
+				UserID:  userId,
+				Type:    t,
+				Enabled: enabled,
+			})
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+		}
+		prefs, err := apiCfg.notificationPreferences(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, prefs)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMentionedHandles(t *testing.T) {
+	for body, want := range map[string][]string{
+		"hi @Alice and @bob_2, @alice again": {"alice", "bob_2"},
+		"@carol: morning":                    {"carol"},
+		"mail me at dave@example.com":        nil,
+		"@erin@mastodon.example says hi":     nil,
+		"@ab is too short, @@frank is noise": nil,
+		"(@grace) counts":                    {"grace"},
+	} {
+		if got := mentionedHandles(body); !slices.Equal(got, want) {
+			t.Errorf("mentionedHandles(%q) = %q, want %q", body, got, want)
+		}
+	}
+	var many string
+	for i := range 20 {
+		many += " @user" + string(rune('a'+i)) + "x"
+	}
+	if got := mentionedHandles(many); len(got) != maxMentions {
+		t.Errorf("got %d mentions, want %d", len(got), maxMentions)
+	}
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+const (
+	authorizationCodeTTL     = 10 * time.Minute
+	oauthAccessTokenTTL      = time.Hour
+	maxOAuthClientNameLength = 100
+	maxRedirectURIs          = 10
+)
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:   "Read your chirps",
+	auth.ScopeChirpsWrite:  "Post and delete chirps as you",
+	auth.ScopeProfileWrite: "Change your email address and password",
+}
+
+var (
+	errUnknownClient  = errors.New("unknown client")
+	errBadRedirectURI = errors.New("redirect_uri is not registered for this client")
+	errInvalidClient  = errors.New("client authentication failed")
+)
+
+// oauthError is an error the authorization server reports back to the
+// client using the codes from RFC 6749 section 4.1.2.1 and 5.2.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, oauthErr *oauthError) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	respondWithJSON(w, code, oauthErr)
+}
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientResponse(client databases.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// registerOAuthClient registers a third-party app owned by the caller.
+// Confidential clients get a secret, returned only in this response; public
+// clients (native and browser apps) rely on PKCE alone.
+func registerOAuthClient(apiCfg *apiConfig) http.HandlerFunc {
+	type paramBody struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		params := paramBody{}
+		err = decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		params.Name = strings.TrimSpace(params.Name)
+		if params.Name == "" || len(params.Name) > maxOAuthClientNameLength {
+			respondWithError(w, http.StatusBadRequest, "Name must be between 1 and 100 characters")
+			return
+		}
+		if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxRedirectURIs {
+			respondWithError(w, http.StatusBadRequest, "Register between 1 and 10 redirect URIs")
+			return
+		}
+		for _, uri := range params.RedirectURIs {
+			if !auth.ValidRedirectURI(uri) {
+				respondWithError(w, http.StatusBadRequest, "Redirect URIs must be absolute https URLs (http only for loopback)")
+				return
+			}
+		}
+		var secret string
+		secretHash := sql.NullString{}
+		if params.Confidential {
+			secret, err = auth.MakeRefreshToken()
+			if err != nil {
+				log.Printf("Error creating client secret: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+		}
+		client, err := apiCfg.dbQueries.CreateOAuthClient(r.Context(), databases.CreateOAuthClientParams{
+			UserID:       userId,
+			Name:         params.Name,
+			SecretHash:   secretHash,
+			RedirectUris: params.RedirectURIs,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		resp := oauthClientResponse(client)
+		resp.ClientSecret = secret
+		respondWithJSON(w, http.StatusCreated, resp)
+	}
+}
+
+func listOAuthClients(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		dbClients, err := apiCfg.dbQueries.ListOAuthClients(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		clients := []OAuthClient{}
+		for _, client := range dbClients {
+			clients = append(clients, oauthClientResponse(client))
+		}
+		respondWithJSON(w, http.StatusOK, clients)
+	}
+}
+
+func deleteOAuthClient(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		clientId, err := uuid.Parse(r.PathValue("clientID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid client id")
+			return
+		}
+		rows, err := apiCfg.dbQueries.DeleteOAuthClient(r.Context(), databases.DeleteOAuthClientParams{
+			ID:     clientId,
+			UserID: userId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// authorizeRequest is a validated authorization request (RFC 6749 4.1.1
+// with the PKCE parameters of RFC 7636).
+type authorizeRequest struct {
+	Client        databases.OauthClient
+	RedirectURI   string
+	State         string
+	Scopes        []string
+	CodeChallenge string
+}
+
+// parseAuthorizeRequest validates the client and redirect URI first. Until
+// both check out, errors must be shown to the user rather than redirected,
+// or we'd be an open redirector.
+func (cfg *apiConfig) parseAuthorizeRequest(r *http.Request, v url.Values) (authorizeRequest, error) {
+	req := authorizeRequest{State: v.Get("state")}
+	clientId, err := uuid.Parse(v.Get("client_id"))
+	if err != nil {
+		return req, errUnknownClient
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(r.Context(), clientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, errUnknownClient
+	}
+	if err != nil {
+		return req, err
+	}
+	redirectURI := v.Get("redirect_uri")
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return req, errBadRedirectURI
+	}
+	req.Client = client
+	req.RedirectURI = redirectURI
+	if v.Get("response_type") != "code" {
+		return req, &oauthError{Code: "unsupported_response_type", Description: "Only response_type=code is supported"}
+	}
+	req.CodeChallenge = v.Get("code_challenge")
+	if v.Get("code_challenge_method") != auth.PKCEMethodS256 || len(req.CodeChallenge) != 43 {
+		return req, &oauthError{Code: "invalid_request", Description: "PKCE with code_challenge_method=S256 is required"}
+	}
+	req.Scopes, err = auth.NormalizeScopes(strings.Fields(v.Get("scope")))
+	if err != nil || len(req.Scopes) == 0 {
+		return req, &oauthError{Code: "invalid_scope", Description: "Request at least one known scope"}
+	}
+	return req, nil
+}
+
+func redirectToClient(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values, code int) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		log.Printf("Error parsing registered redirect uri: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), code)
+}
+
+// writeAuthorizeError reports a failed authorization request: to the user
+// when the redirect URI can't be trusted, otherwise back to the client.
+func writeAuthorizeError(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error, redirectCode int) {
+	var oauthErr *oauthError
+	switch {
+	case errors.Is(err, errUnknownClient), errors.Is(err, errBadRedirectURI):
+		renderOAuthPage(w, http.StatusBadRequest, consentPage{Fatal: "This application sent an invalid request: " + err.Error() + "."})
+	case errors.As(err, &oauthErr):
+		params := url.Values{"error": {oauthErr.Code}, "error_description": {oauthErr.Description}}
+		if req.State != "" {
+			params.Set("state", req.State)
+		}
+		redirectToClient(w, r, req.RedirectURI, params, redirectCode)
+	default:
+		log.Printf("Error handling authorization request: %s", err)
+		w.WriteHeader(500)
+	}
+}
+
+type consentScope struct {
+	Name        string
+	Description string
+}
+
+type consentPage struct {
+	Fatal         string
+	Error         string
+	ClientName    string
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	Scopes        []consentScope
+	State         string
+	CodeChallenge string
+	Email         string
+}
+
+func newConsentPage(req authorizeRequest) consentPage {
+	page := consentPage{
+		ClientName:    req.Client.Name,
+		ClientID:      req.Client.ID.String(),
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(req.Scopes, " "),
+		State:         req.State,
+		CodeChallenge: req.CodeChallenge,
+	}
+	for _, scope := range req.Scopes {
+		page.Scopes = append(page.Scopes, consentScope{Name: scope, Description: scopeDescriptions[scope]})
+	}
+	return page
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Chirpy - Authorize application</title>
+</head>
+<body>
+{{if .Fatal}}
+<h1>Authorization failed</h1>
+<p>{{.Fatal}}</p>
+{{else}}
+<h1>{{.ClientName}} wants to access your Chirpy account</h1>
+<p>If you allow it, {{.ClientName}} will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{.Description}} (<code>{{.Name}}</code>)</li>
+{{end}}</ul>
+{{if .Error}}<p role="alert"><strong>{{.Error}}</strong></p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="S256">
+<p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label></p>
+<p><label>Password <input type="password" name="password" autocomplete="current-password" required></label></p>
+<p><label>Two-factor code (if enabled) <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code"></label></p>
+<p>
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</p>
+</form>
+<p>You will be sent back to {{.RedirectURI}}.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// renderOAuthPage serves the consent page. It collects credentials, so it
+// must never be framed or cached.
+func renderOAuthPage(w http.ResponseWriter, code int, page consentPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(code)
+	err := consentTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+func oauthAuthorize(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := apiCfg.parseAuthorizeRequest(r, r.URL.Query())
+		if err != nil {
+			writeAuthorizeError(w, r, req, err, http.StatusFound)
+			return
+		}
+		renderOAuthPage(w, http.StatusOK, newConsentPage(req))
+	}
+}
+
+// oauthConsent handles the consent form. The user signs in with their
+// password (and second factor) on the page itself, so no session cookie is
+// needed and the client never sees the credentials.
+func oauthConsent(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			renderOAuthPage(w, http.StatusBadRequest, consentPage{Fatal: "The form could not be read."})
+			return
+		}
+		req, err := apiCfg.parseAuthorizeRequest(r, r.PostForm)
+		if err != nil {
+			writeAuthorizeError(w, r, req, err, http.StatusSeeOther)
+			return
+		}
+		if r.PostForm.Get("decision") != "allow" {
+			writeAuthorizeError(w, r, req, &oauthError{Code: "access_denied", Description: "The user denied the request"}, http.StatusSeeOther)
+			return
+		}
+		page := newConsentPage(req)
+		page.Email = r.PostForm.Get("email")
+		dbUser, err := apiCfg.checkLogin(r, page.Email, r.PostForm.Get("password"))
+		var locked loginLockedError
+		switch {
+		case errors.As(err, &locked):
+			page.Error = "Too many failed attempts. Try again later."
+			renderOAuthPage(w, http.StatusTooManyRequests, page)
+			return
+		case errors.Is(err, errBadCredentials):
+			page.Error = "Incorrect email or password."
+			renderOAuthPage(w, http.StatusUnauthorized, page)
+			return
+		case err != nil:
+			log.Printf("Error checking login: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if dbUser.TotpEnabledAt.Valid {
+			err = apiCfg.checkSecondFactorLogin(r, apiCfg.dbQueries, dbUser, r.PostForm.Get("code"), "")
+			switch {
+			case errors.Is(err, errBadSecondFactor):
+				page.Error = "Enter a valid code from your authenticator app."
+				renderOAuthPage(w, http.StatusUnauthorized, page)
+				return
+			case errors.As(err, &locked):
+				page.Error = "Too many failed attempts. Try again later."
+				renderOAuthPage(w, http.StatusTooManyRequests, page)
+				return
+			case err != nil:
+				log.Printf("Error checking second factor: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+		}
+		code, err := auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error creating authorization code: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = apiCfg.dbQueries.CreateAuthorizationCode(r.Context(), databases.CreateAuthorizationCodeParams{
+			CodeHash:      auth.HashToken(code),
+			ClientID:      req.Client.ID,
+			UserID:        dbUser.ID,
+			RedirectUri:   req.RedirectURI,
+			Scopes:        strings.Join(req.Scopes, " "),
+			CodeChallenge: req.CodeChallenge,
+			ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		params := url.Values{"code": {code}}
+		if req.State != "" {
+			params.Set("state", req.State)
+		}
+		redirectToClient(w, r, req.RedirectURI, params, http.StatusSeeOther)
+	}
+}
+
+// authenticateClient identifies the client calling the token, revocation or
+// introspection endpoint, via HTTP Basic or client_id/client_secret in the
+// form body. Public clients identify themselves with client_id only.
+func (cfg *apiConfig) authenticateClient(r *http.Request) (databases.OauthClient, error) {
+	clientIdString, secret, ok := r.BasicAuth()
+	if !ok {
+		clientIdString = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	clientId, err := uuid.Parse(clientIdString)
+	if err != nil {
+		return databases.OauthClient{}, errInvalidClient
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(r.Context(), clientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return databases.OauthClient{}, errInvalidClient
+	}
+	if err != nil {
+		return databases.OauthClient{}, err
+	}
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return databases.OauthClient{}, errInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return databases.OauthClient{}, errInvalidClient
+	}
+	return client, nil
+}
+
+// parseClientRequest does the common start of the token, revocation and
+// introspection endpoints. It writes the error response itself.
+func (cfg *apiConfig) parseClientRequest(w http.ResponseWriter, r *http.Request) (databases.OauthClient, bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "invalid_request", Description: "Couldn't parse the form body"})
+		return databases.OauthClient{}, false
+	}
+	client, err := cfg.authenticateClient(r)
+	if errors.Is(err, errInvalidClient) {
+		respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{Code: "invalid_client", Description: "Client authentication failed"})
+		return databases.OauthClient{}, false
+	}
+	if err != nil {
+		log.Printf("Error executing query: %s", err)
+		w.WriteHeader(500)
+		return databases.OauthClient{}, false
+	}
+	return client, true
+}
+
+// oauthToken exchanges an authorization code for a scoped access token. Codes
+// are single use and bound to the client, redirect URI and PKCE challenge.
+func oauthToken(apiCfg *apiConfig) http.HandlerFunc {
+	type tokenResp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, ok := apiCfg.parseClientRequest(w, r)
+		if !ok {
+			return
+		}
+		if r.PostForm.Get("grant_type") != "authorization_code" {
+			respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "unsupported_grant_type", Description: "Only authorization_code is supported"})
+			return
+		}
+		invalidGrant := &oauthError{Code: "invalid_grant", Description: "The authorization code is invalid, expired or already used"}
+		code, err := apiCfg.dbQueries.UseAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthError(w, http.StatusBadRequest, invalidGrant)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+			respondWithOAuthError(w, http.StatusBadRequest, invalidGrant)
+			return
+		}
+		if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "invalid_grant", Description: "PKCE verification failed"})
+			return
+		}
+		scopes := strings.Fields(code.Scopes)
+		accessToken, err := auth.MakeScopedJWT(code.UserID, client.ID.String(), scopes, apiCfg.jwtConfig, oauthAccessTokenTTL)
+		if err != nil {
+			log.Printf("Error generating jwt: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, tokenResp{
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(oauthAccessTokenTTL.Seconds()),
+			Scope:       code.Scopes,
+		})
+	}
+}
+
+// clientTokenClaims returns the claims of token if it is a valid access
+// token issued to client, and nil otherwise.
+func clientTokenClaims(apiCfg *apiConfig, client databases.OauthClient, token string) *auth.AccessClaims {
+	claims, err := auth.ValidateJWT(token, apiCfg.jwtConfig)
+	if err != nil || claims.ClientID != client.ID.String() {
+		return nil
+	}
+	return claims
+}
+
+// oauthRevoke implements RFC 7009. Unknown and foreign tokens get the same
+// 200 as revoked ones so the endpoint can't be used to probe tokens.
+func oauthRevoke(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, ok := apiCfg.parseClientRequest(w, r)
+		if !ok {
+			return
+		}
+		claims := clientTokenClaims(apiCfg, client, r.PostForm.Get("token"))
+		if claims == nil {
+			w.WriteHeader(200)
+			return
+		}
+		userId, err := claims.UserID()
+		if err != nil {
+			w.WriteHeader(200)
+			return
+		}
+		err = apiCfg.dbQueries.DenyAccessToken(r.Context(), databases.DenyAccessTokenParams{
+			Jti:       claims.ID,
+			UserID:    userId,
+			ExpiresAt: claims.ExpiresAt.Time,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(200)
+	}
+}
+
+// oauthIntrospect implements RFC 7662 for confidential clients. A client can
+// only introspect tokens issued to itself; anything else is inactive.
+func oauthIntrospect(apiCfg *apiConfig) http.HandlerFunc {
+	type introspectResp struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		Exp       int64  `json:"exp,omitempty"`
+		Iat       int64  `json:"iat,omitempty"`
+		Sub       string `json:"sub,omitempty"`
+		Aud       string `json:"aud,omitempty"`
+		Iss       string `json:"iss,omitempty"`
+		Jti       string `json:"jti,omitempty"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, ok := apiCfg.parseClientRequest(w, r)
+		if !ok {
+			return
+		}
+		if !client.SecretHash.Valid {
+			respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{Code: "invalid_client", Description: "Introspection requires a confidential client"})
+			return
+		}
+		claims := clientTokenClaims(apiCfg, client, r.PostForm.Get("token"))
+		if claims == nil {
+			respondWithJSON(w, http.StatusOK, introspectResp{Active: false})
+			return
+		}
+		denied, err := apiCfg.dbQueries.IsAccessTokenDenied(r.Context(), claims.ID)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if denied {
+			respondWithJSON(w, http.StatusOK, introspectResp{Active: false})
+			return
+		}
+		respondWithJSON(w, http.StatusOK, introspectResp{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			TokenType: "Bearer",
+			Exp:       claims.ExpiresAt.Unix(),
+			Iat:       claims.IssuedAt.Unix(),
+			Sub:       claims.Subject,
+			Aud:       apiCfg.jwtConfig.Audience,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+		})
+	}
+}
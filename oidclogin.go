@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+	"main.go/internal/oidc"
+)
+
+const (
+	oidcLoginStateTTL = 10 * time.Minute
+	// oidcStateCookie ties a login attempt to the browser that started it,
+	// so a state minted by someone else can't be completed in it.
+	oidcStateCookie = "chirpy_oidc_state"
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// loadOIDCProviders reads the identity providers named in OIDC_PROVIDERS,
+// e.g. OIDC_PROVIDERS=corp with OIDC_CORP_ISSUER, OIDC_CORP_CLIENT_ID and
+// OIDC_CORP_CLIENT_SECRET.
+func loadOIDCProviders(baseURL string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !providerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid provider name %q", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/auth/oidc/" + name + "/callback",
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers[name] = oidc.NewProvider(cfg)
+	}
+	return providers, nil
+}
+
+// startOIDCLogin remembers state, nonce and PKCE verifier for the callback
+// and returns the provider URL to send the user to. linkUserId is set when a
+// signed-in user is attaching a provider to their account. The state's hash
+// also goes in a cookie that the callback checks.
+func startOIDCLogin(w http.ResponseWriter, r *http.Request, apiCfg *apiConfig, provider *oidc.Provider, linkUserId uuid.NullUUID) (string, error) {
+	ctx := r.Context()
+	state, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	err = apiCfg.dbQueries.CreateOIDCLoginState(ctx, databases.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserId,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		return "", err
+	}
+	setOIDCStateCookie(w, apiCfg, auth.HashToken(state), oidcLoginStateTTL)
+	return authURL, nil
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, apiCfg *apiConfig, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc/",
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   strings.HasPrefix(apiCfg.baseURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge <= 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// oidcStateMatches reports whether the request's state was started by this
+// browser.
+func oidcStateMatches(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(auth.HashToken(state))) == 1
+}
+
+func oidcLogin(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := apiCfg.oidcProviders[r.PathValue("provider")]
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Unknown identity provider")
+			return
+		}
+		authURL, err := startOIDCLogin(w, r, apiCfg, provider, uuid.NullUUID{})
+		if err != nil {
+			log.Printf("Error starting oidc login: %s", err)
+			respondWithError(w, http.StatusBadGateway, "Identity provider unavailable")
+			return
+		}
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// linkIdentity starts the provider flow for a signed-in user. The callback
+// then attaches the external identity to their account instead of logging in.
+// The response sets the state cookie, so it has to be requested from the
+// browser that will open the authorization URL.
+func linkIdentity(apiCfg *apiConfig) http.HandlerFunc {
+	type linkResp struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		provider, ok := apiCfg.oidcProviders[r.PathValue("provider")]
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Unknown identity provider")
+			return
+		}
+		authURL, err := startOIDCLogin(w, r, apiCfg, provider, uuid.NullUUID{UUID: userId, Valid: true})
+		if err != nil {
+			log.Printf("Error starting oidc login: %s", err)
+			respondWithError(w, http.StatusBadGateway, "Identity provider unavailable")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, linkResp{AuthorizationURL: authURL})
+	}
+}
+
+type Identity struct {
+	ID        uuid.UUID `json:"id"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func identityResponse(identity databases.UserIdentity) Identity {
+	return Identity{
+		ID:        identity.ID,
+		Provider:  identity.Provider,
+		Email:     identity.Email.String,
+		CreatedAt: identity.CreatedAt,
+	}
+}
+
+func oidcCallback(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := apiCfg.oidcProviders[r.PathValue("provider")]
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Unknown identity provider")
+			return
+		}
+		query := r.URL.Query()
+		if !oidcStateMatches(r, query.Get("state")) {
+			respondWithError(w, http.StatusBadRequest, "Login attempt wasn't started in this browser, start again")
+			return
+		}
+		setOIDCStateCookie(w, apiCfg, "", 0)
+		state, err := apiCfg.dbQueries.UseOIDCLoginState(r.Context(), databases.UseOIDCLoginStateParams{
+			StateHash: auth.HashToken(query.Get("state")),
+			Provider:  provider.Name(),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Login attempt expired or was already used, start again")
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if providerErr := query.Get("error"); providerErr != "" {
+			respondWithError(w, http.StatusUnauthorized, "Identity provider refused the login: "+providerErr)
+			return
+		}
+		rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier)
+		if err != nil {
+			log.Printf("Error exchanging oidc code: %s", err)
+			respondWithError(w, http.StatusBadGateway, "Couldn't complete login with the identity provider")
+			return
+		}
+		claims, err := provider.VerifyIDToken(r.Context(), rawIDToken, state.Nonce)
+		if err != nil {
+			log.Printf("Rejected id token from %s: %s", provider.Name(), err)
+			respondWithError(w, http.StatusUnauthorized, "Invalid identity token")
+			return
+		}
+		email := sql.NullString{}
+		if claims.IsEmailVerified() {
+			normalized, err := auth.NormalizeEmail(claims.Email)
+			if err == nil {
+				email = sql.NullString{String: normalized, Valid: true}
+			}
+		}
+		if state.LinkUserID.Valid {
+			identity, err := apiCfg.dbQueries.CreateUserIdentity(r.Context(), databases.CreateUserIdentityParams{
+				UserID:   state.LinkUserID.UUID,
+				Provider: provider.Name(),
+				Subject:  claims.Subject,
+				Email:    email,
+			})
+			if isUniqueViolation(err) {
+				respondWithError(w, http.StatusConflict, "This identity is already linked to an account")
+				return
+			}
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			respondWithJSON(w, http.StatusCreated, identityResponse(identity))
+			return
+		}
+		dbUser, err := oidcUser(r.Context(), apiCfg, provider.Name(), claims.Subject, email)
+		if errors.Is(err, errIdentityConflict) {
+			respondWithError(w, http.StatusConflict, "An account with this email already exists; sign in and link the provider from your account")
+			return
+		}
+		if errors.Is(err, errNoVerifiedEmail) {
+			respondWithError(w, http.StatusForbidden, "The identity provider did not supply a verified email address")
+			return
+		}
+		if err != nil {
+			log.Printf("Error resolving oidc user: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if dbUser.TotpEnabledAt.Valid {
+			writeTwoFactorChallenge(w, r, apiCfg, dbUser)
+			return
+		}
+		writeLoginResponse(w, r, apiCfg, dbUser)
+	}
+}
+
+var (
+	errIdentityConflict = errors.New("email belongs to an unlinked account")
+	errNoVerifiedEmail  = errors.New("provider did not return a verified email")
+)
+
+// oidcUser finds the user linked to an external identity, creating a
+// password-less account on first login. An existing account with the same
+// email is only linked automatically when both sides have verified that
+// address; otherwise its owner has to link the provider while signed in.
+func oidcUser(ctx context.Context, apiCfg *apiConfig, provider, subject string, email sql.NullString) (databases.User, error) {
+	identity, err := apiCfg.dbQueries.GetUserIdentity(ctx, databases.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+	})
+	if err == nil {
+		return apiCfg.dbQueries.GetUserById(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return databases.User{}, err
+	}
+	if !email.Valid {
+		return databases.User{}, errNoVerifiedEmail
+	}
+	tx, err := apiCfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return databases.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := apiCfg.withTx(tx)
+	dbUser, err := qtx.GetUserByEmail(ctx, email.String)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		dbUser, err = qtx.CreateOIDCUser(ctx, email.String)
+		if err != nil {
+			return databases.User{}, err
+		}
+	case err != nil:
+		return databases.User{}, err
+	case !dbUser.EmailVerifiedAt.Valid:
+		return databases.User{}, errIdentityConflict
+	}
+	_, err = qtx.CreateUserIdentity(ctx, databases.CreateUserIdentityParams{
+		UserID:   dbUser.ID,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	})
+	if err != nil {
+		return databases.User{}, err
+	}
+	return dbUser, tx.Commit()
+}
+
+func listIdentities(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		dbIdentities, err := apiCfg.dbQueries.ListUserIdentities(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		identities := []Identity{}
+		for _, identity := range dbIdentities {
+			identities = append(identities, identityResponse(identity))
+		}
+		respondWithJSON(w, http.StatusOK, identities)
+	}
+}
+
+// unlinkIdentity removes an external identity, unless it is the only way
+// left to sign in to the account.
+func unlinkIdentity(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		identityId, err := uuid.Parse(r.PathValue("identityID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid identity id")
+			return
+		}
+		dbUser, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if !dbUser.HashedPassword.Valid {
+			count, err := apiCfg.dbQueries.CountUserIdentities(r.Context(), userId)
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			if count <= 1 {
+				respondWithError(w, http.StatusConflict, "Set a password before removing your only sign-in method")
+				return
+			}
+		}
+		rows, err := apiCfg.dbQueries.DeleteUserIdentity(r.Context(), databases.DeleteUserIdentityParams{
+			ID:     identityId,
+			UserID: userId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	auth "main.go/internal"
+	"main.go/internal/oidc"
+)
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	var used atomic.Int32
+	db := newFakeDB()
+	db.on("UseOIDCLoginState", func([]driver.Value) (fakeResult, error) {
+		used.Add(1)
+		return fakeTable(), nil
+	})
+	cfg := &apiConfig{
+		baseURL:       "https://chirpy.example",
+		oidcProviders: map[string]*oidc.Provider{"corp": oidc.NewProvider(oidc.Config{Name: "corp"})},
+	}
+	cfg.db, cfg.dbQueries = db.open()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /auth/oidc/{provider}/callback", oidcCallback(cfg))
+	callback := func(cookie string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/auth/oidc/corp/callback?state=the-state&code=abc", nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, cookie := range []string{"", auth.HashToken("another-state")} {
+		if w := callback(cookie); w.Code != http.StatusBadRequest || used.Load() != 0 {
+			t.Errorf("with cookie %q: got %d, state used %d times", cookie, w.Code, used.Load())
+		}
+	}
+	w := callback(auth.HashToken("the-state"))
+	if used.Load() != 1 {
+		t.Fatalf("the matching cookie didn't reach the stored state (%d)", w.Code)
+	}
+	cleared := false
+	for _, c := range w.Result().Cookies() {
+		cleared = cleared || (c.Name == oidcStateCookie && c.MaxAge < 0)
+	}
+	if !cleared {
+		t.Error("the state cookie wasn't cleared")
+	}
+}
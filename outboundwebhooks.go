@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+	"main.go/internal/events"
+)
+
+const (
+	webhookSignatureHeader = "Chirpy-Signature"
+	webhookMaxAttempts     = 12
+	webhookBatchSize       = 50
+	webhookConcurrency     = 8
+	// webhookLease is how long ClaimWebhookDeliveries holds a delivery.
+	webhookLease = 5 * time.Minute
+)
+
+// Retries start after 30 seconds and back off to every six hours, which
+// gives an endpoint about a day and a half to come back.
+var webhookRetryBackoff = auth.Backoff{Free: 0, Base: 30 * time.Second, Max: 6 * time.Hour}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// queueWebhookDeliveries is the event bus subscriber that creates one
+// delivery per subscription interested in the event. Deliveries are unique
+// per subscription and event, so seeing an event twice is harmless.
+func (cfg *apiConfig) queueWebhookDeliveries(ctx context.Context, e events.Event) error {
+	return cfg.dbQueries.CreateWebhookDeliveries(ctx, databases.CreateWebhookDeliveriesParams{
+		OutboxID:  e.ID,
+		EventType: e.Type,
+	})
+}
+
+// deliverWebhooks attempts the deliveries that are due. Claimed deliveries
+// are leased, so several instances can run this without sending the same
+// attempt twice. The batch is sent a few at a time and given half the lease;
+// whatever hasn't started by then is left for the lease to expire, rather
+// than being sent while another instance may have claimed it again.
+func (cfg *apiConfig) deliverWebhooks(ctx context.Context) error {
+	deliveries, err := cfg.dbQueries.ClaimWebhookDeliveries(ctx, webhookBatchSize)
+	if err != nil {
+		return fmt.Errorf("claiming deliveries: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookLease/2)
+	defer cancel()
+	sem := make(chan struct{}, webhookConcurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, delivery := range deliveries {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cfg.attemptWebhookDelivery(ctx, delivery)
+		}()
+	}
+	return nil
+}
+
+type outboundWebhook struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func (cfg *apiConfig) attemptWebhookDelivery(ctx context.Context, delivery databases.ClaimWebhookDeliveriesRow) {
+	eventId := strconv.FormatInt(delivery.EventID, 10)
+	body, err := json.Marshal(outboundWebhook{
+		ID:        eventId,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		log.Printf("Error encoding webhook %s: %s", delivery.ID, err)
+		return
+	}
+	update := databases.UpdateWebhookDeliveryParams{
+		ID:            delivery.ID,
+		Status:        "delivered",
+		Attempts:      delivery.Attempts + 1,
+		NextAttemptAt: time.Now(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Chirpy-Event-Id", eventId)
+		req.Header.Set("Chirpy-Event-Type", delivery.EventType)
+		req.Header.Set(webhookSignatureHeader, auth.SignWebhook([]byte(delivery.Secret), time.Now(), body))
+		var resp *http.Response
+		resp, err = webhookClient.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			update.ResponseStatus = sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true}
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("endpoint answered %s", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		update.LastError = sql.NullString{String: err.Error(), Valid: true}
+		update.Status = "pending"
+		update.NextAttemptAt = time.Now().Add(webhookRetryBackoff.Delay(int(update.Attempts)))
+		if update.Attempts >= webhookMaxAttempts {
+			update.Status = "failed"
+		}
+	}
+	err = cfg.dbQueries.UpdateWebhookDelivery(context.WithoutCancel(ctx), update)
+	if err != nil {
+		log.Printf("Error recording webhook delivery %s: %s", delivery.ID, err)
+	}
+}
+
+type WebhookSubscription struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+}
+
+func webhookSubscriptionResponse(s databases.WebhookSubscription) WebhookSubscription {
+	return WebhookSubscription{
+		ID:         s.ID,
+		CreatedAt:  s.CreatedAt,
+		URL:        s.Url,
+		EventTypes: s.EventTypes,
+	}
+}
+
+// createWebhookSubscription registers an endpoint for some event types. The
+// signing secret is generated here and shown only in this response.
+func createWebhookSubscription(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		type parameters struct {
+			URL        string   `json:"url"`
+			EventTypes []string `json:"event_types"`
+		}
+		params := parameters{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		u, err := url.Parse(params.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			respondWithError(w, http.StatusBadRequest, "url must be an absolute http or https URL")
+			return
+		}
+		if len(params.EventTypes) == 0 {
+			respondWithError(w, http.StatusBadRequest, "event_types must not be empty")
+			return
+		}
+		for _, eventType := range params.EventTypes {
+			if !slices.Contains(outboundEventTypes, eventType) {
+				respondWithError(w, http.StatusBadRequest, "Unknown event type "+eventType)
+				return
+			}
+		}
+		b := make([]byte, 32)
+		_, err = rand.Read(b)
+		if err != nil {
+			log.Printf("Error generating webhook secret: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		subscription, err := apiCfg.dbQueries.CreateWebhookSubscription(r.Context(), databases.CreateWebhookSubscriptionParams{
+			Url:        u.String(),
+			Secret:     "whsec_" + hex.EncodeToString(b),
+			EventTypes: params.EventTypes,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		resp := webhookSubscriptionResponse(subscription)
+		resp.Secret = subscription.Secret
+		respondWithJSON(w, http.StatusCreated, resp)
+	}
+}
+
+func listWebhookSubscriptions(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		dbSubscriptions, err := apiCfg.dbQueries.ListWebhookSubscriptions(r.Context())
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		subscriptions := []WebhookSubscription{}
+		for _, s := range dbSubscriptions {
+			subscriptions = append(subscriptions, webhookSubscriptionResponse(s))
+		}
+		respondWithJSON(w, http.StatusOK, subscriptions)
+	}
+}
+
+func deleteWebhookSubscription(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		subscriptionId, err := uuid.Parse(r.PathValue("subscriptionID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		rows, err := apiCfg.dbQueries.DeleteWebhookSubscription(r.Context(), subscriptionId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseStatus *int32     `json:"response_status"`
+	LastError      *string    `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// listWebhookDeliveries is the delivery log of one subscription.
+func listWebhookDeliveries(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		subscriptionId, err := uuid.Parse(r.PathValue("subscriptionID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		dbDeliveries, err := apiCfg.dbQueries.ListWebhookDeliveries(r.Context(), subscriptionId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		deliveries := []WebhookDelivery{}
+		for _, d := range dbDeliveries {
+			delivery := WebhookDelivery{
+				ID:        d.ID,
+				EventID:   d.OutboxID,
+				EventType: d.EventType,
+				Status:    d.Status,
+				Attempts:  d.Attempts,
+				CreatedAt: d.CreatedAt,
+			}
+			if d.Status == "pending" {
+				delivery.NextAttemptAt = &d.NextAttemptAt
+			}
+			if d.LastAttemptAt.Valid {
+				delivery.LastAttemptAt = &d.LastAttemptAt.Time
+			}
+			if d.ResponseStatus.Valid {
+				delivery.ResponseStatus = &d.ResponseStatus.Int32
+			}
+			if d.LastError.Valid {
+				delivery.LastError = &d.LastError.String
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		respondWithJSON(w, http.StatusOK, deliveries)
+	}
+}
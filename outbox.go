@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"main.go/internal/databases"
+)
+
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserCreated  = "user.created"
+	eventUserUpdated  = "user.updated"
+	eventUserUpgraded = "user.upgraded"
+)
+
+var outboundEventTypes = []string{eventChirpCreated, eventChirpDeleted, eventUserCreated, eventUserUpdated, eventUserUpgraded}
+
+// recordEvent adds an event to the outbox. Pass the Queries of the
+// transaction making the change, so the event exists exactly when the
+// change does. Subscribers on cfg.events see it once the transaction has
+// committed; calling cfg.events.Notify after the commit saves them waiting
+// for the next tick.
+func recordEvent(ctx context.Context, q *databases.Queries, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return q.CreateOutboxEvent(ctx, databases.CreateOutboxEventParams{
+		EventType: eventType,
+		Payload:   payload,
+	})
+}
+
+type userUpdated struct {
+	ID        uuid.UUID `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Changed   []string  `json:"changed"`
+}
+
+// userUpdatedEvent says which fields changed without carrying their values;
+// subscribers that need the new email read it themselves.
+func userUpdatedEvent(user databases.User, changed ...string) userUpdated {
+	return userUpdated{ID: user.ID, UpdatedAt: user.UpdatedAt, Changed: changed}
+}
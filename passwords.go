@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+// loadPasswordConfig reads the hashing cost and password policy. Defaults
+// are argon2id as in auth.DefaultPasswordHashing and 8 to 128 characters.
+func loadPasswordConfig() (auth.PasswordHashing, auth.PasswordPolicy, error) {
+	hashing := auth.DefaultPasswordHashing()
+	policy := auth.PasswordPolicy{MinLength: 8, MaxLength: 128}
+	hashing.Algorithm = envOrDefault("PASSWORD_HASH", hashing.Algorithm)
+	ints := []struct {
+		key  string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_TIME", 32, func(v uint64) { hashing.Argon2.Time = uint32(v) }},
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { hashing.Argon2.MemoryKiB = uint32(v) }},
+		{"ARGON2_THREADS", 8, func(v uint64) { hashing.Argon2.Threads = uint8(v) }},
+		{"BCRYPT_COST", 8, func(v uint64) { hashing.BcryptCost = int(v) }},
+		{"PASSWORD_MIN_LENGTH", 16, func(v uint64) { policy.MinLength = int(v) }},
+		{"PASSWORD_MAX_LENGTH", 16, func(v uint64) { policy.MaxLength = int(v) }},
+	}
+	for _, setting := range ints {
+		raw := os.Getenv(setting.key)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(raw, 10, setting.bits)
+		if err != nil {
+			return hashing, policy, fmt.Errorf("invalid %s: %w", setting.key, err)
+		}
+		setting.set(v)
+	}
+	err := hashing.Validate()
+	if err != nil {
+		return hashing, policy, err
+	}
+	if policy.MinLength < 1 || policy.MaxLength < policy.MinLength {
+		return hashing, policy, fmt.Errorf("PASSWORD_MAX_LENGTH must be at least PASSWORD_MIN_LENGTH, which must be positive")
+	}
+	policy.BreachedDir = os.Getenv("BREACHED_PASSWORDS_DIR")
+	if policy.BreachedDir != "" {
+		info, err := os.Stat(policy.BreachedDir)
+		if err != nil || !info.IsDir() {
+			return hashing, policy, fmt.Errorf("BREACHED_PASSWORDS_DIR %q is not a directory", policy.BreachedDir)
+		}
+	}
+	return hashing, policy, nil
+}
+
+// checkNewPassword applies the password policy and returns a message fit for
+// the client when the password is refused.
+func (cfg *apiConfig) checkNewPassword(password string) (string, error) {
+	err := cfg.passwordPolicy.Check(password)
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.Is(err, auth.ErrPasswordTooShort):
+		return fmt.Sprintf("Password must be at least %d characters", cfg.passwordPolicy.MinLength), nil
+	case errors.Is(err, auth.ErrPasswordTooLong):
+		return fmt.Sprintf("Password must be at most %d characters", cfg.passwordPolicy.MaxLength), nil
+	case errors.Is(err, auth.ErrPasswordBreached):
+		return "This password has appeared in a data breach, choose another one", nil
+	}
+	return "", err
+}
+
+// checkUserPassword compares password with the user's hash. Accounts created
+// through an external identity provider have no password and never match,
+// after the same amount of work as a real comparison.
+func (cfg *apiConfig) checkUserPassword(dbUser databases.User, password string) error {
+	if !dbUser.HashedPassword.Valid {
+		auth.CheckPasswordHash(password, cfg.dummyPasswordHash)
+		return errNoPassword
+	}
+	return auth.CheckPasswordHash(password, dbUser.HashedPassword.String)
+}
+
+// rehashPassword upgrades a hash made with an older algorithm or cost once
+// the user has proven they know the password. It only replaces the hash it
+// checked against, so it can't undo a concurrent password change.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, dbUser databases.User, password string) {
+	if !dbUser.HashedPassword.Valid || !cfg.passwordHashing.NeedsRehash(dbUser.HashedPassword.String) {
+		return
+	}
+	hash, err := cfg.passwordHashing.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+	err = cfg.dbQueries.RehashUserPassword(ctx, databases.RehashUserPasswordParams{
+		NewHash: sql.NullString{String: hash, Valid: true},
+		ID:      dbUser.ID,
+		OldHash: dbUser.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error storing rehashed password: %s", err)
+	}
+}
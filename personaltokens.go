@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+const maxPersonalTokenNameLength = 100
+
+type PersonalToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func personalTokenResponse(pat databases.PersonalAccessToken) PersonalToken {
+	resp := PersonalToken{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    strings.Fields(pat.Scopes),
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt.Valid {
+		resp.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		resp.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return resp
+}
+
+// createPersonalToken mints a long-lived token for bots and scripts. The
+// plaintext token is only ever returned here; we keep its hash.
+func createPersonalToken(apiCfg *apiConfig) http.HandlerFunc {
+	type paramBody struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		params := paramBody{}
+		err = decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		params.Name = strings.TrimSpace(params.Name)
+		if params.Name == "" || len(params.Name) > maxPersonalTokenNameLength {
+			respondWithError(w, http.StatusBadRequest, "Name must be between 1 and 100 characters")
+			return
+		}
+		scopes, err := auth.NormalizeScopes(params.Scopes)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(scopes) == 0 {
+			respondWithError(w, http.StatusBadRequest, "At least one scope is required")
+			return
+		}
+		if params.ExpiresInDays < 0 {
+			respondWithError(w, http.StatusBadRequest, "expires_in_days can't be negative")
+			return
+		}
+		expiresAt := sql.NullTime{}
+		if params.ExpiresInDays > 0 {
+			expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+		}
+		token, err := auth.MakePersonalAccessToken()
+		if err != nil {
+			log.Printf("Error creating personal access token: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		pat, err := apiCfg.dbQueries.CreatePersonalAccessToken(r.Context(), databases.CreatePersonalAccessTokenParams{
+			UserID:    userId,
+			Name:      params.Name,
+			TokenHash: auth.HashToken(token),
+			Scopes:    strings.Join(scopes, " "),
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		resp := personalTokenResponse(pat)
+		resp.Token = token
+		respondWithJSON(w, http.StatusCreated, resp)
+	}
+}
+
+func listPersonalTokens(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		pats, err := apiCfg.dbQueries.ListPersonalAccessTokens(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		tokens := []PersonalToken{}
+		for _, pat := range pats {
+			tokens = append(tokens, personalTokenResponse(pat))
+		}
+		respondWithJSON(w, http.StatusOK, tokens)
+	}
+}
+
+func revokePersonalToken(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		tokenId, err := uuid.Parse(r.PathValue("tokenID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid token id")
+			return
+		}
+		rows, err := apiCfg.dbQueries.RevokePersonalAccessToken(r.Context(), databases.RevokePersonalAccessTokenParams{
+			ID:     tokenId,
+			UserID: userId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
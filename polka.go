@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+const polkaSignatureHeader = "Polka-Signature"
+
+// loadPolkaVerifier reads the webhook secrets. POLKA_KEY_PREVIOUS keeps the
+// old secret valid while Polka is switched over to a new POLKA_KEY.
+func loadPolkaVerifier() (auth.WebhookVerifier, error) {
+	verifier := auth.WebhookVerifier{Tolerance: 5 * time.Minute}
+	for _, env := range []string{"POLKA_KEY", "POLKA_KEY_PREVIOUS"} {
+		if v := os.Getenv(env); v != "" {
+			verifier.Secrets = append(verifier.Secrets, []byte(v))
+		}
+	}
+	if v := os.Getenv("POLKA_SIGNATURE_TOLERANCE"); v != "" {
+		tolerance, err := time.ParseDuration(v)
+		if err != nil || tolerance <= 0 {
+			return auth.WebhookVerifier{}, errors.New("POLKA_SIGNATURE_TOLERANCE must be a positive duration")
+		}
+		verifier.Tolerance = tolerance
+	}
+	return verifier, nil
+}
+
+// A Chirpy Red period lasts this long unless the event says when it ends.
+const subscriptionPeriod = 30 * 24 * time.Hour
+
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserId    uuid.UUID  `json:"user_id"`
+		Plan      string     `json:"plan"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	} `json:"data"`
+}
+
+func (e polkaEvent) plan() string {
+	if e.Data.Plan == "" {
+		return "red"
+	}
+	return e.Data.Plan
+}
+
+func (e polkaEvent) expiresAt() time.Time {
+	if e.Data.ExpiresAt == nil {
+		return time.Now().Add(subscriptionPeriod)
+	}
+	return *e.Data.ExpiresAt
+}
+
+var errUnknownPolkaUser = errors.New("polka event for unknown user")
+
+// applyPolkaEvent moves a user's subscription along. Cancelled and past-due
+// subscriptions keep Chirpy Red until the paid period ends, when
+// ExpireSubscriptions takes it away; a refund takes it away at once. Events
+// we don't know are ignored.
+func applyPolkaEvent(ctx context.Context, q *databases.Queries, event polkaEvent) error {
+	userId := event.Data.UserId
+	switch event.Event {
+	case "user.upgraded", "user.renewed":
+		_, err := q.UpgradeToRed(ctx, userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errUnknownPolkaUser
+		}
+		if err != nil {
+			return err
+		}
+		if event.Event == "user.upgraded" {
+			err = recordEvent(ctx, q, eventUserUpgraded, map[string]any{
+				"id":   userId,
+				"plan": event.plan(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if event.Event == "user.renewed" {
+			rows, err := q.RenewSubscription(ctx, databases.RenewSubscriptionParams{
+				UserID:    userId,
+				Plan:      event.plan(),
+				ExpiresAt: event.expiresAt(),
+			})
+			if err != nil || rows == 1 {
+				return err
+			}
+		}
+		_, err = q.StartSubscription(ctx, databases.StartSubscriptionParams{
+			UserID:    userId,
+			Plan:      event.plan(),
+			ExpiresAt: event.expiresAt(),
+		})
+		return err
+	case "user.payment_failed":
+		_, err := q.SetSubscriptionStatus(ctx, databases.SetSubscriptionStatusParams{UserID: userId, Status: "past_due"})
+		return err
+	case "user.downgraded":
+		_, err := q.SetSubscriptionStatus(ctx, databases.SetSubscriptionStatusParams{UserID: userId, Status: "cancelled"})
+		return err
+	case "user.refunded":
+		_, err := q.RefundSubscription(ctx, userId)
+		if err != nil {
+			return err
+		}
+		return q.DowngradeFromRed(ctx, userId)
+	}
+	return nil
+}
+
+// upgradeToRed receives Polka webhooks. Deliveries are signed over the raw
+// body, and each event id is recorded in the same transaction that applies
+// it, so a redelivered event is acknowledged without being applied twice.
+// Every delivery is kept in the webhook log, though rejected ones only in
+// part.
+func upgradeToRed(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		receivedAt := time.Now()
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		status, result := 401, ""
+		err = apiCfg.polkaVerifier.Verify(r.Header.Get(polkaSignatureHeader), body, receivedAt)
+		if err != nil {
+			result = "rejected: " + err.Error()
+		} else {
+			status, result = apiCfg.processPolkaEvent(r.Context(), body)
+		}
+		apiCfg.logWebhook(r.Context(), webhookDelivery{
+			source:     "polka",
+			header:     r.Header,
+			body:       body,
+			verified:   err == nil,
+			receivedAt: receivedAt,
+			status:     status,
+			result:     result,
+		})
+		w.WriteHeader(status)
+	}
+}
+
+// processPolkaEvent applies a verified delivery and returns the status to
+// answer Polka with and a short description of what happened. Replays from
+// the webhook log go through here too.
+func (cfg *apiConfig) processPolkaEvent(ctx context.Context, body []byte) (int, string) {
+	event := polkaEvent{}
+	err := json.Unmarshal(body, &event)
+	if err != nil || event.ID == "" {
+		return http.StatusBadRequest, "invalid event"
+	}
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		return 500, "error: " + err.Error()
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+	rows, err := qtx.RecordPolkaEvent(ctx, databases.RecordPolkaEventParams{
+		ID:    event.ID,
+		Event: event.Event,
+	})
+	if err != nil {
+		log.Printf("Error recording Polka event: %s", err)
+		return 500, "error: " + err.Error()
+	}
+	if rows == 0 {
+		// already applied; Polka only needs the acknowledgement
+		return 204, "duplicate"
+	}
+	err = applyPolkaEvent(ctx, qtx, event)
+	if errors.Is(err, errUnknownPolkaUser) {
+		return 404, "unknown user"
+	}
+	if err != nil {
+		log.Printf("Error applying Polka event %s: %s", event.ID, err)
+		return 500, "error: " + err.Error()
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		return 500, "error: " + err.Error()
+	}
+	cfg.events.Notify()
+	return 204, "applied " + event.Event
+}
+
+type Subscription struct {
+	Plan        string     `json:"plan"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	RenewedAt   *time.Time `json:"renewed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	IsChirpyRed bool       `json:"is_chirpy_red"`
+}
+
+func getSubscription(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		dbSubscription, err := apiCfg.dbQueries.GetSubscription(r.Context(), userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "No subscription")
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		subscription := Subscription{
+			Plan:      dbSubscription.Plan,
+			Status:    dbSubscription.Status,
+			StartedAt: dbSubscription.StartedAt,
+			ExpiresAt: dbSubscription.ExpiresAt,
+			// the expiry job runs periodically, so don't wait for it here
+			IsChirpyRed: dbSubscription.Status != "refunded" && dbSubscription.ExpiresAt.After(time.Now()),
+		}
+		if dbSubscription.RenewedAt.Valid {
+			subscription.RenewedAt = &dbSubscription.RenewedAt.Time
+		}
+		respondWithJSON(w, http.StatusOK, subscription)
+	}
+}
@@ -0,0 +1,4 @@
+-- name: AcceptRemoteFollow :execrows
+UPDATE remote_follows
+SET accepted_at = NOW()
+WHERE id = $1 AND actor_id = $2 AND accepted_at IS NULL;
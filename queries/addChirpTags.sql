@@ -0,0 +1,3 @@
+-- name: AddChirpTags :exec
+INSERT INTO chirp_tags (chirp_id, tag, created_at)
+SELECT sqlc.arg(chirp_id)::uuid, unnest(sqlc.arg(tags)::text[]), sqlc.arg(created_at)::timestamp;
@@ -0,0 +1,5 @@
+-- name: AddRemoteFollower :exec
+INSERT INTO remote_followers (user_id, actor_id, follow_id, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id, actor_id) DO UPDATE
+SET follow_id = EXCLUDED.follow_id;
@@ -0,0 +1,6 @@
+-- name: AddVisits :exec
+UPDATE visit_buckets
+SET hits = hits + $2,
+    visitors = $3,
+    updated_at = NOW()
+WHERE bucket_start = $1;
@@ -0,0 +1,7 @@
+-- name: AttemptLoginChallenge :one
+-- counts the attempt up front, so parallel guesses can't all pass the limit
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = sqlc.arg(token_hash) AND attempts < sqlc.arg(max_attempts)::int
+  AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
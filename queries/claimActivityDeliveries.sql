@@ -0,0 +1,13 @@
+-- name: ClaimActivityDeliveries :many
+UPDATE activity_deliveries d
+SET next_attempt_at = NOW() + INTERVAL '5 minutes'
+FROM actor_keys k
+WHERE d.id IN (
+    SELECT id FROM activity_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+  AND k.user_id = d.user_id
+RETURNING d.id, d.user_id, d.inbox, d.body, d.attempts, k.private_key_pem;
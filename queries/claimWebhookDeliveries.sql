@@ -0,0 +1,14 @@
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries d
+SET next_attempt_at = NOW() + INTERVAL '5 minutes'
+FROM webhook_subscriptions s, outbox o
+WHERE d.id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+  AND s.id = d.subscription_id
+  AND o.id = d.outbox_id
+RETURNING d.id, d.attempts, s.url, s.secret, o.id AS event_id, o.event_type, o.payload, o.created_at;
@@ -0,0 +1,3 @@
+-- name: ClearLoginFailures :execrows
+DELETE FROM login_failures
+WHERE key = $1;
@@ -0,0 +1,6 @@
+-- name: CountActiveUsers :one
+-- last_used_at is touched by authenticated requests (TouchSession, at most
+-- once a minute), so this counts users who used the API, not just those who
+-- logged in or refreshed.
+SELECT COUNT(DISTINCT user_id) FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > NOW() AND last_used_at > NOW() - INTERVAL '24 hours';
@@ -0,0 +1,3 @@
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities
+WHERE user_id = $1;
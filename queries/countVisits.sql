@@ -0,0 +1,2 @@
+-- name: CountVisits :one
+SELECT COALESCE(SUM(hits), 0)::BIGINT AS visits FROM visit_buckets;
@@ -0,0 +1,4 @@
+-- name: CreateActorKey :exec
+INSERT INTO actor_keys (user_id, public_key_pem, private_key_pem, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id) DO NOTHING;
@@ -0,0 +1,12 @@
+-- name: CreateEmailVerification :one
+INSERT INTO email_verifications (token_hash, created_at, user_id, email, expires_at, purpose, hashed_password)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
@@ -0,0 +1,8 @@
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, created_at, user_id, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+);
@@ -0,0 +1,19 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, user_id, type, actor_id, chirp_id, event_id, remote_actor_id, created_at)
+SELECT gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW()
+WHERE NOT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE user_id = $1 AND type = $2 AND NOT enabled
+)
+  -- the same notification within a day, say from following, unfollowing
+  -- and following again, is only shown once
+  AND NOT EXISTS (
+    SELECT 1 FROM notifications
+    WHERE user_id = $1 AND type = $2
+      AND actor_id IS NOT DISTINCT FROM $3
+      AND chirp_id IS NOT DISTINCT FROM $4
+      AND remote_actor_id IS NOT DISTINCT FROM $6
+      AND created_at > NOW() - INTERVAL '1 day'
+)
+ON CONFLICT (event_id, user_id) DO NOTHING
+RETURNING *;
@@ -0,0 +1,11 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, user_id, name, secret_hash, redirect_uris)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
@@ -0,0 +1,10 @@
+-- name: CreateOIDCUser :one
+INSERT INTO users (id, created_at, updated_at, email, email_verified_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    NOW()
+)
+RETURNING *;
@@ -0,0 +1,3 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox (event_type, payload, created_at)
+VALUES ($1, $2, NOW());
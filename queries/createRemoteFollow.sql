@@ -0,0 +1,7 @@
+-- name: CreateRemoteFollow :one
+INSERT INTO remote_follows (id, user_id, actor_id, created_at)
+VALUES (gen_random_uuid(), $1, $2, NOW())
+-- following again returns the existing follow, so its Follow can be resent
+ON CONFLICT (user_id, actor_id) DO UPDATE
+SET user_id = EXCLUDED.user_id
+RETURNING *;
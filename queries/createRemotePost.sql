@@ -0,0 +1,9 @@
+-- name: CreateRemotePost :execrows
+-- only posts from actors someone here follows are kept
+INSERT INTO remote_posts (id, actor_id, url, content, published_at, received_at)
+SELECT $1, $2, $3, $4, $5, NOW()
+WHERE EXISTS (
+    SELECT 1 FROM remote_follows
+    WHERE actor_id = $2 AND accepted_at IS NOT NULL
+)
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,9 @@
+-- name: CreateSigningKey :exec
+INSERT INTO signing_keys (kid, algorithm, private_key, created_at, activates_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    $4
+);
@@ -0,0 +1,11 @@
+-- name: CreateStreamTicket :exec
+INSERT INTO stream_tickets (ticket_hash, created_at, user_id, token_id, session_id, token_expires_at, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
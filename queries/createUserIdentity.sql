@@ -0,0 +1,11 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (id, created_at, user_id, provider, subject, email)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
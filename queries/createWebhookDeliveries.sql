@@ -0,0 +1,6 @@
+-- name: CreateWebhookDeliveries :exec
+INSERT INTO webhook_deliveries (id, subscription_id, outbox_id, status, attempts, next_attempt_at, created_at)
+SELECT gen_random_uuid(), id, $1, 'pending', 0, NOW(), NOW()
+FROM webhook_subscriptions
+WHERE $2::text = ANY(event_types)
+ON CONFLICT (subscription_id, outbox_id) DO NOTHING;
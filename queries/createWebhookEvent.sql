@@ -0,0 +1,4 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, source, received_at, headers, body, verified, status_code, result, duration_ms, replay_of, body_size, body_sha256)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING *;
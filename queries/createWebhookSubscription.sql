@@ -0,0 +1,4 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (id, created_at, url, secret, event_types)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3)
+RETURNING *;
@@ -0,0 +1,3 @@
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,3 @@
+-- name: DeleteRemoteActor :exec
+DELETE FROM remote_actors
+WHERE id = $1;
@@ -0,0 +1,4 @@
+-- name: DeleteRemoteFollow :one
+DELETE FROM remote_follows
+WHERE id = $1 AND user_id = $2
+RETURNING *;
@@ -0,0 +1,3 @@
+-- name: DeleteRemotePost :execrows
+DELETE FROM remote_posts
+WHERE id = $1 AND actor_id = $2;
@@ -0,0 +1,3 @@
+-- name: DeleteSigningKey :exec
+DELETE FROM signing_keys
+WHERE kid = $1;
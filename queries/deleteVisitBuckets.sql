@@ -0,0 +1,2 @@
+-- name: DeleteVisitBuckets :exec
+DELETE FROM visit_buckets;
@@ -0,0 +1,9 @@
+-- name: DenyAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, user_id, revoked_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3
+)
+ON CONFLICT (jti) DO NOTHING;
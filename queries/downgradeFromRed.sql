@@ -0,0 +1,4 @@
+-- name: DowngradeFromRed :exec
+UPDATE users
+SET is_chirpy_red = FALSE, updated_at = NOW()
+WHERE id = $1;
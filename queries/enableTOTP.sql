@@ -0,0 +1,4 @@
+-- name: EnableTOTP :exec
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+WHERE id = $2;
@@ -0,0 +1,11 @@
+-- name: ExpireSubscriptions :exec
+WITH expired AS (
+    UPDATE subscriptions
+    SET status = 'expired', updated_at = NOW()
+    WHERE status IN ('active', 'past_due', 'cancelled')
+      AND expires_at <= NOW()
+    RETURNING user_id
+)
+UPDATE users
+SET is_chirpy_red = FALSE, updated_at = NOW()
+WHERE id IN (SELECT user_id FROM expired);
@@ -0,0 +1,3 @@
+-- name: ForgetInboxActivity :exec
+DELETE FROM inbox_activities
+WHERE id = $1;
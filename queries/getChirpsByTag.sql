@@ -0,0 +1,7 @@
+-- name: GetChirpsByTag :many
+SELECT chirps.*, users.handle FROM chirp_tags
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE chirp_tags.tag = sqlc.arg(tag)
+ORDER BY chirp_tags.created_at DESC
+LIMIT sqlc.arg('limit');
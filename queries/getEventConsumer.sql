@@ -0,0 +1,3 @@
+-- name: GetEventConsumer :one
+SELECT * FROM event_consumers
+WHERE name = $1;
@@ -0,0 +1,5 @@
+-- name: GetLatestOutboxPosition :one
+SELECT id, txid::text::bigint AS txid FROM outbox
+WHERE txid < pg_snapshot_xmin(pg_current_snapshot())
+ORDER BY txid DESC, id DESC
+LIMIT 1;
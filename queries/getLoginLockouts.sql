@@ -0,0 +1,3 @@
+-- name: GetLoginLockouts :many
+SELECT * FROM login_failures
+WHERE key = ANY(@keys::text[]) AND locked_until > NOW();
@@ -0,0 +1,3 @@
+-- name: GetPersonalAccessToken :one
+SELECT * FROM personal_access_tokens
+WHERE token_hash = $1;
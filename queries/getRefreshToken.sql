@@ -1,3 +1,3 @@
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
\ No newline at end of file
+WHERE token_hash = $1;
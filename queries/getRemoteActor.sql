@@ -0,0 +1,3 @@
+-- name: GetRemoteActor :one
+SELECT * FROM remote_actors
+WHERE id = $1;
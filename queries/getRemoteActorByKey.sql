@@ -0,0 +1,3 @@
+-- name: GetRemoteActorByKey :one
+SELECT * FROM remote_actors
+WHERE key_id = $1;
@@ -0,0 +1,3 @@
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE handle = $1;
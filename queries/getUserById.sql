@@ -0,0 +1,3 @@
+-- name: GetUserById :one
+SELECT * FROM users
+WHERE id = $1;
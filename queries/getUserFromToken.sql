@@ -1,3 +0,0 @@
--- name: GetUserFromToken :one
-SELECT user_id FROM refresh_tokens
-WHERE token = $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = $1;
@@ -1,11 +1,15 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at)
 VALUES (
   $1,
   NOW(),
   NOW(),
   $2,
   $3,
-  $4
+  $4,
+  $5,
+  $6,
+  $7,
+  NOW()
 )
-RETURNING *;
\ No newline at end of file
+RETURNING *;
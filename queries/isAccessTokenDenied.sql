@@ -0,0 +1,5 @@
+-- name: IsAccessTokenDenied :one
+SELECT EXISTS (
+    SELECT 1 FROM revoked_access_tokens
+    WHERE jti = $1
+);
@@ -0,0 +1,5 @@
+-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE family_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+);
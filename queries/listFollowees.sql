@@ -0,0 +1,3 @@
+-- name: ListFollowees :many
+SELECT followee_id FROM follows
+WHERE follower_id = $1;
@@ -0,0 +1,5 @@
+-- name: ListLoginFailures :many
+SELECT * FROM login_failures
+WHERE @locked_only::boolean = FALSE OR locked_until > NOW()
+ORDER BY last_failure_at DESC
+LIMIT 200;
@@ -0,0 +1,8 @@
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id)
+  AND (sqlc.arg(unread_only)::boolean = FALSE OR read_at IS NULL)
+  AND (sqlc.narg(before)::uuid IS NULL
+       OR (created_at, id) < (SELECT n.created_at, n.id FROM notifications n WHERE n.id = sqlc.narg(before) AND n.user_id = sqlc.arg(user_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
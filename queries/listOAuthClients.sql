@@ -0,0 +1,4 @@
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
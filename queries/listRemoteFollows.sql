@@ -0,0 +1,5 @@
+-- name: ListRemoteFollows :many
+SELECT remote_follows.*, remote_actors.handle FROM remote_follows
+JOIN remote_actors ON remote_actors.id = remote_follows.actor_id
+WHERE remote_follows.user_id = $1
+ORDER BY remote_follows.created_at DESC;
@@ -0,0 +1,7 @@
+-- name: ListRemoteTimeline :many
+SELECT remote_posts.*, remote_actors.handle FROM remote_posts
+JOIN remote_actors ON remote_actors.id = remote_posts.actor_id
+JOIN remote_follows ON remote_follows.actor_id = remote_posts.actor_id
+WHERE remote_follows.user_id = $1 AND remote_follows.accepted_at IS NOT NULL
+ORDER BY remote_posts.published_at DESC
+LIMIT $2;
@@ -0,0 +1,6 @@
+-- name: ListActiveSessions :many
+SELECT t.family_id, t.user_agent, t.ip, t.last_used_at, t.expires_at,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id)::TIMESTAMP AS signed_in_at
+FROM refresh_tokens t
+WHERE t.user_id = $1 AND t.revoked_at IS NULL AND t.expires_at > NOW()
+ORDER BY t.last_used_at DESC;
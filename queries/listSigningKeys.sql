@@ -0,0 +1,3 @@
+-- name: ListSigningKeys :many
+SELECT * FROM signing_keys
+ORDER BY activates_at ASC;
@@ -0,0 +1,4 @@
+-- name: ListVisitBuckets :many
+SELECT bucket_start, hits, visitors FROM visit_buckets
+WHERE bucket_start >= $1
+ORDER BY bucket_start;
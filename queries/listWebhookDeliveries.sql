@@ -0,0 +1,7 @@
+-- name: ListWebhookDeliveries :many
+SELECT d.id, d.outbox_id, o.event_type, d.status, d.attempts, d.next_attempt_at, d.last_attempt_at, d.response_status, d.last_error, d.created_at
+FROM webhook_deliveries d
+JOIN outbox o ON o.id = d.outbox_id
+WHERE d.subscription_id = $1
+ORDER BY d.created_at DESC
+LIMIT 200;
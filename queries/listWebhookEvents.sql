@@ -0,0 +1,5 @@
+-- name: ListWebhookEvents :many
+SELECT id, source, received_at, verified, status_code, result, duration_ms, replay_of FROM webhook_events
+WHERE $1::boolean = FALSE OR status_code >= 400
+ORDER BY received_at DESC
+LIMIT 200;
@@ -0,0 +1,4 @@
+-- name: LockLogin :exec
+UPDATE login_failures
+SET locked_until = $2
+WHERE key = $1;
@@ -0,0 +1,7 @@
+-- name: LockVisitBucket :one
+INSERT INTO visit_buckets (bucket_start, hits, visitors, updated_at)
+VALUES ($1, 0, ''::BYTEA, NOW())
+-- the no-op update locks an existing row until the flush commits
+ON CONFLICT (bucket_start) DO UPDATE
+SET updated_at = visit_buckets.updated_at
+RETURNING visitors;
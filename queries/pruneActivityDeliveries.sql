@@ -0,0 +1,3 @@
+-- name: PruneActivityDeliveries :exec
+DELETE FROM activity_deliveries
+WHERE status <> 'pending' AND created_at < NOW() - INTERVAL '30 days';
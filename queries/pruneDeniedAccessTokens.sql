@@ -0,0 +1,3 @@
+-- name: PruneDeniedAccessTokens :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at < NOW();
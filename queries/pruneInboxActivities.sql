@@ -0,0 +1,3 @@
+-- name: PruneInboxActivities :exec
+DELETE FROM inbox_activities
+WHERE received_at < NOW() - INTERVAL '30 days';
@@ -0,0 +1,4 @@
+-- name: PruneLoginFailures :exec
+DELETE FROM login_failures
+WHERE last_failure_at < NOW() - INTERVAL '24 hours'
+  AND (locked_until IS NULL OR locked_until < NOW());
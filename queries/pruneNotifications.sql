@@ -0,0 +1,3 @@
+-- name: PruneNotifications :exec
+DELETE FROM notifications
+WHERE read_at < NOW() - INTERVAL '90 days';
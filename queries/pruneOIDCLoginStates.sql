@@ -0,0 +1,3 @@
+-- name: PruneOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at < NOW();
@@ -0,0 +1,6 @@
+-- name: PruneOutbox :exec
+-- Events are kept for 30 days, and after that until every consumer has
+-- passed them.
+DELETE FROM outbox
+WHERE (txid, id) <= (sqlc.arg(upto_txid)::bigint::text::xid8, sqlc.arg(upto_id)::bigint)
+  AND created_at < NOW() - INTERVAL '30 days';
@@ -0,0 +1,3 @@
+-- name: PrunePolkaEvents :exec
+DELETE FROM polka_events
+WHERE received_at < NOW() - INTERVAL '90 days';
@@ -0,0 +1,3 @@
+-- name: PruneRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < NOW() - INTERVAL '24 hours';
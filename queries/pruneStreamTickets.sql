@@ -0,0 +1,3 @@
+-- name: PruneStreamTickets :exec
+DELETE FROM stream_tickets
+WHERE expires_at < NOW();
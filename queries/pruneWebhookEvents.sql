@@ -0,0 +1,3 @@
+-- name: PruneWebhookEvents :exec
+DELETE FROM webhook_events
+WHERE received_at < NOW() - INTERVAL '90 days';
@@ -0,0 +1,7 @@
+-- name: QueueActivityDelivery :exec
+INSERT INTO activity_deliveries (id, user_id, activity_id, inbox, body, status, attempts, next_attempt_at, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, 'pending', 0, NOW(), NOW())
+-- queueing a delivery that gave up starts it over
+ON CONFLICT (activity_id, inbox) DO UPDATE
+SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+WHERE activity_deliveries.status = 'failed';
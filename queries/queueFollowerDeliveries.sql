@@ -0,0 +1,11 @@
+-- name: QueueFollowerDeliveries :exec
+-- one delivery per inbox, sharing inboxes between followers on one server
+INSERT INTO activity_deliveries (id, user_id, activity_id, inbox, body, status, attempts, next_attempt_at, created_at)
+SELECT gen_random_uuid(), $1, $2, inbox, $3, 'pending', 0, NOW(), NOW()
+FROM (
+    SELECT DISTINCT COALESCE(a.shared_inbox, a.inbox) AS inbox
+    FROM remote_followers f
+    JOIN remote_actors a ON a.id = f.actor_id
+    WHERE f.user_id = $1
+) inboxes
+ON CONFLICT (activity_id, inbox) DO NOTHING;
@@ -0,0 +1,8 @@
+-- name: ReadOutboxEvents :many
+-- Only events from transactions older than every running one are returned,
+-- so nothing can later commit behind the last position read.
+SELECT id, txid::text::bigint AS txid, event_type, payload, created_at FROM outbox
+WHERE (txid, id) > (sqlc.arg(after_txid)::bigint::text::xid8, sqlc.arg(after_id)::bigint)
+  AND txid < pg_snapshot_xmin(pg_current_snapshot())
+ORDER BY txid, id
+LIMIT sqlc.arg('limit');
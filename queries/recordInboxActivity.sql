@@ -0,0 +1,4 @@
+-- name: RecordInboxActivity :execrows
+INSERT INTO inbox_activities (id, received_at)
+VALUES ($1, NOW())
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,14 @@
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (key, failures, last_failure_at)
+VALUES (
+    $1,
+    1,
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_failures.last_failure_at < NOW() - INTERVAL '24 hours' THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING *;
@@ -0,0 +1,5 @@
+-- name: RefundSubscription :execrows
+UPDATE subscriptions
+SET status = 'refunded', expires_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+  AND status IN ('active', 'past_due', 'cancelled');
@@ -0,0 +1,4 @@
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = @new_hash
+WHERE id = @id AND hashed_password = @old_hash;
@@ -0,0 +1,3 @@
+-- name: RejectRemoteFollow :execrows
+DELETE FROM remote_follows
+WHERE id = $1 AND actor_id = $2;
@@ -0,0 +1,3 @@
+-- name: RemoveRemoteFollower :execrows
+DELETE FROM remote_followers
+WHERE actor_id = $1 AND follow_id = $2;
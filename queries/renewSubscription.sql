@@ -0,0 +1,5 @@
+-- name: RenewSubscription :execrows
+UPDATE subscriptions
+SET plan = $2, status = 'active', renewed_at = NOW(),
+    expires_at = GREATEST(expires_at, $3), updated_at = NOW()
+WHERE user_id = $1;
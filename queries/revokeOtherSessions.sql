@@ -0,0 +1,4 @@
+-- name: RevokeOtherUserTokens :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
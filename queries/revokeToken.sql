@@ -1,4 +1,4 @@
 -- name: RevokeToken :exec
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1;
\ No newline at end of file
+WHERE token_hash = $1;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE token_hash = $1 AND revoked_at IS NULL;
@@ -0,0 +1,5 @@
+-- name: SaveEventConsumer :exec
+INSERT INTO event_consumers (name, last_txid, last_id, updated_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (name) DO UPDATE
+SET last_txid = EXCLUDED.last_txid, last_id = EXCLUDED.last_id, updated_at = NOW();
@@ -0,0 +1,5 @@
+-- name: SetFirstPassword :one
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2 AND email = $3 AND hashed_password IS NULL
+RETURNING *;
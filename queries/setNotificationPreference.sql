@@ -0,0 +1,5 @@
+-- name: SetNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, type, enabled)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, type) DO UPDATE
+SET enabled = EXCLUDED.enabled;
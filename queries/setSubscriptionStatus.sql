@@ -0,0 +1,5 @@
+-- name: SetSubscriptionStatus :execrows
+UPDATE subscriptions
+SET status = $2, updated_at = NOW()
+WHERE user_id = $1
+  AND status IN ('active', 'past_due', 'cancelled');
@@ -0,0 +1,4 @@
+-- name: SetTOTPSecret :execrows
+UPDATE users
+SET totp_secret = $1, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL;
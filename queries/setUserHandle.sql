@@ -0,0 +1,5 @@
+-- name: SetUserHandle :one
+UPDATE users
+SET handle = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
@@ -0,0 +1,13 @@
+-- name: StartSubscription :one
+INSERT INTO subscriptions (user_id, plan, status, started_at, expires_at, updated_at)
+VALUES ($1, $2, 'active', NOW(), $3, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = 'active',
+    started_at = CASE
+        WHEN subscriptions.status IN ('active', 'past_due') THEN subscriptions.started_at
+        ELSE EXCLUDED.started_at
+    END,
+    expires_at = GREATEST(subscriptions.expires_at, EXCLUDED.expires_at),
+    updated_at = NOW()
+RETURNING *;
@@ -0,0 +1,17 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS b (key, tokens, last_allowed, updated_at)
+VALUES (
+    @key,
+    @burst::float8 - 1,
+    TRUE,
+    clock_timestamp()
+)
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+        WHEN LEAST(@burst::float8, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at) * @rate::float8) >= 1
+        THEN LEAST(@burst::float8, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at) * @rate::float8) - 1
+        ELSE LEAST(@burst::float8, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at) * @rate::float8)
+    END,
+    last_allowed = LEAST(@burst::float8, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at) * @rate::float8) >= 1,
+    updated_at = clock_timestamp()
+RETURNING tokens, last_allowed;
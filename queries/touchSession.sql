@@ -0,0 +1,4 @@
+-- name: TouchSession :exec
+UPDATE refresh_tokens
+SET last_used_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL AND last_used_at < NOW() - INTERVAL '1 minute';
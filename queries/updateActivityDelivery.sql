@@ -0,0 +1,9 @@
+-- name: UpdateActivityDelivery :exec
+UPDATE activity_deliveries
+SET status = $2,
+    attempts = $3,
+    next_attempt_at = $4,
+    last_attempt_at = NOW(),
+    response_status = $5,
+    last_error = $6
+WHERE id = $1;
@@ -0,0 +1,5 @@
+-- name: UpdateUserEmail :one
+UPDATE users
+SET email = $1, email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $2
+RETURNING *;
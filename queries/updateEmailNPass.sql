@@ -1,5 +0,0 @@
--- name: UpdateUser :one
-UPDATE users
-SET email = $1, hashed_password = $2
-WHERE id = $3
-RETURNING *;
\ No newline at end of file
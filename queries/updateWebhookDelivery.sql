@@ -0,0 +1,9 @@
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = $2,
+    attempts = $3,
+    next_attempt_at = $4,
+    last_attempt_at = NOW(),
+    response_status = $5,
+    last_error = $6
+WHERE id = $1;
@@ -0,0 +1,10 @@
+-- name: UpsertRemoteActor :exec
+INSERT INTO remote_actors (id, handle, inbox, shared_inbox, key_id, public_key_pem, fetched_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW())
+ON CONFLICT (id) DO UPDATE
+SET handle = EXCLUDED.handle,
+    inbox = EXCLUDED.inbox,
+    shared_inbox = EXCLUDED.shared_inbox,
+    key_id = EXCLUDED.key_id,
+    public_key_pem = EXCLUDED.public_key_pem,
+    fetched_at = NOW();
@@ -0,0 +1,5 @@
+-- name: UseEmailVerification :one
+UPDATE email_verifications
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,4 @@
+-- name: UseLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
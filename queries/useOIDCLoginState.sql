@@ -0,0 +1,4 @@
+-- name: UseOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,4 @@
+-- name: UseStreamTicket :one
+DELETE FROM stream_tickets
+WHERE ticket_hash = $1 AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,4 @@
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1);
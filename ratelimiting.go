@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/ratelimit"
+)
+
+// rateLimitRule is the quota for one group of routes. Chirpy Red members get
+// the Red limit when they are signed in.
+type rateLimitRule struct {
+	Default ratelimit.Limit
+	Red     ratelimit.Limit
+}
+
+// defaultRateLimits can be overridden per group with RATE_LIMIT_<GROUP> and
+// RATE_LIMIT_<GROUP>_RED, e.g. RATE_LIMIT_CHIRPS_WRITE=60/1m.
+var defaultRateLimits = map[string]rateLimitRule{
+	"login": {
+		Default: ratelimit.Limit{Requests: 10, Per: time.Minute},
+		Red:     ratelimit.Limit{Requests: 10, Per: time.Minute},
+	},
+	"signup": {
+		Default: ratelimit.Limit{Requests: 5, Per: time.Hour},
+		Red:     ratelimit.Limit{Requests: 5, Per: time.Hour},
+	},
+	"tokens": {
+		Default: ratelimit.Limit{Requests: 30, Per: time.Minute},
+		Red:     ratelimit.Limit{Requests: 60, Per: time.Minute},
+	},
+	"chirps-write": {
+		Default: ratelimit.Limit{Requests: 30, Per: time.Minute},
+		Red:     ratelimit.Limit{Requests: 150, Per: time.Minute},
+	},
+	"chirps-read": {
+		Default: ratelimit.Limit{Requests: 120, Per: time.Minute},
+		Red:     ratelimit.Limit{Requests: 600, Per: time.Minute},
+	},
+	"webhooks": {
+		Default: ratelimit.Limit{Requests: 300, Per: time.Minute},
+		Red:     ratelimit.Limit{Requests: 300, Per: time.Minute},
+	},
+}
+
+// rateLimiter holds the configured rules and the bucket store. The store is
+// in memory unless RATE_LIMIT_BACKEND=postgres, which shares buckets between
+// instances.
+type rateLimiter struct {
+	store ratelimit.Store
+	rules map[string]rateLimitRule
+	red   redStatusCache
+}
+
+func loadRateLimitRules() (map[string]rateLimitRule, error) {
+	rules := map[string]rateLimitRule{}
+	for group, rule := range defaultRateLimits {
+		env := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(group, "-", "_"))
+		if v := os.Getenv(env); v != "" {
+			limit, err := ratelimit.ParseLimit(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", env, err)
+			}
+			rule.Default = limit
+		}
+		if v := os.Getenv(env + "_RED"); v != "" {
+			limit, err := ratelimit.ParseLimit(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s_RED: %w", env, err)
+			}
+			rule.Red = limit
+		}
+		rules[group] = rule
+	}
+	return rules, nil
+}
+
+// rateLimit wraps next with the quota of group. Requests are counted per
+// user when they carry a valid token and per client address otherwise.
+func (cfg *apiConfig) rateLimit(group string, next http.Handler) http.Handler {
+	rule, ok := cfg.rateLimiter.rules[group]
+	if !ok {
+		panic("no rate limit rule for " + group)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := rule.Default
+		key := group + ":ip:" + cfg.clientIP(r)
+		if userId, ok := cfg.rateLimitUser(r); ok {
+			key = group + ":user:" + userId.String()
+			if cfg.rateLimiter.red.isRed(r, cfg, userId) {
+				limit = rule.Red
+			}
+		}
+		res, err := cfg.rateLimiter.store.Take(r.Context(), key, limit)
+		if err != nil {
+			// an unavailable backend shouldn't take the API down with it
+			log.Printf("Error checking rate limit: %s", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Per.Seconds())))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+			respondWithError(w, http.StatusTooManyRequests, "Too many requests, slow down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// rateLimitUser identifies the user behind the request without the
+// denylist check or bookkeeping of authenticatePrincipal; the handler still
+// authenticates properly. It only decides whose bucket the request uses.
+func (cfg *apiConfig) rateLimitUser(r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil || token == "" {
+		return uuid.Nil, false
+	}
+	if auth.IsPersonalAccessToken(token) {
+		pat, err := cfg.dbQueries.GetPersonalAccessToken(r.Context(), auth.HashToken(token))
+		if err != nil {
+			return uuid.Nil, false
+		}
+		return pat.UserID, true
+	}
+	claims, err := auth.ValidateJWT(token, cfg.jwtConfig)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userId, err := claims.UserID()
+	return userId, err == nil
+}
+
+// redStatusCache remembers for a minute whether a user has Chirpy Red, so
+// choosing their quota doesn't cost a query on every request.
+type redStatusCache struct {
+	mu      sync.Mutex
+	entries map[uuid.UUID]redStatus
+}
+
+type redStatus struct {
+	red     bool
+	fetched time.Time
+}
+
+const redStatusTTL = time.Minute
+
+func (c *redStatusCache) isRed(r *http.Request, cfg *apiConfig, userId uuid.UUID) bool {
+	c.mu.Lock()
+	entry, ok := c.entries[userId]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetched) < redStatusTTL {
+		return entry.red
+	}
+	dbUser, err := cfg.dbQueries.GetUserById(r.Context(), userId)
+	if err != nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) > 100_000 {
+		c.entries = map[uuid.UUID]redStatus{}
+	}
+	c.entries[userId] = redStatus{red: dbUser.IsChirpyRed.Bool, fetched: time.Now()}
+	return dbUser.IsChirpyRed.Bool
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+const maxUserAgentLength = 512
+
+func sessionUserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return ua
+}
+
+func listSessions(apiCfg *apiConfig) http.HandlerFunc {
+	type Session struct {
+		ID         uuid.UUID `json:"id"`
+		UserAgent  string    `json:"user_agent"`
+		IP         string    `json:"ip"`
+		SignedInAt time.Time `json:"signed_in_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		rows, err := apiCfg.dbQueries.ListActiveSessions(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		sessions := []Session{}
+		for _, row := range rows {
+			sessions = append(sessions, Session{
+				ID:         row.FamilyID,
+				UserAgent:  row.UserAgent,
+				IP:         row.Ip,
+				SignedInAt: row.SignedInAt,
+				LastUsedAt: row.LastUsedAt,
+				ExpiresAt:  row.ExpiresAt,
+			})
+		}
+		respondWithJSON(w, http.StatusOK, sessions)
+	}
+}
+
+func revokeSession(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		sessionId, err := uuid.Parse(r.PathValue("sessionID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid session id")
+			return
+		}
+		rows, err := apiCfg.dbQueries.RevokeUserTokenFamily(r.Context(), databases.RevokeUserTokenFamilyParams{
+			FamilyID: sessionId,
+			UserID:   userId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// revokeOtherSessions logs the user out everywhere except the session whose
+// refresh token is sent as the bearer token, like POST /api/revoke.
+func revokeOtherSessions(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			log.Printf("Error getting the bearer token: %s", err)
+			w.WriteHeader(401)
+			return
+		}
+		dbToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), auth.HashToken(token))
+		if err != nil {
+			log.Printf("error loading refresh token from db: %s", err)
+			w.WriteHeader(401)
+			return
+		}
+		if dbToken.RevokedAt.Valid || dbToken.ExpiresAt.Before(time.Now()) {
+			w.WriteHeader(401)
+			return
+		}
+		err = apiCfg.dbQueries.RevokeOtherUserTokens(r.Context(), databases.RevokeOtherUserTokensParams{
+			UserID:   dbToken.UserID,
+			FamilyID: dbToken.FamilyID,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// logout denylists the access token it is called with until that token would
+// have expired anyway. A refresh token in the body is revoked as well, ending
+// the session.
+func logout(apiCfg *apiConfig) http.HandlerFunc {
+	type paramBody struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := apiCfg.authenticateSession(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		userId, err := claims.UserID()
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		params := paramBody{}
+		if r.ContentLength != 0 {
+			err = json.NewDecoder(r.Body).Decode(&params)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+				return
+			}
+		}
+		err = apiCfg.dbQueries.DenyAccessToken(r.Context(), databases.DenyAccessTokenParams{
+			Jti:       claims.ID,
+			UserID:    userId,
+			ExpiresAt: claims.ExpiresAt.Time,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if params.RefreshToken != "" {
+			dbToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), auth.HashToken(params.RefreshToken))
+			if err == nil && dbToken.UserID == userId {
+				err = apiCfg.dbQueries.RevokeTokenFamily(r.Context(), dbToken.FamilyID)
+			}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Failed to revoke refresh token: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+		}
+		w.WriteHeader(204)
+	}
+}
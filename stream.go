@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+	"main.go/internal/events"
+	"main.go/internal/stream"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+	// streamTicketTTL only has to cover opening the stream right after
+	// getting the ticket.
+	streamTicketTTL = 30 * time.Second
+)
+
+// streamRecheckInterval is how often an open stream checks that its token
+// hasn't been revoked since it connected.
+var streamRecheckInterval = time.Minute
+
+var streamEventTypes = []string{eventChirpCreated, eventChirpDeleted, eventNotificationCreated, eventUserFollowed, eventUserUnfollowed}
+
+// publishToStream is the live event bus subscriber that feeds the stream
+// hub. It runs in every instance, so each one serves its own connections.
+func (cfg *apiConfig) publishToStream(ctx context.Context, e events.Event) error {
+	id := strconv.FormatInt(e.ID, 10)
+	switch e.Type {
+	case eventChirpCreated:
+		var chirp struct {
+			UserID uuid.UUID `json:"user_id"`
+			Body   string    `json:"body"`
+		}
+		err := json.Unmarshal(e.Payload, &chirp)
+		if err != nil {
+			return err
+		}
+		cfg.streamHub.Publish(stream.Message{
+			ID:       id,
+			Event:    "chirp",
+			Data:     e.Payload,
+			AuthorID: chirp.UserID,
+			Tags:     stream.Tags(chirp.Body),
+		})
+	case eventChirpDeleted:
+		var deleted struct {
+			UserID uuid.UUID `json:"user_id"`
+		}
+		err := json.Unmarshal(e.Payload, &deleted)
+		if err != nil {
+			return err
+		}
+		cfg.streamHub.Publish(stream.Message{
+			ID:       id,
+			Event:    "chirp_deleted",
+			Data:     e.Payload,
+			AuthorID: deleted.UserID,
+		})
+	case eventNotificationCreated:
+		var created notificationCreated
+		err := json.Unmarshal(e.Payload, &created)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(created.Notification)
+		if err != nil {
+			return err
+		}
+		cfg.streamHub.Publish(stream.Message{
+			ID:        id,
+			Event:     "notification",
+			Data:      data,
+			Recipient: created.UserID,
+		})
+	case eventUserFollowed, eventUserUnfollowed:
+		var followed userFollowed
+		err := json.Unmarshal(e.Payload, &followed)
+		if err != nil {
+			return err
+		}
+		if e.Type == eventUserFollowed {
+			cfg.streamHub.Follow(followed.FollowerID, followed.FolloweeID)
+		} else {
+			cfg.streamHub.Unfollow(followed.FollowerID, followed.FolloweeID)
+		}
+	}
+	return nil
+}
+
+// createStreamTicket trades a session token for a one-time ticket to open
+// the stream with, for browsers whose EventSource can't send an
+// Authorization header. Only the ticket goes in the URL, so a URL that ends
+// up in a log or history can't be used again.
+func createStreamTicket(apiCfg *apiConfig) http.HandlerFunc {
+	type ticketResp struct {
+		Ticket    string `json:"ticket"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := apiCfg.authenticateSession(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		userId, err := claims.UserID()
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		ticket, err := auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error creating stream ticket: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		sessionId := uuid.NullUUID{}
+		if id, err := uuid.Parse(claims.SessionID); err == nil {
+			sessionId = uuid.NullUUID{UUID: id, Valid: true}
+		}
+		err = apiCfg.dbQueries.CreateStreamTicket(r.Context(), databases.CreateStreamTicketParams{
+			TicketHash:     auth.HashToken(ticket),
+			UserID:         userId,
+			TokenID:        claims.ID,
+			SessionID:      sessionId,
+			TokenExpiresAt: claims.ExpiresAt.Time,
+			ExpiresAt:      time.Now().Add(streamTicketTTL),
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, ticketResp{
+			Ticket:    ticket,
+			ExpiresIn: int(streamTicketTTL.Seconds()),
+		})
+	}
+}
+
+// streamClaims authenticates a stream by its Authorization header or by a
+// ?ticket= from POST /api/stream/ticket. A ticket stands in for the token it
+// was issued for, so the stream still ends when that token would.
+func (cfg *apiConfig) streamClaims(r *http.Request) (*auth.AccessClaims, error) {
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		return cfg.authenticateSession(r)
+	}
+	t, err := cfg.dbQueries.UseStreamTicket(r.Context(), auth.HashToken(ticket))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInvalidStreamTicket
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+	}
+	if !t.TokenExpiresAt.After(time.Now()) {
+		return nil, auth.ErrTokenExpired
+	}
+	claims := &auth.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        t.TokenID,
+			Subject:   t.UserID.String(),
+			ExpiresAt: jwt.NewNumericDate(t.TokenExpiresAt),
+		},
+	}
+	if t.SessionID.Valid {
+		claims.SessionID = t.SessionID.UUID.String()
+	}
+	// the token may have been revoked since the ticket was issued
+	err = cfg.recheckStreamToken(r.Context(), claims)
+	if errors.Is(err, errTokenRevoked) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+	}
+	return claims, nil
+}
+
+// streamEvents is a Server-Sent Events stream of new chirps, chirp
+// deletions and the user's own notifications. Chirps can be narrowed with
+// ?author_id=, ?tag= or ?timeline=home. A client reconnecting with
+// Last-Event-ID, or ?last_event_id= when it opens a new EventSource, gets
+// what it missed while that is still in the hub's history, and a "reset"
+// event telling it to refetch when it isn't. The stream ends when the
+// access token expires or is revoked, so the client reconnects with a fresh
+// one; a ticket is used up on connecting, so reconnecting takes a new one.
+func streamEvents(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := apiCfg.streamClaims(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		userId, err := claims.UserID()
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		query := r.URL.Query()
+		filter := stream.Filter{UserID: userId}
+		if v := query.Get("tag"); v != "" {
+			var ok bool
+			filter.Tag, ok = stream.ParseTag(v)
+			if !ok {
+				respondWithError(w, http.StatusBadRequest, "Invalid tag")
+				return
+			}
+		}
+		if v := query.Get("author_id"); v != "" {
+			filter.AuthorID, err = uuid.Parse(v)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid author_id")
+				return
+			}
+		}
+		switch query.Get("timeline") {
+		case "":
+		case "home":
+			followees, err := apiCfg.dbQueries.ListFollowees(r.Context(), userId)
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			filter.Home = true
+			filter.Following = map[uuid.UUID]bool{}
+			for _, id := range followees {
+				filter.Following[id] = true
+			}
+		default:
+			respondWithError(w, http.StatusBadRequest, "timeline must be home")
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		// the server's write timeout, if any, would cut every stream short
+		rc.SetWriteDeadline(time.Time{})
+		lastEventId := r.Header.Get("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = query.Get("last_event_id")
+		}
+		sub, backlog, resumed := apiCfg.streamHub.Subscribe(filter, lastEventId)
+		defer apiCfg.streamHub.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if !resumed {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+		for _, m := range backlog {
+			writeStreamMessage(w, m)
+		}
+		err = rc.Flush()
+		if err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		expired := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+		defer expired.Stop()
+		recheck := time.NewTicker(streamRecheckInterval)
+		defer recheck.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-expired.C:
+				fmt.Fprint(w, "event: token_expired\ndata: {}\n\n")
+				rc.Flush()
+				return
+			case <-recheck.C:
+				err := apiCfg.recheckStreamToken(r.Context(), claims)
+				if errors.Is(err, errTokenRevoked) {
+					fmt.Fprint(w, "event: token_revoked\ndata: {}\n\n")
+					rc.Flush()
+					return
+				}
+				if err != nil {
+					log.Printf("Error checking stream token: %s", err)
+				}
+				continue
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case m, ok := <-sub.C:
+				if !ok {
+					// dropped for falling behind; the client resumes from
+					// its last id
+					return
+				}
+				writeStreamMessage(w, m)
+			}
+			err = rc.Flush()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// recheckStreamToken returns errTokenRevoked once the token a stream is
+// using has been logged out or its session ended. Other errors mean the
+// check couldn't be made, and the stream carries on.
+func (cfg *apiConfig) recheckStreamToken(ctx context.Context, claims *auth.AccessClaims) error {
+	denied, err := cfg.dbQueries.IsAccessTokenDenied(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+	if denied {
+		return errTokenRevoked
+	}
+	sessionId, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		// tokens from before sessions were recorded in them
+		return nil
+	}
+	active, err := cfg.dbQueries.IsSessionActive(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return errTokenRevoked
+	}
+	return nil
+}
+
+func writeStreamMessage(w http.ResponseWriter, m stream.Message) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", m.ID, m.Event, m.Data)
+}
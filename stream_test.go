@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/stream"
+)
+
+func TestStreamTicket(t *testing.T) {
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	tickets := map[string][]driver.Value{}
+	db := newFakeDB()
+	db.on("IsAccessTokenDenied", fakeValue(false))
+	db.on("IsSessionActive", fakeValue(true))
+	db.on("TouchSession", fakeExec(1))
+	db.on("CreateStreamTicket", func(args []driver.Value) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// ticket_hash, created_at, user_id, token_id, session_id, token_expires_at, expires_at
+		tickets[args[0].(string)] = []driver.Value{args[0], time.Now(), args[1], args[2], args[3], args[4], args[5]}
+		return fakeExec(1)(nil)
+	})
+	db.on("UseStreamTicket", func(args []driver.Value) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		row, ok := tickets[args[0].(string)]
+		if !ok {
+			return fakeTable(), nil
+		}
+		delete(tickets, args[0].(string))
+		return fakeTable(row), nil
+	})
+	cfg := &apiConfig{
+		jwtConfig: auth.JWTConfig{Keys: auth.NewKeySet(key), Issuer: "chirpy", Audience: "chirpy"},
+		streamHub: stream.NewHub(10, 8),
+	}
+	cfg.db, cfg.dbQueries = db.open()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/stream", streamEvents(cfg))
+	mux.HandleFunc("POST /api/stream/ticket", createStreamTicket(cfg))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	logs := captureLog(t)
+
+	token, err := auth.MakeSessionJWT(uuid.New(), uuid.New(), cfg.jwtConfig, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", server.URL+"/api/stream/ticket", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ticket struct {
+		Ticket string `json:"ticket"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&ticket)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusCreated || ticket.Ticket == "" {
+		t.Fatalf("ticket: %d %+v %v", resp.StatusCode, ticket, err)
+	}
+
+	// no Authorization header, as from EventSource
+	resp, err = http.Get(server.URL + "/api/stream?ticket=" + ticket.Ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream with a ticket: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	resp.Body.Close()
+	if err != nil || !strings.HasPrefix(line, "retry:") {
+		t.Errorf("first line %q, %v", line, err)
+	}
+
+	resp, err = http.Get(server.URL + "/api/stream?ticket=" + ticket.Ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("reusing the ticket got %d", resp.StatusCode)
+	}
+	if strings.Contains(logs.String(), ticket.Ticket) {
+		t.Errorf("the ticket was logged: %s", logs)
+	}
+}
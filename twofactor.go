@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+)
+
+const (
+	loginChallengeTTL        = 5 * time.Minute
+	loginChallengeMaxAttempt = 5
+	recoveryCodeCount        = 10
+	totpIssuer               = "Chirpy"
+)
+
+// writeTwoFactorChallenge answers a correct password for a 2FA account with a
+// short-lived challenge token instead of a JWT. The client trades it for
+// tokens at POST /api/login/2fa together with a one-time code.
+func writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, apiCfg *apiConfig, dbUser databases.User) {
+	type challengeResp struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+		ExpiresIn         int    `json:"expires_in"`
+	}
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating challenge token: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	err = apiCfg.dbQueries.CreateLoginChallenge(r.Context(), databases.CreateLoginChallengeParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	})
+	if err != nil {
+		log.Printf("Error executing query: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, challengeResp{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int(loginChallengeTTL.Seconds()),
+	})
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+// A TOTP time step is only accepted once, so an observed code can't be
+// replayed within its validity window.
+func checkSecondFactor(ctx context.Context, q *databases.Queries, dbUser databases.User, code, recoveryCode string) (bool, error) {
+	if !dbUser.TotpEnabledAt.Valid {
+		return false, nil
+	}
+	if code != "" {
+		step, err := auth.ValidateTOTP(dbUser.TotpSecret.String, code, time.Now())
+		if err != nil {
+			return false, nil
+		}
+		rows, err := q.UseTOTPStep(ctx, databases.UseTOTPStepParams{
+			TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+			ID:           dbUser.ID,
+		})
+		if err != nil {
+			return false, err
+		}
+		return rows == 1, nil
+	}
+	if recoveryCode != "" {
+		rows, err := q.UseRecoveryCode(ctx, databases.UseRecoveryCodeParams{
+			UserID:   dbUser.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+		})
+		if err != nil {
+			return false, err
+		}
+		return rows == 1, nil
+	}
+	return false, nil
+}
+
+func loginTwoFactor(apiCfg *apiConfig) http.HandlerFunc {
+	type paramBody struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		params := paramBody{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		challengeHash := auth.HashToken(params.ChallengeToken)
+		// the challenge row stays locked until commit, so concurrent requests
+		// with one challenge take turns and only one can spend a code
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		challenge, err := qtx.AttemptLoginChallenge(r.Context(), databases.AttemptLoginChallengeParams{
+			TokenHash:   challengeHash,
+			MaxAttempts: loginChallengeMaxAttempt,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge, log in again")
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		dbUser, err := qtx.GetUserById(r.Context(), challenge.UserID)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = apiCfg.checkSecondFactorLogin(r, qtx, dbUser, params.Code, params.RecoveryCode)
+		if errors.Is(err, errBadSecondFactor) {
+			// keep the attempt
+			err = tx.Commit()
+			if err != nil {
+				log.Printf("Error committing transaction: %s", err)
+			}
+			respondWithError(w, http.StatusUnauthorized, "Invalid code")
+			return
+		}
+		if err != nil {
+			respondWithLoginError(w, err)
+			return
+		}
+		rows, err := qtx.UseLoginChallenge(r.Context(), challengeHash)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows != 1 {
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge, log in again")
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		writeLoginResponse(w, r, apiCfg, dbUser)
+	}
+}
+
+func enrollTOTP(apiCfg *apiConfig) http.HandlerFunc {
+	type enrollResp struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		dbUser, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if dbUser.TotpEnabledAt.Valid {
+			respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			log.Printf("Error generating totp secret: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		rows, err := apiCfg.dbQueries.SetTOTPSecret(r.Context(), databases.SetTOTPSecretParams{
+			TotpSecret: sql.NullString{String: secret, Valid: true},
+			ID:         userId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if rows != 1 {
+			respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, enrollResp{
+			Secret:     secret,
+			OtpauthURI: auth.TOTPURI(secret, dbUser.Email, totpIssuer),
+		})
+	}
+}
+
+func confirmTOTP(apiCfg *apiConfig) http.HandlerFunc {
+	type paramBody struct {
+		Code string `json:"code"`
+	}
+	type confirmResp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		params := paramBody{}
+		err = decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		dbUser, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if dbUser.TotpEnabledAt.Valid {
+			respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+		if !dbUser.TotpSecret.Valid {
+			respondWithError(w, http.StatusBadRequest, "Start enrolment first")
+			return
+		}
+		step, err := auth.ValidateTOTP(dbUser.TotpSecret.String, params.Code, time.Now())
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid code")
+			return
+		}
+		codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			log.Printf("Error generating recovery codes: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		err = qtx.EnableTOTP(r.Context(), databases.EnableTOTPParams{
+			TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+			ID:           userId,
+		})
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = qtx.DeleteRecoveryCodes(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		for _, code := range codes {
+			err = qtx.CreateRecoveryCode(r.Context(), databases.CreateRecoveryCodeParams{
+				UserID:   userId,
+				CodeHash: auth.HashToken(code),
+			})
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, confirmResp{RecoveryCodes: codes})
+	}
+}
+
+func disableTOTP(apiCfg *apiConfig) http.HandlerFunc {
+	type paramBody struct {
+		Password string `json:"password"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		params := paramBody{}
+		err = decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		dbUser, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = apiCfg.checkUserPassword(dbUser, params.Password)
+		if errors.Is(err, errNoPassword) {
+			respondWithError(w, http.StatusForbidden, "Set a password before disabling two-factor authentication")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Incorrect password")
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		err = qtx.DisableTOTP(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = qtx.DeleteRecoveryCodes(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
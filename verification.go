@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/databases"
+	"main.go/internal/mailer"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+const (
+	emailPurposeVerify   = "verify"
+	emailPurposeChange   = "email_change"
+	emailPurposePassword = "password_setup"
+)
+
+// makeEmailLink stores a fresh single-use token for the user and address in
+// link and returns the URL that redeems it. Only the token's hash is kept
+// in the database.
+func makeEmailLink(ctx context.Context, apiCfg *apiConfig, link databases.CreateEmailVerificationParams) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	link.TokenHash = auth.HashToken(token)
+	link.ExpiresAt = time.Now().Add(emailVerificationTTL)
+	_, err = apiCfg.dbQueries.CreateEmailVerification(ctx, link)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/api/verify-email?token=%s", apiCfg.baseURL, url.QueryEscape(token)), nil
+}
+
+func sendVerificationEmail(ctx context.Context, apiCfg *apiConfig, userId uuid.UUID, email string) error {
+	link, err := makeEmailLink(ctx, apiCfg, databases.CreateEmailVerificationParams{
+		UserID:  userId,
+		Email:   email,
+		Purpose: emailPurposeVerify,
+	})
+	if err != nil {
+		return err
+	}
+	return apiCfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body:    fmt.Sprintf("Confirm this address by opening the link below. It expires in %s.\n\n%s", emailVerificationTTL, link),
+	})
+}
+
+// sendEmailChangeConfirmation mails a confirmation link to newEmail and a
+// notice to the account's current address. The change only takes effect
+// once the link is opened.
+func sendEmailChangeConfirmation(ctx context.Context, apiCfg *apiConfig, user databases.User, newEmail string) error {
+	link, err := makeEmailLink(ctx, apiCfg, databases.CreateEmailVerificationParams{
+		UserID:  user.ID,
+		Email:   newEmail,
+		Purpose: emailPurposeChange,
+	})
+	if err != nil {
+		return err
+	}
+	err = apiCfg.mailer.Send(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email address",
+		Body:    fmt.Sprintf("Open the link below to start using this address for your Chirpy account. It expires in %s.\n\n%s", emailVerificationTTL, link),
+	})
+	if err != nil {
+		return err
+	}
+	return apiCfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy email address is being changed",
+		Body:    fmt.Sprintf("Someone asked to change the email address on your Chirpy account to %s. If this wasn't you, change your password now.", newEmail),
+	})
+}
+
+// sendPasswordSetupConfirmation mails the account's address a link that
+// sets hashedPassword as its first password. Until then the account can
+// only sign in through its identity provider, so a stolen token alone
+// can't add a way in.
+func sendPasswordSetupConfirmation(ctx context.Context, apiCfg *apiConfig, user databases.User, hashedPassword string) error {
+	link, err := makeEmailLink(ctx, apiCfg, databases.CreateEmailVerificationParams{
+		UserID:         user.ID,
+		Email:          user.Email,
+		Purpose:        emailPurposePassword,
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	return apiCfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your new Chirpy password",
+		Body:    fmt.Sprintf("Open the link below to start signing in to Chirpy with the password you chose. It expires in %s. If this wasn't you, don't open it.\n\n%s", emailVerificationTTL, link),
+	})
+}
+
+func verifyEmail(apiCfg *apiConfig) http.HandlerFunc {
+	type respMsg struct {
+		Status string `json:"status"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			respondWithError(w, http.StatusBadRequest, "Missing token")
+			return
+		}
+		tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Error starting transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiCfg.withTx(tx)
+		verification, err := qtx.UseEmailVerification(r.Context(), auth.HashToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if verification.Purpose == emailPurposePassword {
+			user, err := qtx.SetFirstPassword(r.Context(), databases.SetFirstPasswordParams{
+				HashedPassword: verification.HashedPassword,
+				ID:             verification.UserID,
+				Email:          verification.Email,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				// a password was set or the address changed since; the
+				// link is spent either way
+				tx.Commit()
+				respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+				return
+			}
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			err = recordEvent(r.Context(), qtx, eventUserUpdated, userUpdatedEvent(user, "password"))
+			if err != nil {
+				log.Printf("Error recording event: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			err = tx.Commit()
+			if err != nil {
+				log.Printf("Error committing transaction: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			apiCfg.events.Notify()
+			respondWithJSON(w, http.StatusOK, respMsg{Status: "password set"})
+			return
+		}
+		if verification.Purpose == emailPurposeChange {
+			user, err := qtx.UpdateUserEmail(r.Context(), databases.UpdateUserEmailParams{
+				Email: verification.Email,
+				ID:    verification.UserID,
+			})
+			if isUniqueViolation(err) {
+				respondWithError(w, http.StatusConflict, "Email is already in use")
+				return
+			}
+			if err != nil {
+				log.Printf("Error executing query: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			err = recordEvent(r.Context(), qtx, eventUserUpdated, userUpdatedEvent(user, "email"))
+			if err != nil {
+				log.Printf("Error recording event: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			err = tx.Commit()
+			if err != nil {
+				log.Printf("Error committing transaction: %s", err)
+				w.WriteHeader(500)
+				return
+			}
+			apiCfg.events.Notify()
+			respondWithJSON(w, http.StatusOK, respMsg{Status: "email changed"})
+			return
+		}
+		_, err = qtx.VerifyUserEmail(r.Context(), databases.VerifyUserEmailParams{
+			ID:    verification.UserID,
+			Email: verification.Email,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// the account's address changed after this link was sent; the
+			// link is spent either way
+			tx.Commit()
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Printf("Error committing transaction: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, respMsg{Status: "email verified"})
+	}
+}
+
+func resendVerification(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := apiCfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		user, err := apiCfg.dbQueries.GetUserById(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		if user.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusConflict, "Email is already verified")
+			return
+		}
+		err = sendVerificationEmail(r.Context(), apiCfg, user.ID, user.Email)
+		if err != nil {
+			log.Printf("Error sending verification email: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"main.go/internal/databases"
+)
+
+// webhookDelivery is one inbound webhook as it goes into the log.
+type webhookDelivery struct {
+	source     string
+	header     http.Header
+	body       []byte
+	verified   bool
+	receivedAt time.Time
+	status     int
+	result     string
+	replayOf   uuid.NullUUID
+}
+
+// headers that carry credentials of ours rather than the sender's
+var redactedWebhookHeaders = []string{"Authorization", "Cookie"}
+
+// rejectedWebhookBodyLimit is how much of a delivery that failed
+// verification is kept. Anyone can post those, so the log only gets enough
+// to recognise them by, plus the size and hash of the whole body.
+const rejectedWebhookBodyLimit = 1024
+
+// logWebhook stores a delivery and what became of it. Failing to log is not
+// the sender's problem, so errors are only reported here.
+func (cfg *apiConfig) logWebhook(ctx context.Context, d webhookDelivery) (databases.WebhookEvent, error) {
+	sum := sha256.Sum256(d.body)
+	body := d.body
+	header := d.header.Clone()
+	if !d.verified {
+		body = body[:min(len(body), rejectedWebhookBodyLimit)]
+		header = http.Header{}
+	}
+	for _, name := range redactedWebhookHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "[redacted]")
+		}
+	}
+	headers, err := json.Marshal(header)
+	if err != nil {
+		log.Printf("Error encoding webhook headers: %s", err)
+		return databases.WebhookEvent{}, err
+	}
+	event, err := cfg.dbQueries.CreateWebhookEvent(context.WithoutCancel(ctx), databases.CreateWebhookEventParams{
+		Source:     d.source,
+		ReceivedAt: d.receivedAt,
+		Headers:    headers,
+		Body:       body,
+		Verified:   d.verified,
+		StatusCode: int32(d.status),
+		Result:     d.result,
+		DurationMs: int32(time.Since(d.receivedAt).Milliseconds()),
+		ReplayOf:   d.replayOf,
+		BodySize:   int32(len(d.body)),
+		BodySha256: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		log.Printf("Error logging webhook: %s", err)
+	}
+	return event, err
+}
+
+// webhookProcessors re-run a stored delivery through the same logic that
+// handled it the first time.
+var webhookProcessors = map[string]func(*apiConfig, context.Context, []byte) (int, string){
+	"polka": (*apiConfig).processPolkaEvent,
+}
+
+type WebhookEvent struct {
+	ID         uuid.UUID       `json:"id"`
+	Source     string          `json:"source"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Verified   bool            `json:"verified"`
+	StatusCode int32           `json:"status_code"`
+	Result     string          `json:"result"`
+	DurationMs int32           `json:"duration_ms"`
+	ReplayOf   *uuid.UUID      `json:"replay_of"`
+	Headers    json.RawMessage `json:"headers,omitempty"`
+	Body       *string         `json:"body,omitempty"`
+	BodySize   int32           `json:"body_size,omitempty"`
+	BodySha256 string          `json:"body_sha256,omitempty"`
+}
+
+func webhookEventResponse(e databases.WebhookEvent) WebhookEvent {
+	body := string(e.Body)
+	event := WebhookEvent{
+		ID:         e.ID,
+		Source:     e.Source,
+		ReceivedAt: e.ReceivedAt,
+		Verified:   e.Verified,
+		StatusCode: e.StatusCode,
+		Result:     e.Result,
+		DurationMs: e.DurationMs,
+		Headers:    e.Headers,
+		Body:       &body,
+		BodySize:   e.BodySize,
+		BodySha256: e.BodySha256,
+	}
+	if e.ReplayOf.Valid {
+		event.ReplayOf = &e.ReplayOf.UUID
+	}
+	return event
+}
+
+// listWebhooks shows recent deliveries without their headers and bodies, or
+// only the ones that got an error status with ?failed=true.
+func listWebhooks(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		dbEvents, err := apiCfg.dbQueries.ListWebhookEvents(r.Context(), r.URL.Query().Get("failed") == "true")
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		events := []WebhookEvent{}
+		for _, e := range dbEvents {
+			event := WebhookEvent{
+				ID:         e.ID,
+				Source:     e.Source,
+				ReceivedAt: e.ReceivedAt,
+				Verified:   e.Verified,
+				StatusCode: e.StatusCode,
+				Result:     e.Result,
+				DurationMs: e.DurationMs,
+			}
+			if e.ReplayOf.Valid {
+				event.ReplayOf = &e.ReplayOf.UUID
+			}
+			events = append(events, event)
+		}
+		respondWithJSON(w, http.StatusOK, events)
+	}
+}
+
+func getWebhook(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		eventId, err := uuid.Parse(r.PathValue("eventID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		event, err := apiCfg.dbQueries.GetWebhookEvent(r.Context(), eventId)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, webhookEventResponse(event))
+	}
+}
+
+// replayWebhook processes a stored delivery again and logs the outcome as a
+// new entry pointing back at the original. Deliveries whose signature didn't
+// check out are never replayed, since that would skip the check. Events that
+// were already applied come back as duplicates.
+func replayWebhook(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCfg.isAdmin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		eventId, err := uuid.Parse(r.PathValue("eventID"))
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		original, err := apiCfg.dbQueries.GetWebhookEvent(r.Context(), eventId)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		process, ok := webhookProcessors[original.Source]
+		if !ok || !original.Verified {
+			respondWithError(w, http.StatusConflict, "This webhook can't be replayed")
+			return
+		}
+		header := http.Header{}
+		err = json.Unmarshal(original.Headers, &header)
+		if err != nil {
+			log.Printf("Error decoding webhook headers: %s", err)
+		}
+		receivedAt := time.Now()
+		status, result := process(apiCfg, r.Context(), original.Body)
+		replay, err := apiCfg.logWebhook(r.Context(), webhookDelivery{
+			source:     original.Source,
+			header:     header,
+			body:       original.Body,
+			verified:   true,
+			receivedAt: receivedAt,
+			status:     status,
+			result:     result,
+			replayOf:   uuid.NullUUID{UUID: original.ID, Valid: true},
+		})
+		if err != nil {
+			w.WriteHeader(500)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, webhookEventResponse(replay))
+	}
+}
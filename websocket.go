@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/uuid"
+
+	"main.go/internal/stream"
+)
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsPingTimeout  = 10 * time.Second
+	// clients are warned this long before their token expires
+	wsExpiryWarning  = time.Minute
+	wsMaxChannels    = 20
+	wsMaxMessageSize = 4096
+
+	wsStatusTokenExpired = websocket.StatusCode(4001)
+	wsStatusTokenRevoked = websocket.StatusCode(4003)
+)
+
+// wsClientMessage is everything a client can send. Channel is "timeline"
+// (the home timeline), "user" with UserID, or "tag" with Tag.
+type wsClientMessage struct {
+	Type    string    `json:"type"`
+	Channel string    `json:"channel,omitempty"`
+	UserID  uuid.UUID `json:"user_id,omitempty"`
+	Tag     string    `json:"tag,omitempty"`
+	Token   string    `json:"token,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type      string          `json:"type"`
+	Channel   string          `json:"channel,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+}
+
+// channelKey names a subscription, e.g. "timeline", "user:<id>", "tag:go".
+func (m wsClientMessage) channelKey() (string, error) {
+	switch m.Channel {
+	case "timeline":
+		return "timeline", nil
+	case "user":
+		if m.UserID == uuid.Nil {
+			return "", errors.New("user channel needs user_id")
+		}
+		return "user:" + m.UserID.String(), nil
+	case "tag":
+		if m.Tag == "" {
+			return "", errors.New("tag channel needs tag")
+		}
+		tag, ok := stream.ParseTag(m.Tag)
+		if !ok {
+			return "", errors.New("invalid tag")
+		}
+		return "tag:" + tag, nil
+	}
+	return "", errors.New("unknown channel")
+}
+
+type wsForwarded struct {
+	key string
+	sub *stream.Subscription
+	msg stream.Message
+	// closed is set when the hub ended the subscription
+	closed bool
+}
+
+// webSocket is a bidirectional alternative to streamEvents. The connection
+// opens with a session JWT in the Authorization header; the user's
+// notifications are pushed from the start and chirps once a channel is
+// subscribed. A minute before the token expires the server says so, and
+// the client keeps the connection by sending {"type":"auth","token":...}
+// with a fresh token for the same user. Otherwise it is closed with 4001,
+// or with 4003 as soon as the token is revoked.
+func webSocket(apiCfg *apiConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := apiCfg.authenticateSession(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		userId, err := claims.UserID()
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			// Accept has already answered the request
+			return
+		}
+		defer conn.CloseNow()
+		conn.SetReadLimit(wsMaxMessageSize)
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		session := wsSession{
+			cfg:     apiCfg,
+			conn:    conn,
+			userId:  userId,
+			subs:    map[string]*stream.Subscription{},
+			forward: make(chan wsForwarded),
+		}
+		defer session.unsubscribeAll()
+		session.subscribe(ctx, "notifications", stream.Filter{UserID: userId, AddressedOnly: true})
+
+		incoming := make(chan wsClientMessage)
+		readErr := make(chan error, 1)
+		go func() {
+			for {
+				var msg wsClientMessage
+				err := wsjson.Read(ctx, conn, &msg)
+				if err != nil {
+					readErr <- err
+					return
+				}
+				select {
+				case incoming <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		expiresAt := claims.ExpiresAt.Time
+		warn := time.NewTimer(time.Until(expiresAt.Add(-wsExpiryWarning)))
+		defer warn.Stop()
+		expire := time.NewTimer(time.Until(expiresAt))
+		defer expire.Stop()
+		recheck := time.NewTicker(streamRecheckInterval)
+		defer recheck.Stop()
+
+		for {
+			select {
+			case err := <-readErr:
+				status := websocket.CloseStatus(err)
+				if status != websocket.StatusNormalClosure && status != websocket.StatusGoingAway && !errors.Is(err, context.Canceled) {
+					conn.Close(websocket.StatusPolicyViolation, "invalid message")
+				}
+				return
+			case <-ping.C:
+				go func() {
+					pingCtx, cancel := context.WithTimeout(ctx, wsPingTimeout)
+					defer cancel()
+					if conn.Ping(pingCtx) != nil {
+						conn.CloseNow()
+					}
+				}()
+			case <-warn.C:
+				session.send(ctx, wsServerMessage{Type: "token_expiring", ExpiresAt: &expiresAt})
+			case <-expire.C:
+				conn.Close(wsStatusTokenExpired, "token expired")
+				return
+			case <-recheck.C:
+				err := apiCfg.recheckStreamToken(ctx, claims)
+				if errors.Is(err, errTokenRevoked) {
+					conn.Close(wsStatusTokenRevoked, "token revoked")
+					return
+				}
+				if err != nil {
+					log.Printf("Error checking stream token: %s", err)
+				}
+			case f := <-session.forward:
+				if f.closed {
+					if session.subs[f.key] == f.sub {
+						// dropped by the hub for falling behind
+						conn.Close(websocket.StatusTryAgainLater, "too slow")
+						return
+					}
+					continue
+				}
+				session.send(ctx, wsServerMessage{Type: f.msg.Event, Channel: f.key, ID: f.msg.ID, Data: f.msg.Data})
+			case msg := <-incoming:
+				switch msg.Type {
+				case "subscribe", "unsubscribe":
+					session.handleChannel(ctx, msg)
+				case "auth":
+					newClaims, err := apiCfg.validateAccessToken(ctx, msg.Token)
+					if err == nil && newClaims.ClientID != "" {
+						err = errSessionRequired
+					}
+					var newUserId uuid.UUID
+					if err == nil {
+						newUserId, err = newClaims.UserID()
+					}
+					if err != nil || newUserId != userId {
+						session.send(ctx, wsServerMessage{Type: "error", Message: "invalid token"})
+						continue
+					}
+					claims = newClaims
+					expiresAt = newClaims.ExpiresAt.Time
+					warn.Reset(time.Until(expiresAt.Add(-wsExpiryWarning)))
+					expire.Reset(time.Until(expiresAt))
+					session.send(ctx, wsServerMessage{Type: "authenticated", ExpiresAt: &expiresAt})
+				default:
+					session.send(ctx, wsServerMessage{Type: "error", Message: "unknown message type"})
+				}
+			}
+		}
+	}
+}
+
+type wsSession struct {
+	cfg     *apiConfig
+	conn    *websocket.Conn
+	userId  uuid.UUID
+	subs    map[string]*stream.Subscription
+	forward chan wsForwarded
+}
+
+func (s *wsSession) send(ctx context.Context, msg wsServerMessage) {
+	err := wsjson.Write(ctx, s.conn, msg)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error writing to websocket: %s", err)
+	}
+}
+
+func (s *wsSession) handleChannel(ctx context.Context, msg wsClientMessage) {
+	key, err := msg.channelKey()
+	if err != nil {
+		s.send(ctx, wsServerMessage{Type: "error", Message: err.Error()})
+		return
+	}
+	if msg.Type == "unsubscribe" {
+		if sub, ok := s.subs[key]; ok {
+			delete(s.subs, key)
+			s.cfg.streamHub.Unsubscribe(sub)
+		}
+		s.send(ctx, wsServerMessage{Type: "unsubscribed", Channel: key})
+		return
+	}
+	if _, ok := s.subs[key]; ok {
+		s.send(ctx, wsServerMessage{Type: "subscribed", Channel: key})
+		return
+	}
+	if len(s.subs) > wsMaxChannels {
+		s.send(ctx, wsServerMessage{Type: "error", Message: "too many channels"})
+		return
+	}
+	filter := stream.Filter{UserID: s.userId, ExcludeAddressed: true}
+	switch msg.Channel {
+	case "timeline":
+		followees, err := s.cfg.dbQueries.ListFollowees(ctx, s.userId)
+		if err != nil {
+			log.Printf("Error executing query: %s", err)
+			s.send(ctx, wsServerMessage{Type: "error", Message: "unable to subscribe"})
+			return
+		}
+		filter.Home = true
+		filter.Following = map[uuid.UUID]bool{}
+		for _, id := range followees {
+			filter.Following[id] = true
+		}
+	case "user":
+		filter.AuthorID = msg.UserID
+	case "tag":
+		filter.Tag = strings.TrimPrefix(key, "tag:")
+	}
+	s.subscribe(ctx, key, filter)
+	s.send(ctx, wsServerMessage{Type: "subscribed", Channel: key})
+}
+
+// subscribe adds a hub subscription whose messages are handed to the
+// connection's loop, so only that loop touches s.subs.
+func (s *wsSession) subscribe(ctx context.Context, key string, filter stream.Filter) {
+	sub, _, _ := s.cfg.streamHub.Subscribe(filter, "")
+	s.subs[key] = sub
+	go func() {
+		for m := range sub.C {
+			select {
+			case s.forward <- wsForwarded{key: key, sub: sub, msg: m}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case s.forward <- wsForwarded{key: key, sub: sub, closed: true}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+func (s *wsSession) unsubscribeAll() {
+	for key, sub := range s.subs {
+		delete(s.subs, key)
+		s.cfg.streamHub.Unsubscribe(sub)
+	}
+}
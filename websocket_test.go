@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/uuid"
+
+	auth "main.go/internal"
+	"main.go/internal/stream"
+)
+
+type wsTest struct {
+	t      *testing.T
+	cfg    *apiConfig
+	db     *fakeDB
+	server *httptest.Server
+	// denied is what IsAccessTokenDenied answers
+	denied atomic.Bool
+}
+
+func newWSTest(t *testing.T) *wsTest {
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt := &wsTest{t: t, db: newFakeDB()}
+	wt.db.on("IsAccessTokenDenied", func([]driver.Value) (fakeResult, error) {
+		return fakeValue(wt.denied.Load())(nil)
+	})
+	wt.db.on("IsSessionActive", fakeValue(true))
+	wt.db.on("TouchSession", fakeExec(1))
+	wt.cfg = &apiConfig{
+		jwtConfig: auth.JWTConfig{Keys: auth.NewKeySet(key), Issuer: "chirpy", Audience: "chirpy"},
+		streamHub: stream.NewHub(10, 8),
+	}
+	wt.cfg.db, wt.cfg.dbQueries = wt.db.open()
+	wt.server = httptest.NewServer(webSocket(wt.cfg))
+	t.Cleanup(wt.server.Close)
+	return wt
+}
+
+func (wt *wsTest) token(userId uuid.UUID, expiresIn time.Duration) string {
+	token, err := auth.MakeSessionJWT(userId, uuid.New(), wt.cfg.jwtConfig, expiresIn)
+	if err != nil {
+		wt.t.Fatal(err)
+	}
+	return token
+}
+
+func (wt *wsTest) dial(token string) *websocket.Conn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(wt.server.URL, "http"), &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": {"Bearer " + token}},
+	})
+	if err != nil {
+		wt.t.Fatal(err)
+	}
+	wt.t.Cleanup(func() { conn.CloseNow() })
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, msg wsClientMessage) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := wsjson.Write(ctx, conn, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, conn *websocket.Conn) wsServerMessage {
+	t.Helper()
+	msg, err := tryReceive(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func tryReceive(conn *websocket.Conn) (wsServerMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var msg wsServerMessage
+	err := wsjson.Read(ctx, conn, &msg)
+	return msg, err
+}
+
+func expect(t *testing.T, conn *websocket.Conn, typ, channel string) wsServerMessage {
+	t.Helper()
+	msg := receive(t, conn)
+	if msg.Type != typ || msg.Channel != channel {
+		t.Fatalf("got %+v, want %s on %q", msg, typ, channel)
+	}
+	return msg
+}
+
+// expectClosed reads until the server closes the connection with status.
+func expectClosed(t *testing.T, conn *websocket.Conn, status websocket.StatusCode) {
+	t.Helper()
+	for {
+		_, err := tryReceive(conn)
+		if err == nil {
+			continue
+		}
+		if got := websocket.CloseStatus(err); got != status {
+			t.Fatalf("connection ended with %v (%v), want status %d", got, err, status)
+		}
+		return
+	}
+}
+
+func TestWebSocketRequiresSessionToken(t *testing.T) {
+	wt := newWSTest(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(wt.server.URL, "http"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dial without a token: resp %v, err %v", resp, err)
+	}
+}
+
+func TestWebSocketChannels(t *testing.T) {
+	wt := newWSTest(t)
+	me, friend, stranger := uuid.New(), uuid.New(), uuid.New()
+	wt.db.on("ListFollowees", func([]driver.Value) (fakeResult, error) {
+		return fakeResult{columns: []string{"followee_id"}, rows: [][]driver.Value{{friend.String()}}}, nil
+	})
+	conn := wt.dial(wt.token(me, time.Hour))
+	hub := wt.cfg.streamHub
+
+	// notifications come without subscribing, chirps don't
+	hub.Publish(stream.Message{ID: "1", Event: "chirp", AuthorID: stranger, Data: []byte(`{}`)})
+	hub.Publish(stream.Message{ID: "2", Event: "notification", Recipient: me, Data: []byte(`{}`)})
+	if msg := expect(t, conn, "notification", "notifications"); msg.ID != "2" {
+		t.Errorf("notification id = %s", msg.ID)
+	}
+
+	send(t, conn, wsClientMessage{Type: "subscribe", Channel: "user", UserID: stranger})
+	expect(t, conn, "subscribed", "user:"+stranger.String())
+	send(t, conn, wsClientMessage{Type: "subscribe", Channel: "timeline"})
+	expect(t, conn, "subscribed", "timeline")
+	hub.Publish(stream.Message{ID: "3", Event: "chirp", AuthorID: stranger, Data: []byte(`{}`)})
+	expect(t, conn, "chirp", "user:"+stranger.String())
+	hub.Publish(stream.Message{ID: "4", Event: "chirp", AuthorID: friend, Data: []byte(`{}`)})
+	expect(t, conn, "chirp", "timeline")
+
+	send(t, conn, wsClientMessage{Type: "unsubscribe", Channel: "user", UserID: stranger})
+	expect(t, conn, "unsubscribed", "user:"+stranger.String())
+	hub.Publish(stream.Message{ID: "5", Event: "chirp", AuthorID: stranger, Data: []byte(`{}`)})
+	// a notification sent after the chirp shows the chirp was skipped
+	hub.Publish(stream.Message{ID: "6", Event: "notification", Recipient: me, Data: []byte(`{}`)})
+	if msg := expect(t, conn, "notification", "notifications"); msg.ID != "6" {
+		t.Errorf("after unsubscribing, got message %s", msg.ID)
+	}
+
+	send(t, conn, wsClientMessage{Type: "subscribe", Channel: "nope"})
+	expect(t, conn, "error", "")
+	send(t, conn, wsClientMessage{Type: "dance"})
+	expect(t, conn, "error", "")
+}
+
+func TestWebSocketReauth(t *testing.T) {
+	wt := newWSTest(t)
+	me := uuid.New()
+	conn := wt.dial(wt.token(me, 2*time.Second))
+	// the token is inside the warning window from the start
+	expect(t, conn, "token_expiring", "")
+
+	send(t, conn, wsClientMessage{Type: "auth", Token: wt.token(uuid.New(), time.Hour)})
+	if msg := expect(t, conn, "error", ""); msg.Message != "invalid token" {
+		t.Errorf("another user's token: %+v", msg)
+	}
+	send(t, conn, wsClientMessage{Type: "auth", Token: "garbage"})
+	expect(t, conn, "error", "")
+
+	send(t, conn, wsClientMessage{Type: "auth", Token: wt.token(me, time.Hour)})
+	msg := expect(t, conn, "authenticated", "")
+	if msg.ExpiresAt == nil || time.Until(*msg.ExpiresAt) < 50*time.Minute {
+		t.Errorf("authenticated until %v", msg.ExpiresAt)
+	}
+
+	// still open after the first token would have expired
+	time.Sleep(2500 * time.Millisecond)
+	send(t, conn, wsClientMessage{Type: "subscribe", Channel: "tag", Tag: "#Go"})
+	expect(t, conn, "subscribed", "tag:go")
+}
+
+func TestWebSocketTokenExpiry(t *testing.T) {
+	wt := newWSTest(t)
+	conn := wt.dial(wt.token(uuid.New(), 2*time.Second))
+	expect(t, conn, "token_expiring", "")
+	expectClosed(t, conn, wsStatusTokenExpired)
+}
+
+func TestWebSocketTokenRevoked(t *testing.T) {
+	interval := streamRecheckInterval
+	streamRecheckInterval = 50 * time.Millisecond
+	t.Cleanup(func() { streamRecheckInterval = interval })
+
+	wt := newWSTest(t)
+	conn := wt.dial(wt.token(uuid.New(), time.Hour))
+	send(t, conn, wsClientMessage{Type: "subscribe", Channel: "tag", Tag: "go"})
+	expect(t, conn, "subscribed", "tag:go")
+	wt.denied.Store(true)
+	expectClosed(t, conn, wsStatusTokenRevoked)
+
+	if !errors.Is(wt.cfg.recheckStreamToken(context.Background(), &auth.AccessClaims{}), errTokenRevoked) {
+		t.Error("a denied token passed the recheck")
+	}
+}